@@ -0,0 +1,99 @@
+package links
+
+import (
+  "container/heap"
+  "context"
+  "log"
+)
+
+// bestFirst searches forward from where forward starts, always expanding
+// the page heuristic scored highest out of those reached and not expanded
+// yet, until it reaches where backward starts. Returns both directions
+// along with the pages they met at, like search
+func (pg *PageGraph) bestFirst(ctx context.Context, forward, backward *layers, heuristic Heuristic, b *budget) (*layers, *layers, []string, error) {
+  target := backward.frontier[0]
+  queue := &pageQueue{{title: forward.frontier[0]}}
+  // Whether pages were left out for being as deep as paths may get
+  tooDeep := false
+
+  for queue.Len() > 0 {
+    page := heap.Pop(queue).(scoredPage)
+    if b.MaxDepth > 0 && page.depth >= b.MaxDepth {
+      tooDeep = true
+      continue
+    }
+    forward.depth, forward.frontier = page.depth, []string{page.title}
+    if err := b.expand(forward); err != nil {
+      return forward, backward, nil, err
+    }
+    met, err := pg.expand(ctx, forward, backward, pg.source.LinksFrom, b)
+    if err != nil {
+      return forward, backward, nil, err
+    }
+    if len(met) > 0 {
+      return forward, backward, pg.shortest(forward, backward, met), nil
+    }
+    if len(forward.frontier) == 0 {
+      continue
+    }
+
+    // Requests scoring takes are charged to the forward direction
+    scores, stats, err := heuristic.Score(ctx, target, forward.frontier)
+    forward.stats.add(stats)
+    if err != nil {
+      return forward, backward, nil, err
+    }
+    if err := b.fetched(); err != nil {
+      return forward, backward, nil, err
+    }
+    for i, title := range forward.frontier {
+      heap.Push(queue, scoredPage{title: title, score: scores[i], depth: page.depth + 1})
+    }
+  }
+  forward.frontier = []string{}
+  if err := ctx.Err(); err != nil {
+    return forward, backward, nil, err
+  }
+  if tooDeep {
+    return forward, backward, nil, b.exceeded(LimitDepth)
+  }
+  log.Println("SEARCH EXHAUSTED")
+  return forward, backward, nil, ErrNoPath
+}
+
+// scoredPage is a page reached by a best-first search, waiting to be
+// expanded
+type scoredPage struct {
+  title string
+  score float64
+  // Links from where the search started
+  depth int
+}
+
+// pageQueue is a heap of the pages a best-first search reached, the one to
+// expand next first: the highest scored, then the closest to where the
+// search started, then the first by title
+type pageQueue []scoredPage
+
+func (q pageQueue) Len() int { return len(q) }
+
+func (q pageQueue) Less(i, j int) bool {
+  if q[i].score != q[j].score {
+    return q[i].score > q[j].score
+  }
+  if q[i].depth != q[j].depth {
+    return q[i].depth < q[j].depth
+  }
+  return q[i].title < q[j].title
+}
+
+func (q pageQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *pageQueue) Push(x interface{}) { *q = append(*q, x.(scoredPage)) }
+
+func (q *pageQueue) Pop() interface{} {
+  old := *q
+  page := old[len(old)-1]
+  *q = old[:len(old)-1]
+  return page
+}
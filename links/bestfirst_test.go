@@ -0,0 +1,135 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "io/ioutil"
+  "path/filepath"
+  "reflect"
+  "testing"
+)
+
+// heuristicLinks reads the offline wiki best-first searches are compared
+// with breadth-first ones on
+func heuristicLinks(t *testing.T) Links {
+  data, err := ioutil.ReadFile(filepath.Join("testdata", "heuristic", "wiki.json"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  links := Links{}
+  if err := json.Unmarshal(data, &links); err != nil {
+    t.Fatal(err)
+  }
+  return links
+}
+
+func TestSearch_BestFirst(t *testing.T) {
+  links := heuristicLinks(t)
+  server := fakeWiki(links, nil)
+  defer server.Close()
+
+  expanded := map[string]int{}
+  requests := map[string]int{}
+  for _, name := range []string{"", HeuristicTitle, HeuristicCategories, HeuristicInbound} {
+    // On the API, to count the requests of heuristics along with the search's
+    source := testWiki(Config{Endpoint: server.URL})
+    heuristic, err := NewHeuristic(name, source)
+    if err != nil {
+      t.Fatal(err)
+    }
+    result, err := NewPageGraph(source).SearchResult(context.Background(), "Ada Lovelace", "Computer programming", SearchOptions{Heuristic: heuristic})
+    if err != nil {
+      t.Fatalf("%q: %v", name, err)
+    }
+
+    path := result.Path
+    if path[0] != "Ada Lovelace" || path[len(path)-1] != "Computer programming" {
+      t.Errorf("%q: unexpected path: %#v", name, path)
+    }
+    for i := 1; i < len(path); i++ {
+      if !contains(links[path[i-1]], path[i]) {
+        t.Errorf("%q: %s does not link to %s", name, path[i-1], path[i])
+      }
+    }
+    // Best-first searches only go forward
+    if name != "" && len(result.Backward.Expanded) > 0 {
+      t.Errorf("%q: expected no backward search, got %#v", name, result.Backward)
+    }
+
+    for _, direction := range []DirectionStats{result.Forward, result.Backward} {
+      for _, pages := range direction.Expanded {
+        expanded[name] += pages
+      }
+      requests[name] += direction.Requests
+    }
+    // All but the one looking both ends up
+    if int64(requests[name]) != source.Requests()-1 {
+      t.Errorf("%q: expected the %d requests made to be counted, got %d", name, source.Requests()-1, requests[name])
+    }
+    requests[name] = int(source.Requests())
+    t.Logf("%-10s %d pages expanded, %d links, %d API requests, %d hops", name, expanded[name], result.Forward.Links+result.Backward.Links, requests[name], len(path)-1)
+  }
+
+  // Breadth-first searches find a shortest path, expanding many more pages
+  // to be sure of it
+  if expanded[""] != 12 {
+    t.Errorf("expected breadth-first to expand 12 pages, got %d", expanded[""])
+  }
+  for _, name := range []string{HeuristicTitle, HeuristicCategories} {
+    if expanded[name] >= expanded[""]/2 {
+      t.Errorf("%q: expected much fewer pages expanded than %d, got %d", name, expanded[""], expanded[name])
+    }
+  }
+  // But in more requests, as breadth-first asks for up to 50 pages at once
+  for _, name := range []string{HeuristicTitle, HeuristicCategories, HeuristicInbound} {
+    if requests[name] <= requests[""] {
+      t.Errorf("%q: expected more requests than the %d of breadth-first, got %d", name, requests[""], requests[name])
+    }
+  }
+
+  // Requests made to score pages count against the budget
+  heuristic := &InboundHeuristic{Source: testWiki(Config{Endpoint: server.URL})}
+  _, err := NewPageGraph(heuristic.Source).Search("Ada Lovelace", "Computer programming", SearchOptions{Heuristic: heuristic, MaxRequests: int64(requests[HeuristicTitle])})
+  var limitErr *LimitError
+  if !errors.As(err, &limitErr) || limitErr.Limit != LimitRequests {
+    t.Errorf("expected the requests limit, got %v", err)
+  }
+}
+
+func TestSearch_BestFirstLimits(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "Start": {"A", "B"},
+    "A":     {"C"},
+    "B":     {"C"},
+    "C":     {"Target"},
+    "Lost":  {"Start"},
+  })
+  heuristic := TitleHeuristic{}
+
+  path, err := NewPageGraph(g).Search("Start", "Target", SearchOptions{Heuristic: heuristic})
+  if err != nil || !reflect.DeepEqual([]string{"Start", "A", "C", "Target"}, path) {
+    t.Errorf("unexpected path: %#v, %v", path, err)
+  }
+  if path, err = NewPageGraph(g).Search("Start", "Start", SearchOptions{Heuristic: heuristic}); err != nil || len(path) != 1 {
+    t.Errorf("unexpected path: %#v, %v", path, err)
+  }
+  if _, err = NewPageGraph(g).Search("Start", "Lost", SearchOptions{Heuristic: heuristic}); err != ErrNoPath {
+    t.Errorf("expected ErrNoPath, got %v", err)
+  }
+
+  for _, test := range []struct {
+    options SearchOptions
+    limit string
+  }{
+    {SearchOptions{MaxDepth: 2}, LimitDepth},
+    {SearchOptions{MaxPages: 2}, LimitPages},
+  } {
+    test.options.Heuristic = heuristic
+    _, err := NewPageGraph(g).Search("Start", "Target", test.options)
+    var limitErr *LimitError
+    if !errors.As(err, &limitErr) || limitErr.Limit != test.limit {
+      t.Errorf("expected the %s limit, got %v", test.limit, err)
+    }
+  }
+}
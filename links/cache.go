@@ -0,0 +1,290 @@
+package links
+
+import (
+  "context"
+  "crypto/sha1"
+  "encoding/gob"
+  "encoding/hex"
+  "io/ioutil"
+  "log"
+  "os"
+  "path/filepath"
+  "sync/atomic"
+  "time"
+)
+
+// Cache stores the links fetched by link sources on disk, one gob file per
+// wiki, title and direction, so races sharing pages don't fetch them again
+type Cache struct {
+  Dir string
+  // How long fetched links are used for, forever if 0
+  TTL time.Duration
+
+  hits int64
+  misses int64
+}
+
+// CacheStats counts titles whose links were found in the cache or not
+type CacheStats struct {
+  Hits int64
+  Misses int64
+}
+
+// cacheEntry is what is stored for each title
+type cacheEntry struct {
+  Links []string
+  Missing bool
+  // Title this one redirects to, whose entry holds the links
+  Redirect string
+  Fetched time.Time
+}
+
+// OpenCache returns a Cache in dir, creating it if needed
+func OpenCache(dir string, ttl time.Duration) (*Cache, error) {
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return nil, err
+  }
+  return &Cache{Dir: dir, TTL: ttl}, nil
+}
+
+// Stats returns the hits and misses so far
+func (c *Cache) Stats() CacheStats {
+  return CacheStats{Hits: atomic.LoadInt64(&c.hits), Misses: atomic.LoadInt64(&c.misses)}
+}
+
+// Source returns a LinkSource answering from the cache where possible and
+// from source otherwise. wiki identifies the links source serves, eg. its API
+// endpoint and namespaces
+func (c *Cache) Source(source LinkSource, wiki string) LinkSource {
+  return &cachedSource{cache: c, source: source, wiki: wiki}
+}
+
+func (c *Cache) path(wiki, direction, title string) string {
+  sum := sha1.Sum([]byte(wiki + "\x00" + direction + "\x00" + title))
+  name := hex.EncodeToString(sum[:])
+  return filepath.Join(c.Dir, name[:2], name+".gob")
+}
+
+// load returns the entry for title if it has one that hasn't expired
+func (c *Cache) load(wiki, direction, title string) (cacheEntry, bool) {
+  entry := cacheEntry{}
+  f, err := os.Open(c.path(wiki, direction, title))
+  if err != nil {
+    return entry, false
+  }
+  defer f.Close()
+  if err := gob.NewDecoder(f).Decode(&entry); err != nil {
+    log.Printf("CACHE ENTRY UNREADABLE: %#v: %s", title, err)
+    return entry, false
+  }
+  if c.TTL > 0 && time.Since(entry.Fetched) > c.TTL {
+    return entry, false
+  }
+  return entry, true
+}
+
+func (c *Cache) store(wiki, direction, title string, entry cacheEntry) error {
+  path := c.path(wiki, direction, title)
+  if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+    return err
+  }
+
+  // Write to a temporary file first so readers never see half an entry
+  f, err := ioutil.TempFile(filepath.Dir(path), ".entry")
+  if err != nil {
+    return err
+  }
+  if err := gob.NewEncoder(f).Encode(entry); err != nil {
+    f.Close()
+    os.Remove(f.Name())
+    return err
+  }
+  if err := f.Close(); err != nil {
+    os.Remove(f.Name())
+    return err
+  }
+  return os.Rename(f.Name(), path)
+}
+
+// cachedSource is a LinkSource going through a Cache
+type cachedSource struct {
+  cache *Cache
+  source LinkSource
+  wiki string
+}
+
+func (s *cachedSource) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return s.links(ctx, "from", titles, s.source.LinksFrom)
+}
+
+func (s *cachedSource) LinksHere(ctx context.Context, titles []string) chan Response {
+  return s.links(ctx, "here", titles, s.source.LinksHere)
+}
+
+// Find answers from the cache if it knows every title, and from the source
+// otherwise
+func (s *cachedSource) Find(ctx context.Context, titles []string) Response {
+  resp := Response{Missing: []string{}, Redirects: map[string]string{}}
+  for _, title := range titles {
+    entry, ok := s.cache.load(s.wiki, "from", title)
+    if !ok {
+      entry, ok = s.cache.load(s.wiki, "here", title)
+    }
+    if !ok {
+      if finder, isFinder := s.source.(Finder); isFinder {
+        return finder.Find(ctx, titles)
+      }
+      return Response{}
+    }
+    if entry.Missing {
+      resp.Missing = append(resp.Missing, title)
+    }
+    if len(entry.Redirect) > 0 {
+      resp.Redirects[title] = entry.Redirect
+    }
+  }
+  return resp
+}
+
+// Suggest passes through to the source if it is a Finder
+func (s *cachedSource) Suggest(ctx context.Context, title string, limit int) ([]string, error) {
+  if finder, ok := s.source.(Finder); ok {
+    return finder.Suggest(ctx, title, limit)
+  }
+  return nil, nil
+}
+
+// Categories passes through to the source if it is a CategoryLister, and
+// sends the cached links otherwise
+func (s *cachedSource) Categories(ctx context.Context, titles []string) chan Response {
+  if lister, ok := s.source.(CategoryLister); ok {
+    return lister.Categories(ctx, titles)
+  }
+  return s.LinksFrom(ctx, titles)
+}
+
+// CountLinksHere passes through to the source if it is an InboundCounter,
+// and counts the cached links otherwise
+func (s *cachedSource) CountLinksHere(ctx context.Context, titles []string) (map[string]int, FetchStats, error) {
+  if counter, ok := s.source.(InboundCounter); ok {
+    return counter.CountLinksHere(ctx, titles)
+  }
+  return countLinksHere(ctx, s, titles)
+}
+
+// Requests passes through to the source if it counts its requests
+func (s *cachedSource) Requests() int64 {
+  if counter, ok := s.source.(RequestCounter); ok {
+    return counter.Requests()
+  }
+  return 0
+}
+
+// links sends the cached links of titles, then fetches the others from the
+// source, caching them once all of them have been received and before the
+// last of them is sent
+func (s *cachedSource) links(ctx context.Context, direction string, titles []string, fetch func(context.Context, []string) chan Response) chan Response {
+  c := make(chan Response)
+
+  go func() {
+    defer close(c)
+
+    cached := Response{Links: Links{}, Missing: []string{}, Redirects: map[string]string{}}
+    misses := []string{}
+    for _, title := range titles {
+      entry, ok := s.cache.load(s.wiki, direction, title)
+      if ok && len(entry.Redirect) > 0 {
+        cached.Redirects[title] = entry.Redirect
+        title = entry.Redirect
+        entry, ok = s.cache.load(s.wiki, direction, title)
+      }
+      if !ok {
+        misses = append(misses, title)
+        continue
+      }
+      if entry.Missing {
+        cached.Missing = append(cached.Missing, title)
+      } else if len(entry.Links) > 0 {
+        cached.Links[title] = entry.Links
+      }
+    }
+    atomic.AddInt64(&s.cache.hits, int64(len(titles)-len(misses)))
+    atomic.AddInt64(&s.cache.misses, int64(len(misses)))
+
+    if len(titles) > len(misses) {
+      cached.Stats.CacheHits = len(titles)-len(misses)
+      select {
+      case c <- cached:
+      case <-ctx.Done():
+        return
+      }
+    }
+    if len(misses) == 0 {
+      return
+    }
+
+    send := func(resp Response) bool {
+      select {
+      case c <- resp:
+        return true
+      case <-ctx.Done():
+        return false
+      }
+    }
+
+    // Links of a title can be spread over several responses. The last one is
+    // held back until they are stored, so callers done with it find them
+    var held *Response
+    fetched := map[string]cacheEntry{}
+    for resp := range fetch(ctx, misses) {
+      if resp.Err != nil {
+        if held == nil || send(*held) {
+          send(resp)
+        }
+        return
+      }
+      for title, linked := range resp.Links {
+        entry := fetched[title]
+        entry.Links = append(entry.Links, linked...)
+        fetched[title] = entry
+      }
+      for _, title := range resp.Missing {
+        fetched[title] = cacheEntry{Missing: true}
+      }
+      for alias, title := range resp.Redirects {
+        fetched[alias] = cacheEntry{Redirect: title}
+        if _, ok := fetched[title]; !ok {
+          fetched[title] = cacheEntry{}
+        }
+      }
+
+      if held != nil && !send(*held) {
+        return
+      }
+      resp := resp
+      held = &resp
+    }
+    if ctx.Err() != nil {
+      return
+    }
+
+    // Requested pages that exist without links are cached as such
+    now := time.Now()
+    for _, title := range misses {
+      if _, ok := fetched[title]; !ok {
+        fetched[title] = cacheEntry{}
+      }
+    }
+    for title, entry := range fetched {
+      entry.Fetched = now
+      if err := s.cache.store(s.wiki, direction, title, entry); err != nil {
+        log.Printf("CACHE WRITE FAILED: %#v: %s", title, err)
+      }
+    }
+    if held != nil {
+      send(*held)
+    }
+  }()
+
+  return c
+}
@@ -0,0 +1,141 @@
+package links
+
+import (
+  "context"
+  "io/ioutil"
+  "os"
+  "reflect"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+// countingSource counts the titles it's asked for
+type countingSource struct {
+  LinkSource
+  titles int64
+}
+
+func (s *countingSource) LinksFrom(ctx context.Context, titles []string) chan Response {
+  atomic.AddInt64(&s.titles, int64(len(titles)))
+  return s.LinkSource.LinksFrom(ctx, titles)
+}
+
+func (s *countingSource) LinksHere(ctx context.Context, titles []string) chan Response {
+  atomic.AddInt64(&s.titles, int64(len(titles)))
+  return s.LinkSource.LinksHere(ctx, titles)
+}
+
+func (s *countingSource) Find(ctx context.Context, titles []string) Response {
+  return s.LinkSource.(Finder).Find(ctx, titles)
+}
+
+func (s *countingSource) Suggest(ctx context.Context, title string, limit int) ([]string, error) {
+  return s.LinkSource.(Finder).Suggest(ctx, title, limit)
+}
+
+func tempCache(t *testing.T, ttl time.Duration) *Cache {
+  dir, err := ioutil.TempDir("", "wikiracer-cache")
+  if err != nil {
+    t.Fatal(err)
+  }
+  t.Cleanup(func() { os.RemoveAll(dir) })
+  cache, err := OpenCache(dir, ttl)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return cache
+}
+
+func TestCache_Search(t *testing.T) {
+  g := NewMemoryGraph(chain(Links{}, "Page", 10))
+  g.Redirect("First", "Page0")
+  source := &countingSource{LinkSource: g}
+  cache := tempCache(t, 0)
+
+  pg := NewPageGraph(cache.Source(source, "memory"))
+  path, err := pg.Search("First", "Page9")
+  if err != nil {
+    t.Fatal(err)
+  }
+  fetched := atomic.LoadInt64(&source.titles)
+  if fetched == 0 || cache.Stats().Hits != 0 {
+    t.Fatalf("expected only misses, fetched %d titles, stats: %#v", fetched, cache.Stats())
+  }
+
+  // A new cache in the same directory answers most of the same race, all
+  // but the layer cut short when the path was found
+  reopened, err := OpenCache(cache.Dir, 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  pg = NewPageGraph(reopened.Source(source, "memory"))
+  cached, err := pg.Search("First", "Page9")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(path, cached) {
+    t.Errorf("expected: %#v\ngot: %#v", path, cached)
+  }
+  refetched := atomic.LoadInt64(&source.titles) - fetched
+  if stats := reopened.Stats(); refetched >= fetched || stats.Hits == 0 || stats.Misses != refetched {
+    t.Errorf("expected mostly hits, fetched %d of %d titles again, stats: %#v", refetched, fetched, stats)
+  }
+
+  // Another wiki doesn't share entries
+  pg = NewPageGraph(reopened.Source(source, "other"))
+  if _, err := pg.Search("First", "Page9"); err != nil {
+    t.Fatal(err)
+  }
+  if reopened.Stats().Misses == 0 {
+    t.Errorf("expected misses for another wiki, got: %#v", reopened.Stats())
+  }
+}
+
+func TestCache_Missing(t *testing.T) {
+  g := NewMemoryGraph(Links{"A": {"B"}})
+  cache := tempCache(t, 0)
+  source := cache.Source(g, "memory")
+
+  for i := 0; i < 2; i++ {
+    resp := <-source.LinksFrom(context.Background(), []string{"Z"})
+    if !reflect.DeepEqual([]string{"Z"}, resp.Missing) {
+      t.Errorf("expected Z to be missing, got: %#v", resp)
+    }
+  }
+  if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+    t.Errorf("unexpected stats: %#v", stats)
+  }
+}
+
+func TestCache_TTL(t *testing.T) {
+  g := NewMemoryGraph(Links{"A": {"B"}})
+  source := &countingSource{LinkSource: g}
+  cache := tempCache(t, time.Hour)
+  cached := cache.Source(source, "memory")
+
+  for range cached.LinksFrom(context.Background(), []string{"A"}) {
+  }
+  for range cached.LinksFrom(context.Background(), []string{"A"}) {
+  }
+  if source.titles != 1 {
+    t.Errorf("expected 1 fetch, got %d", source.titles)
+  }
+
+  // Age the entry past the TTL
+  entry, ok := cache.load("memory", "from", "A")
+  if !ok {
+    t.Fatal("expected A to be cached")
+  }
+  entry.Fetched = time.Now().Add(-2 * time.Hour)
+  if err := cache.store("memory", "from", "A", entry); err != nil {
+    t.Fatal(err)
+  }
+  resp := <-cached.LinksFrom(context.Background(), []string{"A"})
+  if !reflect.DeepEqual(Links{"A": {"B"}}, resp.Links) {
+    t.Errorf("unexpected links: %#v", resp.Links)
+  }
+  if source.titles != 2 {
+    t.Errorf("expected expired entry to be fetched again, got %d fetches", source.titles)
+  }
+}
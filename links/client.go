@@ -0,0 +1,235 @@
+package links
+
+import (
+  "context"
+  "fmt"
+  "io/ioutil"
+  "log"
+  "math/rand"
+  "net"
+  "net/http"
+  "strconv"
+  "sync"
+  "time"
+)
+
+var (
+  tr = &http.Transport{
+    MaxIdleConns:     10,
+    IdleConnTimeout:  30 * time.Second,
+    DisableCompression: true,
+  }
+
+  // DefaultClient is shared by every MediaWiki source that isn't given its
+  // own Client, so concurrent races stay within the API etiquette together.
+  // See https://www.mediawiki.org/wiki/API:Etiquette
+  DefaultClient = &Client{
+    HTTP: &http.Client{ Transport: tr, Timeout: 30 * time.Second },
+    Rate: 10,
+    Burst: 10,
+    MaxInFlight: 2,
+    MaxRetries: 4,
+    Backoff: 500 * time.Millisecond,
+    MaxBackoff: 30 * time.Second,
+    MaxLag: 5,
+  }
+)
+
+// Client sends GET requests to a MediaWiki API with a limited number of
+// requests in flight at a limited rate, retrying with jittered exponential
+// backoff when the API is overloaded. Zero values disable the matching limit.
+// Settings must not be changed once the Client has been used
+type Client struct {
+  HTTP *http.Client
+  // Requests per second and how many may be sent at once after idling
+  Rate float64
+  Burst int
+  // Requests waiting for a response at the same time
+  MaxInFlight int
+  // Retries of requests failing with 429, 5xx, maxlag or a timeout
+  MaxRetries int
+  // First and longest delay between retries
+  Backoff time.Duration
+  MaxBackoff time.Duration
+  // Seconds of database replication lag after which the API should refuse
+  // requests, see https://www.mediawiki.org/wiki/Manual:Maxlag_parameter
+  MaxLag int
+
+  once sync.Once
+  limiter *tokenBucket
+  inFlight chan struct{}
+}
+
+// retryError is a failed request that may succeed when retried
+type retryError struct {
+  err error
+  // Delay asked for by the server with Retry-After
+  after time.Duration
+}
+
+func (e *retryError) Error() string {
+  return e.err.Error()
+}
+
+func (e *retryError) Unwrap() error {
+  return e.err
+}
+
+func (c *Client) init() {
+  c.once.Do(func() {
+    if c.HTTP == nil {
+      c.HTTP = http.DefaultClient
+    }
+    if c.Rate > 0 {
+      c.limiter = newTokenBucket(c.Rate, c.Burst)
+    }
+    if c.MaxInFlight > 0 {
+      c.inFlight = make(chan struct{}, c.MaxInFlight)
+    }
+  })
+}
+
+// Get fetches url, retrying when the API asks us to back off
+func (c *Client) Get(ctx context.Context, url, userAgent string) ([]byte, error) {
+  c.init()
+
+  for attempt := 0; ; attempt++ {
+    body, err := c.get(ctx, url, userAgent)
+    retry, ok := err.(*retryError)
+    if !ok {
+      return body, err
+    }
+    if attempt >= c.MaxRetries || ctx.Err() != nil {
+      return nil, retry.err
+    }
+
+    delay := c.backoff(attempt)
+    if retry.after > delay {
+      delay = retry.after
+    }
+    log.Printf("RETRYING IN %s: %s", delay, retry.err)
+
+    timer := time.NewTimer(delay)
+    select {
+    case <-timer.C:
+    case <-ctx.Done():
+      timer.Stop()
+      return nil, ctx.Err()
+    }
+  }
+}
+
+// Returns a random delay up to the exponential backoff for the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+  max := c.Backoff << uint(attempt)
+  if max <= 0 || (c.MaxBackoff > 0 && max > c.MaxBackoff) {
+    max = c.MaxBackoff
+  }
+  if max <= 0 {
+    return 0
+  }
+  return time.Duration(rand.Int63n(int64(max)))
+}
+
+func (c *Client) get(ctx context.Context, url, userAgent string) ([]byte, error) {
+  if c.inFlight != nil {
+    select {
+    case c.inFlight <- struct{}{}:
+      defer func() { <-c.inFlight }()
+    case <-ctx.Done():
+      return nil, ctx.Err()
+    }
+  }
+  if c.limiter != nil {
+    if err := c.limiter.wait(ctx); err != nil {
+      return nil, err
+    }
+  }
+
+  request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+  if err != nil {
+    return nil, err
+  }
+  request.Header.Set("User-Agent", userAgent)
+
+  response, err := c.HTTP.Do(request)
+  if err != nil {
+    if netErr, ok := err.(net.Error); ok && netErr.Timeout() && ctx.Err() == nil {
+      return nil, &retryError{err: err}
+    }
+    return nil, err
+  }
+  defer response.Body.Close()
+
+  after := retryAfter(response.Header.Get("Retry-After"))
+  switch code := response.Header.Get("MediaWiki-API-Error"); {
+  case response.StatusCode == http.StatusTooManyRequests, code == "ratelimited":
+    return nil, &retryError{ErrRateLimited, after}
+  case code == "maxlag":
+    return nil, &retryError{&ErrAPI{Code: code, Info: "database replication lag"}, after}
+  case response.StatusCode >= 500:
+    return nil, &retryError{fmt.Errorf("got status code: %s", response.Status), after}
+  case response.StatusCode != http.StatusOK:
+    return nil, fmt.Errorf("got status code: %s", response.Status)
+  }
+
+  return ioutil.ReadAll(response.Body)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date
+func retryAfter(header string) time.Duration {
+  if len(header) == 0 {
+    return 0
+  }
+  if seconds, err := strconv.Atoi(header); err == nil {
+    return time.Duration(seconds) * time.Second
+  }
+  if date, err := http.ParseTime(header); err == nil {
+    return time.Until(date)
+  }
+  return 0
+}
+
+// tokenBucket allows rate events per second on average, and up to burst at once
+type tokenBucket struct {
+  mu sync.Mutex
+  rate float64
+  burst float64
+  tokens float64
+  last time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+  if burst < 1 {
+    burst = 1
+  }
+  return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a token is available and takes it
+func (b *tokenBucket) wait(ctx context.Context) error {
+  for {
+    b.mu.Lock()
+    now := time.Now()
+    b.tokens += now.Sub(b.last).Seconds() * b.rate
+    if b.tokens > b.burst {
+      b.tokens = b.burst
+    }
+    b.last = now
+    if b.tokens >= 1 {
+      b.tokens--
+      b.mu.Unlock()
+      return nil
+    }
+    delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+    b.mu.Unlock()
+
+    timer := time.NewTimer(delay)
+    select {
+    case <-timer.C:
+    case <-ctx.Done():
+      timer.Stop()
+      return ctx.Err()
+    }
+  }
+}
@@ -0,0 +1,133 @@
+package links
+
+import (
+  "context"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+func TestClient_Retry(t *testing.T) {
+  tests := []struct {
+    name    string
+    fail    func(w http.ResponseWriter)
+    expect  error
+  }{
+    {"unavailable", func(w http.ResponseWriter) {
+      w.WriteHeader(http.StatusServiceUnavailable)
+    }, nil},
+    {"too many requests", func(w http.ResponseWriter) {
+      w.WriteHeader(http.StatusTooManyRequests)
+    }, ErrRateLimited},
+    {"maxlag", func(w http.ResponseWriter) {
+      w.Header().Set("MediaWiki-API-Error", "maxlag")
+      w.Write([]byte(`{"error": {"code": "maxlag"}}`))
+    }, nil},
+  }
+
+  for _, test := range tests {
+    var requests int64
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      if atomic.AddInt64(&requests, 1) <= 2 {
+        test.fail(w)
+        return
+      }
+      w.Write([]byte("ok"))
+    }))
+
+    c := &Client{MaxRetries: 2, Backoff: time.Millisecond}
+    body, err := c.Get(context.Background(), server.URL, "test")
+    if err != nil || string(body) != "ok" {
+      t.Errorf("%s: expected ok after retrying, got: %#v, %v", test.name, string(body), err)
+    }
+
+    // One retry short of succeeding
+    atomic.StoreInt64(&requests, 0)
+    c = &Client{MaxRetries: 1, Backoff: time.Millisecond}
+    _, err = c.Get(context.Background(), server.URL, "test")
+    if err == nil || (test.expect != nil && !errors.Is(err, test.expect)) {
+      t.Errorf("%s: expected %v, got: %v", test.name, test.expect, err)
+    }
+    server.Close()
+  }
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+  var requests int64
+  var first time.Time
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if atomic.AddInt64(&requests, 1) == 1 {
+      first = time.Now()
+      w.Header().Set("Retry-After", "1")
+      w.WriteHeader(http.StatusTooManyRequests)
+      return
+    }
+    if waited := time.Since(first); waited < time.Second {
+      t.Errorf("retried after %s despite Retry-After", waited)
+    }
+  }))
+  defer server.Close()
+
+  c := &Client{MaxRetries: 1, Backoff: time.Millisecond}
+  if _, err := c.Get(context.Background(), server.URL, "test"); err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestClient_MaxInFlight(t *testing.T) {
+  var inFlight, most int64
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    n := atomic.AddInt64(&inFlight, 1)
+    defer atomic.AddInt64(&inFlight, -1)
+    for {
+      m := atomic.LoadInt64(&most)
+      if n <= m || atomic.CompareAndSwapInt64(&most, m, n) {
+        break
+      }
+    }
+    time.Sleep(10 * time.Millisecond)
+  }))
+  defer server.Close()
+
+  c := &Client{MaxInFlight: 2}
+  var wg sync.WaitGroup
+  for i := 0; i < 10; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      c.Get(context.Background(), server.URL, "test")
+    }()
+  }
+  wg.Wait()
+
+  if most > 2 {
+    t.Errorf("expected at most 2 requests in flight, got %d", most)
+  }
+}
+
+func TestClient_Rate(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+  defer server.Close()
+
+  c := &Client{Rate: 100, Burst: 1}
+  start := time.Now()
+  for i := 0; i < 11; i++ {
+    c.Get(context.Background(), server.URL, "test")
+  }
+  if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+    t.Errorf("11 requests at 100/s took only %s", elapsed)
+  }
+}
+
+func TestClient_MaxLagParameter(t *testing.T) {
+  wiki := &MediaWiki{Client: &Client{MaxLag: 5}}
+  url := wiki.buildQuery("pl", "links", []string{"foo"}, "")
+  if !strings.Contains(url, "maxlag=5") {
+    t.Errorf("expected maxlag in %#v", url)
+  }
+}
@@ -0,0 +1,217 @@
+package links
+
+import (
+  "fmt"
+  "net/url"
+  "regexp"
+  "strconv"
+  "strings"
+  "time"
+)
+
+const (
+  defaultLang = "en"
+  userAgent= "wikiracer/0.86 (http://github.com/86me/wikiracer); egon@hyszczak.net"
+
+  /* https://en.wikipedia.org/wiki/Wikipedia:Namespace#Programming */
+  namespace = "0|14|100" // main|category|portal
+
+  // DefaultBatchWorkers is the number of batches of titles fetched at once
+  // unless configured otherwise
+  DefaultBatchWorkers = 4
+)
+
+// Link rules, picking which links of a page races follow
+const (
+  // Every link the API lists
+  RulesAll = "all"
+  // Links in the body prose of the rendered article, see HTMLSource
+  RulesHuman = "human"
+)
+
+// Race modes, picking the namespaces races go through
+const (
+  // Articles only, as in the game played by humans
+  ModeStrict = "strict"
+  // Articles, categories and portals
+  ModeLoose = "loose"
+  // Namespaces of one's choosing
+  ModeCustom = "custom"
+)
+
+// ModeNamespaces returns the pipe separated namespaces races of mode go
+// through, namespaces if mode is ModeCustom. An empty mode is ModeCustom if
+// namespaces are given and ModeLoose otherwise
+func ModeNamespaces(mode, namespaces string) (string, error) {
+  if len(mode) == 0 {
+    mode = ModeLoose
+    if len(namespaces) > 0 {
+      mode = ModeCustom
+    }
+  }
+  switch mode {
+  case ModeStrict, ModeLoose:
+    if len(namespaces) > 0 {
+      return "", fmt.Errorf("namespaces only go with the %s mode", ModeCustom)
+    }
+    if mode == ModeStrict {
+      return "0", nil
+    }
+    return namespace, nil
+  case ModeCustom:
+    if _, err := ParseNamespaces(namespaces); err != nil {
+      return "", err
+    }
+    return namespaces, nil
+  }
+  return "", fmt.Errorf("invalid mode: %s", mode)
+}
+
+// ParseNamespaces returns the numbers of pipe separated namespaces
+func ParseNamespaces(namespaces string) ([]int, error) {
+  numbers := []int{}
+  for _, ns := range strings.Split(namespaces, "|") {
+    number, err := strconv.Atoi(ns)
+    if err != nil {
+      return nil, fmt.Errorf("invalid namespaces: %s", namespaces)
+    }
+    numbers = append(numbers, number)
+  }
+  return numbers, nil
+}
+
+// Language codes are used as a host name, so keep them to what Wikipedia uses
+var langPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Config selects the MediaWiki API a MediaWiki source talks to. The zero value
+// is English Wikipedia
+type Config struct {
+  // API URL, eg. "https://wiki.example.com/w/api.php". Overrides Lang
+  Endpoint string
+  // Wikipedia language edition, eg. "de"
+  Lang string
+  // Sent with every request, see https://meta.wikimedia.org/wiki/User-Agent_policy
+  UserAgent string
+  // Pipe separated namespace numbers links are followed into
+  Namespaces string
+  // Batches of 50 titles whose links are fetched at once, DefaultBatchWorkers
+  // if 0. The Client still limits the requests in flight
+  BatchWorkers int
+  // Drops boring links, DefaultFilter if nil
+  Filter *Filter
+  // Links followed, RulesAll if empty. See NewSource
+  Rules string
+  // Race on the revisions of pages current at this time instead of their
+  // latest, if set. See RevisionSource
+  AsOf time.Time
+}
+
+// Validate reports whether the Config describes a usable API
+func (c Config) Validate() error {
+  if len(c.Endpoint) > 0 {
+    u, err := url.Parse(c.Endpoint)
+    if err != nil {
+      return err
+    }
+    if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+      return fmt.Errorf("invalid endpoint: %s", c.Endpoint)
+    }
+  }
+  if len(c.Lang) > 0 && !langPattern.MatchString(c.Lang) {
+    return fmt.Errorf("invalid language code: %s", c.Lang)
+  }
+  if len(c.Namespaces) > 0 {
+    if _, err := ParseNamespaces(c.Namespaces); err != nil {
+      return err
+    }
+  }
+  if len(c.Rules) > 0 && c.Rules != RulesAll && c.Rules != RulesHuman {
+    return fmt.Errorf("invalid rules: %s", c.Rules)
+  }
+  if c.BatchWorkers < 0 {
+    return fmt.Errorf("invalid batch workers: %d", c.BatchWorkers)
+  }
+  if !c.AsOf.IsZero() {
+    if c.AsOf.After(time.Now()) {
+      return fmt.Errorf("as of time is in the future: %s", c.AsOf.Format(time.RFC3339))
+    }
+    // Old revisions are only read as wikitext
+    if c.Rules == RulesHuman {
+      return fmt.Errorf("%s rules can't race as of a time", RulesHuman)
+    }
+  }
+  return nil
+}
+
+// ParseAsOf reads the time of a race on old revisions, as RFC 3339, eg.
+// "2024-01-01T00:00:00Z", or a date standing for its midnight in UTC
+func ParseAsOf(s string) (time.Time, error) {
+  if t, err := time.Parse(time.RFC3339, s); err == nil {
+    return t, nil
+  }
+  t, err := time.Parse("2006-01-02", s)
+  if err != nil {
+    return time.Time{}, fmt.Errorf("invalid as of time: %s", s)
+  }
+  return t, nil
+}
+
+// APIEndpoint returns the URL of the API
+func (c Config) APIEndpoint() string {
+  if len(c.Endpoint) > 0 {
+    return c.Endpoint
+  }
+  lang := c.Lang
+  if len(lang) == 0 {
+    lang = defaultLang
+  }
+  return fmt.Sprintf("https://%s.wikipedia.org/w/api.php", lang)
+}
+
+// Wiki identifies the links this config races on, for keying cached links
+func (c Config) Wiki() string {
+  wiki := c.APIEndpoint() + "?namespaces=" + c.namespaces()
+  if filter := c.filter(); filter.id != DefaultFilter.id {
+    wiki += "&filter=" + filter.id
+  }
+  if c.Rules == RulesHuman {
+    wiki += "&rules=" + c.Rules
+  }
+  if !c.AsOf.IsZero() {
+    wiki += "&as-of=" + c.AsOf.UTC().Format(time.RFC3339)
+  }
+  return wiki
+}
+
+func (c Config) userAgent() string {
+  if len(c.UserAgent) > 0 {
+    return c.UserAgent
+  }
+  return userAgent
+}
+
+func (c Config) namespaces() string {
+  if len(c.Namespaces) > 0 {
+    return c.Namespaces
+  }
+  return namespace
+}
+
+// filter returns the Filter of the wiki, from the rules of its API's host
+func (c Config) filter() *Filter {
+  if c.Filter == nil {
+    return DefaultFilter
+  }
+  u, err := url.Parse(c.APIEndpoint())
+  if err != nil {
+    return c.Filter
+  }
+  return c.Filter.Wiki(u.Hostname())
+}
+
+func (c Config) batchWorkers() int {
+  if c.BatchWorkers > 0 {
+    return c.BatchWorkers
+  }
+  return DefaultBatchWorkers
+}
@@ -0,0 +1,603 @@
+package links
+
+import (
+  "bufio"
+  "compress/bzip2"
+  "compress/gzip"
+  "encoding/xml"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "path/filepath"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+// English names of the namespaces SQL dumps refer to by number. XML dumps
+// carry their own
+var namespaceNames = map[int]string{
+  0: "",
+  1: "Talk",
+  2: "User",
+  4: "Wikipedia",
+  6: "File",
+  10: "Template",
+  12: "Help",
+  14: "Category",
+  100: "Portal",
+}
+
+// Kinds of dump files, in the order they have to be imported
+const (
+  dumpPages = iota
+  dumpRedirects
+  dumpLinkTargets
+  dumpPageLinks
+)
+
+// Matches the target of a [[wiki link]] in wikitext
+var wikiLinkRegexp = regexp.MustCompile(`\[\[([^\[\]|]+)`)
+
+// ImportDump builds a Graph out of Wikipedia database dumps: the page,
+// pagelinks, linktarget and redirect tables as .sql files, or the wikitext of
+// pages-articles .xml files, either of them optionally compressed (.gz, .bz2).
+// Only pages in the pipe separated namespaces are imported
+func ImportDump(paths []string, namespaces string) (*Graph, error) {
+  im, err := newImporter(namespaces)
+  if err != nil {
+    return nil, err
+  }
+
+  kinds := map[string]int{}
+  for _, path := range paths {
+    kind, err := dumpKind(path)
+    if err != nil {
+      return nil, err
+    }
+    kinds[path] = kind
+  }
+  sorted := append([]string{}, paths...)
+  sort.SliceStable(sorted, func(i, j int) bool { return kinds[sorted[i]] < kinds[sorted[j]] })
+
+  for _, path := range sorted {
+    log.Printf("IMPORTING: %s", path)
+    if err := im.importFile(path); err != nil {
+      return nil, fmt.Errorf("%s: %w", path, err)
+    }
+  }
+  return im.graph(), nil
+}
+
+// dumpKind tells which table path holds from its name, eg. enwiki-20240601-pagelinks.sql.gz
+func dumpKind(path string) (int, error) {
+  name := filepath.Base(path)
+  switch {
+  case strings.Contains(name, ".xml"), strings.Contains(name, "-page.sql"):
+    return dumpPages, nil
+  case strings.Contains(name, "-redirect.sql"):
+    return dumpRedirects, nil
+  case strings.Contains(name, "-linktarget.sql"):
+    return dumpLinkTargets, nil
+  case strings.Contains(name, "-pagelinks.sql"):
+    return dumpPageLinks, nil
+  }
+  return 0, fmt.Errorf("unknown dump file: %s", path)
+}
+
+// Kinds of titles seen while importing
+const (
+  titleUnknown = iota
+  titleArticle
+  titleRedirect
+)
+
+// importer collects the pages, redirects and links of dumps. Titles are
+// interned to keep the links small
+type importer struct {
+  namespaces map[int]bool
+  names map[int]string
+  ids map[string]uint32
+  titles []string
+  kinds []byte
+  redirects map[uint32]uint32
+  edges [][2]uint32
+
+  // page_id -> title, for SQL dumps
+  pageIDs map[uint32]uint32
+  // lt_id -> title, for SQL dumps
+  targetIDs map[uint32]uint32
+}
+
+func newImporter(namespaces string) (*importer, error) {
+  im := &importer{
+    namespaces: map[int]bool{},
+    names: map[int]string{},
+    ids: map[string]uint32{},
+    redirects: map[uint32]uint32{},
+    pageIDs: map[uint32]uint32{},
+    targetIDs: map[uint32]uint32{},
+  }
+  for ns, name := range namespaceNames {
+    im.names[ns] = name
+  }
+  for _, ns := range strings.Split(namespaces, "|") {
+    n, err := strconv.Atoi(strings.TrimSpace(ns))
+    if err != nil {
+      return nil, fmt.Errorf("invalid namespace: %q", ns)
+    }
+    im.namespaces[n] = true
+  }
+  return im, nil
+}
+
+// intern returns the id of title, adding it if it's new
+func (im *importer) intern(title string) uint32 {
+  if id, ok := im.ids[title]; ok {
+    return id
+  }
+  id := uint32(len(im.titles))
+  im.ids[title] = id
+  im.titles = append(im.titles, title)
+  im.kinds = append(im.kinds, titleUnknown)
+  return id
+}
+
+// title returns the display title of a page in namespace ns, as the API
+// reports it
+func (im *importer) title(ns int, title string) string {
+  title = strings.ReplaceAll(title, "_", " ")
+  if name := im.names[ns]; len(name) > 0 {
+    return name + ":" + title
+  }
+  return title
+}
+
+func (im *importer) importFile(path string) error {
+  f, err := os.Open(path)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  var r io.Reader = f
+  switch filepath.Ext(path) {
+  case ".gz":
+    gz, err := gzip.NewReader(f)
+    if err != nil {
+      return err
+    }
+    defer gz.Close()
+    r = gz
+  case ".bz2":
+    r = bzip2.NewReader(f)
+  }
+
+  if strings.Contains(filepath.Base(path), ".xml") {
+    return im.readXML(r)
+  }
+  return readSQL(r, im.row)
+}
+
+// row adds a row of one of the SQL tables
+func (im *importer) row(table string, columns map[string]int, values []string) error {
+  value := func(column string) (string, error) {
+    i, ok := columns[column]
+    if !ok || i >= len(values) {
+      return "", fmt.Errorf("table %s has no column %s", table, column)
+    }
+    return values[i], nil
+  }
+  number := func(column string) (int, error) {
+    v, err := value(column)
+    if err != nil {
+      return 0, err
+    }
+    return strconv.Atoi(v)
+  }
+  // A namespace and title pair, returning false for other namespaces
+  page := func(nsColumn, titleColumn string) (uint32, bool, error) {
+    ns, err := number(nsColumn)
+    if err != nil {
+      return 0, false, err
+    }
+    title, err := value(titleColumn)
+    if err != nil || !im.namespaces[ns] {
+      return 0, false, err
+    }
+    return im.intern(im.title(ns, title)), true, nil
+  }
+
+  switch table {
+  case "page":
+    id, err := number("page_id")
+    if err != nil {
+      return err
+    }
+    title, ok, err := page("page_namespace", "page_title")
+    if err != nil || !ok {
+      return err
+    }
+    isRedirect, err := value("page_is_redirect")
+    if err != nil {
+      return err
+    }
+    im.pageIDs[uint32(id)] = title
+    im.kinds[title] = titleArticle
+    if isRedirect == "1" {
+      im.kinds[title] = titleRedirect
+    }
+
+  case "redirect":
+    from, err := number("rd_from")
+    if err != nil {
+      return err
+    }
+    alias, ok := im.pageIDs[uint32(from)]
+    if interwiki, _ := value("rd_interwiki"); !ok || len(interwiki) > 0 {
+      return nil
+    }
+    title, ok, err := page("rd_namespace", "rd_title")
+    if err != nil || !ok {
+      return err
+    }
+    im.redirects[alias] = title
+
+  case "linktarget":
+    id, err := number("lt_id")
+    if err != nil {
+      return err
+    }
+    title, ok, err := page("lt_namespace", "lt_title")
+    if err != nil || !ok {
+      return err
+    }
+    im.targetIDs[uint32(id)] = title
+
+  case "pagelinks":
+    from, err := number("pl_from")
+    if err != nil {
+      return err
+    }
+    fromTitle, ok := im.pageIDs[uint32(from)]
+    if !ok {
+      return nil
+    }
+    // Newer dumps point at the linktarget table instead of naming the page
+    if _, ok := columns["pl_target_id"]; ok {
+      target, err := number("pl_target_id")
+      if err != nil {
+        return err
+      }
+      if to, ok := im.targetIDs[uint32(target)]; ok {
+        im.edges = append(im.edges, [2]uint32{fromTitle, to})
+      }
+      return nil
+    }
+    to, ok, err := page("pl_namespace", "pl_title")
+    if err != nil || !ok {
+      return err
+    }
+    im.edges = append(im.edges, [2]uint32{fromTitle, to})
+  }
+  return nil
+}
+
+// xmlPage is a <page> of a pages-articles dump
+type xmlPage struct {
+  Title string `xml:"title"`
+  NS int `xml:"ns"`
+  Redirect struct {
+    Title string `xml:"title,attr"`
+  } `xml:"redirect"`
+  Text string `xml:"revision>text"`
+}
+
+// readXML adds the pages of a pages-articles dump, extracting links from
+// their wikitext
+func (im *importer) readXML(r io.Reader) error {
+  d := xml.NewDecoder(r)
+  for {
+    token, err := d.Token()
+    if err == io.EOF {
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+    start, ok := token.(xml.StartElement)
+    if !ok {
+      continue
+    }
+
+    switch start.Name.Local {
+    case "namespace":
+      var name string
+      if err := d.DecodeElement(&name, &start); err != nil {
+        return err
+      }
+      for _, attr := range start.Attr {
+        if attr.Name.Local == "key" {
+          if key, err := strconv.Atoi(attr.Value); err == nil {
+            im.names[key] = name
+          }
+        }
+      }
+
+    case "page":
+      page := xmlPage{}
+      if err := d.DecodeElement(&page, &start); err != nil {
+        return err
+      }
+      if !im.namespaces[page.NS] {
+        continue
+      }
+      title := im.intern(page.Title)
+      if len(page.Redirect.Title) > 0 {
+        im.kinds[title] = titleRedirect
+        im.redirects[title] = im.intern(im.linkTitle(page.Redirect.Title, true))
+        continue
+      }
+      im.kinds[title] = titleArticle
+      for _, match := range wikiLinkRegexp.FindAllStringSubmatch(page.Text, -1) {
+        if to := im.linkTitle(match[1], false); len(to) > 0 {
+          im.edges = append(im.edges, [2]uint32{title, im.intern(to)})
+        }
+      }
+    }
+  }
+}
+
+// linkTitle returns the title a wiki link points at, or "" for links that
+// categorize or embed the page instead
+func (im *importer) linkTitle(target string, redirect bool) string {
+  title, _ := wikilinkTitle(target, im.names, nil, redirect)
+  return title
+}
+
+// wikilinkTitle returns the title the target of a wiki link points at and its
+// namespace, given the names of the wiki's namespaces by number and any other
+// names they go by, or "" for links that categorize or embed the page
+// instead. Those of redirects always point at it
+func wikilinkTitle(target string, names map[int]string, numbers map[string]int, redirect bool) (string, int) {
+  if i := strings.Index(target, "#"); i >= 0 {
+    target = target[:i]
+  }
+  target = strings.TrimSpace(strings.ReplaceAll(target, "_", " "))
+  colon := strings.HasPrefix(target, ":")
+  target = strings.TrimSpace(strings.TrimPrefix(target, ":"))
+  if len(target) == 0 {
+    return "", 0
+  }
+
+  if i := strings.Index(target, ":"); i > 0 {
+    prefix := upperFirst(strings.TrimSpace(target[:i]))
+    ns, ok := numbers[prefix]
+    for n, name := range names {
+      if !ok && len(name) > 0 && name == prefix {
+        ns, ok = n, true
+      }
+    }
+    if ok && len(names[ns]) > 0 {
+      // [[Media:X]] links to a file, [[Category:X]] and [[File:X]] aren't
+      // links unless they start with a colon
+      if ns == -2 || (ns == 6 || ns == 14) && !colon && !redirect {
+        return "", 0
+      }
+      return names[ns] + ":" + upperFirst(strings.TrimSpace(target[i+1:])), ns
+    }
+  }
+  return upperFirst(target), 0
+}
+
+// upperFirst capitalizes the first letter, as MediaWiki does with titles
+func upperFirst(s string) string {
+  for i := range s {
+    if i > 0 {
+      return strings.ToUpper(s[:i]) + s[i:]
+    }
+  }
+  return strings.ToUpper(s)
+}
+
+// resolve follows redirects from title to the article it ends at
+func (im *importer) resolve(title uint32) (uint32, bool) {
+  for hops := 0; hops < 5; hops++ {
+    if im.kinds[title] == titleArticle {
+      return title, true
+    }
+    next, ok := im.redirects[title]
+    if !ok {
+      return 0, false
+    }
+    title = next
+  }
+  return 0, false
+}
+
+// graph numbers the articles by title and indexes the links between them in
+// both directions. Links to redirects point at their target, links to pages
+// that don't exist are dropped
+func (im *importer) graph() *Graph {
+  articles := []uint32{}
+  for id, kind := range im.kinds {
+    if kind == titleArticle {
+      articles = append(articles, uint32(id))
+    }
+  }
+  sort.Slice(articles, func(i, j int) bool { return im.titles[articles[i]] < im.titles[articles[j]] })
+
+  g := &Graph{titles: make([]string, len(articles)), aliases: map[string]uint32{}}
+  dense := make([]int64, len(im.titles))
+  for i := range dense {
+    dense[i] = -1
+  }
+  for i, id := range articles {
+    g.titles[i] = im.titles[id]
+    dense[id] = int64(i)
+  }
+
+  for id, kind := range im.kinds {
+    if kind != titleRedirect {
+      continue
+    }
+    if target, ok := im.resolve(uint32(id)); ok {
+      g.aliases[im.titles[id]] = uint32(dense[target])
+    }
+  }
+
+  isBoring := make([]bool, len(g.titles))
+  for i, title := range g.titles {
+    isBoring[i] = DefaultFilter.Boring(titleNamespace(title), title)
+  }
+
+  edges := [][2]uint32{}
+  for _, edge := range im.edges {
+    from := dense[edge[0]]
+    to, ok := im.resolve(edge[1])
+    if from < 0 || !ok || from == dense[to] || isBoring[from] || isBoring[dense[to]] {
+      continue
+    }
+    edges = append(edges, [2]uint32{uint32(from), uint32(dense[to])})
+  }
+  im.edges = nil
+
+  g.from = newAdjacency(len(g.titles), edges, 0)
+  g.here = newAdjacency(len(g.titles), edges, 1)
+  return g
+}
+
+// readSQL calls row for every row inserted by a mysqldump file, along with
+// the position of each column from its CREATE TABLE statement
+func readSQL(r io.Reader, row func(table string, columns map[string]int, values []string) error) error {
+  br := bufio.NewReaderSize(r, 1<<20)
+  tables := map[string]map[string]int{}
+  creating := ""
+
+  for {
+    line, err := br.ReadString('\n')
+    if len(line) > 0 {
+      switch {
+      case strings.HasPrefix(line, "CREATE TABLE `"):
+        creating = strings.SplitN(line[len("CREATE TABLE `"):], "`", 2)[0]
+        tables[creating] = map[string]int{}
+      case len(creating) > 0 && strings.HasPrefix(strings.TrimSpace(line), "`"):
+        column := strings.SplitN(strings.TrimSpace(line)[1:], "`", 2)[0]
+        tables[creating][column] = len(tables[creating])
+      case len(creating) > 0 && strings.HasPrefix(line, ")"):
+        creating = ""
+      case strings.HasPrefix(line, "INSERT INTO `"):
+        table := strings.SplitN(line[len("INSERT INTO `"):], "`", 2)[0]
+        values := strings.Index(line, " VALUES ")
+        if values < 0 {
+          return fmt.Errorf("malformed INSERT into %s", table)
+        }
+        columns, ok := tables[table]
+        if !ok {
+          return fmt.Errorf("INSERT into %s before CREATE TABLE", table)
+        }
+        err := parseValues(line[values+len(" VALUES "):], func(values []string) error {
+          return row(table, columns, values)
+        })
+        if err != nil {
+          return err
+        }
+      }
+    }
+    if err == io.EOF {
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+  }
+}
+
+// parseValues calls row for each of the (tuples) of an INSERT statement.
+// NULL is passed as ""
+func parseValues(s string, row func([]string) error) error {
+  for i := 0; i < len(s); {
+    // Skip the commas, whitespace and semicolon between tuples
+    if s[i] != '(' {
+      i++
+      continue
+    }
+    i++
+
+    values := []string{}
+    for {
+      if i >= len(s) {
+        return fmt.Errorf("truncated INSERT values")
+      }
+      var value string
+      if s[i] == '\'' {
+        var err error
+        value, i, err = parseString(s, i+1)
+        if err != nil {
+          return err
+        }
+      } else {
+        j := i
+        for j < len(s) && s[j] != ',' && s[j] != ')' {
+          j++
+        }
+        value = s[i:j]
+        if value == "NULL" {
+          value = ""
+        }
+        i = j
+      }
+      values = append(values, value)
+
+      if i >= len(s) {
+        return fmt.Errorf("truncated INSERT values")
+      }
+      i++
+      if s[i-1] == ')' {
+        break
+      }
+    }
+    if err := row(values); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// parseString unescapes the quoted string starting at s[i], returning it and
+// the position after its closing quote
+func parseString(s string, i int) (string, int, error) {
+  var b strings.Builder
+  for i < len(s) {
+    c := s[i]
+    switch {
+    case c == '\\' && i+1 < len(s):
+      i++
+      switch s[i] {
+      case '0':
+        b.WriteByte(0)
+      case 'n':
+        b.WriteByte('\n')
+      case 'r':
+        b.WriteByte('\r')
+      case 't':
+        b.WriteByte('\t')
+      case 'Z':
+        b.WriteByte(0x1a)
+      default:
+        b.WriteByte(s[i])
+      }
+    case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+      b.WriteByte('\'')
+      i++
+    case c == '\'':
+      return b.String(), i + 1, nil
+    default:
+      b.WriteByte(c)
+    }
+    i++
+  }
+  return "", i, fmt.Errorf("unterminated string in INSERT values")
+}
@@ -0,0 +1,178 @@
+package links
+
+import (
+  "compress/gzip"
+  "context"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "reflect"
+  "testing"
+)
+
+// Links every import of testdata/dump should end up with
+var dumpLinks = Links{
+  "Ada Lovelace":      {"Charles Babbage"},
+  "Charles Babbage":   {"Analytical Engine"},
+  "Analytical Engine": {"Computer"},
+  "Computer":          {"Alan Turing"},
+  "Alan Turing":       {"Category:Computing"},
+}
+
+func dumpFiles(names ...string) []string {
+  paths := []string{}
+  for _, name := range names {
+    paths = append(paths, filepath.Join("testdata", "dump", name))
+  }
+  return paths
+}
+
+// checkDumpGraph checks g has dumpLinks and races across it
+func checkDumpGraph(t *testing.T, g *Graph) {
+  t.Helper()
+  for from, expected := range dumpLinks {
+    resp := <-g.LinksFrom(context.Background(), []string{from})
+    if !reflect.DeepEqual(expected, resp.Links[from]) {
+      t.Errorf("expected links from %s: %#v\ngot: %#v", from, expected, resp.Links[from])
+    }
+  }
+
+  resp := <-g.LinksHere(context.Background(), []string{"Charles Babbage"})
+  if !reflect.DeepEqual([]string{"Ada Lovelace"}, resp.Links["Charles Babbage"]) {
+    t.Errorf("unexpected links to Charles Babbage: %#v", resp.Links)
+  }
+
+  resp = g.Find(context.Background(), []string{"Babbage", "Red link", "User:Someone"})
+  if !reflect.DeepEqual(map[string]string{"Babbage": "Charles Babbage"}, resp.Redirects) {
+    t.Errorf("unexpected redirects: %#v", resp.Redirects)
+  }
+  if !reflect.DeepEqual([]string{"Red link", "User:Someone"}, resp.Missing) {
+    t.Errorf("unexpected missing pages: %#v", resp.Missing)
+  }
+
+  pg := NewPageGraph(g)
+  path, err := pg.Search("Ada Lovelace", "Category:Computing")
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := []string{"Ada Lovelace", "Charles Babbage", "Analytical Engine", "Computer", "Alan Turing", "Category:Computing"}
+  if !reflect.DeepEqual(expected, path) {
+    t.Errorf("expected: %#v\ngot: %#v", expected, path)
+  }
+}
+
+func TestImportDump_SQL(t *testing.T) {
+  g, err := ImportDump(dumpFiles("testwiki-pagelinks.sql", "testwiki-redirect.sql", "testwiki-page.sql"), "0|14|100")
+  if err != nil {
+    t.Fatal(err)
+  }
+  checkDumpGraph(t, g)
+
+  // Escaped titles
+  resp := <-g.LinksFrom(context.Background(), []string{"O'Brien (1,2)"})
+  if !reflect.DeepEqual(Links{"O'Brien (1,2)": {"Ada Lovelace"}}, resp.Links) {
+    t.Errorf("unexpected links: %#v", resp.Links)
+  }
+  if stats := g.Stats(); stats != (GraphStats{Pages: 8, Links: 6, Redirects: 1}) {
+    t.Errorf("unexpected stats: %#v", stats)
+  }
+}
+
+func TestImportDump_LinkTarget(t *testing.T) {
+  g, err := ImportDump(dumpFiles("testwiki-page.sql", "testwiki-redirect.sql", "newwiki-linktarget.sql", "newwiki-pagelinks.sql"), "0|14|100")
+  if err != nil {
+    t.Fatal(err)
+  }
+  checkDumpGraph(t, g)
+}
+
+func TestImportDump_XML(t *testing.T) {
+  g, err := ImportDump(dumpFiles("testwiki-pages-articles.xml"), "0|14|100")
+  if err != nil {
+    t.Fatal(err)
+  }
+  checkDumpGraph(t, g)
+  if stats := g.Stats(); stats != (GraphStats{Pages: 7, Links: 5, Redirects: 1}) {
+    t.Errorf("unexpected stats: %#v", stats)
+  }
+}
+
+func TestImportDump_Gzip(t *testing.T) {
+  dir, err := ioutil.TempDir("", "wikiracer-dump")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  paths := []string{}
+  for _, path := range dumpFiles("testwiki-page.sql", "testwiki-redirect.sql", "testwiki-pagelinks.sql") {
+    gzipped := filepath.Join(dir, filepath.Base(path)+".gz")
+    in, err := os.Open(path)
+    if err != nil {
+      t.Fatal(err)
+    }
+    out, err := os.Create(gzipped)
+    if err != nil {
+      t.Fatal(err)
+    }
+    gz := gzip.NewWriter(out)
+    io.Copy(gz, in)
+    gz.Close()
+    out.Close()
+    in.Close()
+    paths = append(paths, gzipped)
+  }
+
+  g, err := ImportDump(paths, "0|14|100")
+  if err != nil {
+    t.Fatal(err)
+  }
+  checkDumpGraph(t, g)
+
+  // Saved graphs load back the same
+  path := filepath.Join(dir, "graph.db")
+  if err := g.Save(path); err != nil {
+    t.Fatal(err)
+  }
+  loaded, err := LoadGraph(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(g, loaded) {
+    t.Errorf("expected: %#v\ngot: %#v", g, loaded)
+  }
+  checkDumpGraph(t, loaded)
+
+  if _, err := LoadGraph(paths[0]); err == nil {
+    t.Error("expected an error loading a dump as a graph")
+  }
+}
+
+func TestImportDump_Errors(t *testing.T) {
+  if _, err := ImportDump(dumpFiles("unknown.sql"), "0"); err == nil {
+    t.Error("expected an error for an unknown dump file")
+  }
+  if _, err := ImportDump(dumpFiles("testwiki-page.sql"), "main"); err == nil {
+    t.Error("expected an error for an invalid namespace")
+  }
+}
+
+func TestParseValues(t *testing.T) {
+  rows := [][]string{}
+  err := parseValues(`(1,'a,b',NULL),(2,'it\'s ''quoted'' \\ (x)',-3.5);`, func(values []string) error {
+    rows = append(rows, values)
+    return nil
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := [][]string{{"1", "a,b", ""}, {"2", `it's 'quoted' \ (x)`, "-3.5"}}
+  if !reflect.DeepEqual(expected, rows) {
+    t.Errorf("expected: %#v\ngot: %#v", expected, rows)
+  }
+
+  if err := parseValues(`(1,'unterminated`, func([]string) error { return nil }); err == nil {
+    t.Error("expected an error for an unterminated string")
+  }
+}
@@ -0,0 +1,71 @@
+package links
+
+import (
+  "errors"
+  "fmt"
+  "strings"
+)
+
+var (
+  // ErrNoPath is returned when both search directions run out of pages
+  // without meeting
+  ErrNoPath = errors.New("no path found")
+
+  // ErrPageMissing is returned when the start or end page does not exist
+  ErrPageMissing = errors.New("page does not exist")
+
+  // ErrRateLimited is returned when the API asks us to slow down
+  ErrRateLimited = errors.New("rate limited by the API")
+
+  // ErrLimitExceeded is returned when a search goes over its SearchOptions
+  ErrLimitExceeded = errors.New("search limit exceeded")
+)
+
+// ErrAPI is an error reported by the MediaWiki API itself, see
+// https://www.mediawiki.org/wiki/API:Errors_and_warnings
+type ErrAPI struct {
+  Code string
+  Info string
+}
+
+func (e *ErrAPI) Error() string {
+  return fmt.Sprintf("API error %s: %s", e.Code, e.Info)
+}
+
+// PageNotFoundError is returned when the start or end page does not exist,
+// along with existing titles the user may have meant
+type PageNotFoundError struct {
+  Title string
+  Suggestions []string
+}
+
+func (e *PageNotFoundError) Error() string {
+  if len(e.Suggestions) == 0 {
+    return fmt.Sprintf("%s: %s", ErrPageMissing, e.Title)
+  }
+  return fmt.Sprintf("%s: %s (did you mean %s?)", ErrPageMissing, e.Title, strings.Join(e.Suggestions, ", "))
+}
+
+// Unwrap makes a PageNotFoundError match ErrPageMissing
+func (e *PageNotFoundError) Unwrap() error {
+  return ErrPageMissing
+}
+
+// LimitError is returned when a search reaches one of its SearchOptions
+// before finding a path, along with how far each direction got
+type LimitError struct {
+  // Limit reached, LimitDepth, LimitPages, LimitRequests or LimitTimeout
+  Limit string `json:"limit"`
+  Forward FrontierStats `json:"forward"`
+  Backward FrontierStats `json:"backward"`
+}
+
+func (e *LimitError) Error() string {
+  return fmt.Sprintf("%s: %s (forward reached %d pages at depth %d, backward %d pages at depth %d)",
+    ErrLimitExceeded, e.Limit, e.Forward.Pages, e.Forward.Depth, e.Backward.Pages, e.Backward.Depth)
+}
+
+// Unwrap makes a LimitError match ErrLimitExceeded
+func (e *LimitError) Unwrap() error {
+  return ErrLimitExceeded
+}
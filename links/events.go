@@ -0,0 +1,61 @@
+package links
+
+import "time"
+
+// Types of search events
+const (
+  // A direction starts requesting the links of its frontier
+  EventExpanded = "expanded"
+  // A Response worth of links arrived
+  EventFetched = "fetched"
+  // A page was reached for the first time
+  EventDiscovered = "discovered"
+  // The two directions met
+  EventMidpoint = "midpoint"
+)
+
+// Directions of the search, as reported by events
+const (
+  Forward = "forward"
+  Backward = "backward"
+)
+
+// Event is something that happened during a search
+type Event struct {
+  Type string `json:"type"`
+  Direction string `json:"direction,omitempty"`
+  // Distance in links from the page the direction started at
+  Depth int `json:"depth"`
+  // Page discovered, and the page it was reached from, or the midpoint
+  Title string `json:"title,omitempty"`
+  Parent string `json:"parent,omitempty"`
+  // Size of the frontier expanded, or of the pages whose links were fetched
+  Pages int `json:"pages,omitempty"`
+  // Number of links fetched
+  Links int `json:"links,omitempty"`
+  // Path found, for the midpoint
+  Path []string `json:"path,omitempty"`
+  Time time.Time `json:"time"`
+}
+
+// Observer is called with every event of a search, in order, from the
+// goroutine running it. Searches running at once on the same graph call it
+// concurrently. It must not block
+type Observer func(Event)
+
+// Observe makes the graph report the events of its searches to observer
+func (pg *PageGraph) Observe(observer Observer) {
+  pg.mu.Lock()
+  defer pg.mu.Unlock()
+  pg.observer = observer
+}
+
+func (pg *PageGraph) emit(event Event) {
+  pg.mu.Lock()
+  observer := pg.observer
+  pg.mu.Unlock()
+  if observer != nil {
+    event.Time = time.Now()
+    observer(event)
+  }
+}
@@ -0,0 +1,56 @@
+package links
+
+import (
+  "fmt"
+  "reflect"
+  "sync"
+  "testing"
+)
+
+func TestPageGraph_Observe(t *testing.T) {
+  g := NewMemoryGraph(chain(Links{}, "Page", 7))
+
+  var mu sync.Mutex
+  events := []Event{}
+  pg := NewPageGraph(g)
+  pg.Observe(func(event Event) {
+    mu.Lock()
+    defer mu.Unlock()
+    events = append(events, event)
+  })
+
+  path, err := pg.Search("Page0", "Page6")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  mu.Lock()
+  defer mu.Unlock()
+  counts := map[string]int{}
+  for _, event := range events {
+    counts[event.Type]++
+    if event.Time.IsZero() {
+      t.Errorf("event without time: %#v", event)
+    }
+    switch event.Type {
+    case EventDiscovered:
+      // Pages are discovered at their distance from where their direction started
+      var n int
+      fmt.Sscanf(event.Title, "Page%d", &n)
+      if (event.Direction == Forward && event.Depth != n) || (event.Direction == Backward && event.Depth != 6-n) {
+        t.Errorf("unexpected depth: %#v", event)
+      }
+    case EventExpanded:
+      if event.Direction != Forward && event.Direction != Backward {
+        t.Errorf("unexpected direction: %#v", event)
+      }
+    case EventMidpoint:
+      if !reflect.DeepEqual(path, event.Path) {
+        t.Errorf("expected midpoint path %#v, got %#v", path, event.Path)
+      }
+    }
+  }
+
+  if counts[EventMidpoint] != 1 || counts[EventExpanded] < 2 || counts[EventFetched] < 2 || counts[EventDiscovered] < 5 {
+    t.Errorf("unexpected events: %#v", counts)
+  }}
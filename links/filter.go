@@ -0,0 +1,283 @@
+package links
+
+import (
+  "bufio"
+  "crypto/sha1"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+var (
+  // DefaultFilter drops the links of Wikipedia's navigation and citation
+  // boilerplate, see boring_regex
+  DefaultFilter = mustFilter(FilterRules{Defaults: true})
+  // NoFilter drops no link at all, for pure races
+  NoFilter = mustFilter(FilterRules{})
+)
+
+// Namespaces by the prefix of their titles on English Wikipedia, see
+// https://en.wikipedia.org/wiki/Wikipedia:Namespace
+var titleNamespaces = map[string]int{
+  "Talk": 1,
+  "User": 2,
+  "User talk": 3,
+  "Wikipedia": 4,
+  "Wikipedia talk": 5,
+  "File": 6,
+  "File talk": 7,
+  "MediaWiki": 8,
+  "MediaWiki talk": 9,
+  "Template": 10,
+  "Template talk": 11,
+  "Help": 12,
+  "Help talk": 13,
+  "Category": 14,
+  "Category talk": 15,
+  "Portal": 100,
+  "Portal talk": 101,
+  "Draft": 118,
+  "Draft talk": 119,
+  "Module": 828,
+  "Module talk": 829,
+}
+
+// titleNamespace guesses the namespace of an English Wikipedia title from its
+// prefix, for sources that only know titles. Titles without a known prefix
+// are articles
+func titleNamespace(title string) int {
+  if i := strings.Index(title, ":"); i > 0 {
+    if ns, ok := titleNamespaces[title[:i]]; ok {
+      return ns
+    }
+  }
+  return 0
+}
+
+// FilterRules describe the links a Filter drops, as read from a JSON filter
+// file
+type FilterRules struct {
+  // Start from the built-in patterns of DefaultFilter
+  Defaults bool `json:"defaults"`
+  // Patterns of boring titles
+  Exclude []string `json:"exclude"`
+  // Patterns of titles kept even if they match Exclude
+  Include []string `json:"include"`
+  // Namespaces whose pages are boring
+  ExcludeNamespaces []int `json:"exclude_namespaces"`
+  // Rules added for a particular wiki, by the host name of its API, eg.
+  // "de.wikipedia.org"
+  Wikis map[string]FilterRules `json:"wikis,omitempty"`
+}
+
+// Filter decides which links are boring and dropped from races: those from or
+// to a page whose title matches an exclude pattern and no include pattern, or
+// that is in an excluded namespace. Patterns are compiled once, the zero value
+// drops nothing
+type Filter struct {
+  // Kept apart, as Go matches a few dozen patterns one after the other much
+  // faster than their alternation
+  exclude []*regexp.Regexp
+  include []*regexp.Regexp
+  namespaces map[int]bool
+  // Filters of particular wikis, by API host name
+  wikis map[string]*Filter
+  // Hash of the rules, so links cached under one filter aren't used with
+  // another
+  id string
+}
+
+// NewFilter compiles rules into a Filter
+func NewFilter(rules FilterRules) (*Filter, error) {
+  f, err := compileFilter(rules)
+  if err != nil {
+    return nil, err
+  }
+  for wiki, wikiRules := range rules.Wikis {
+    if len(wikiRules.Wikis) > 0 {
+      return nil, fmt.Errorf("wiki %s: rules can't be nested", wiki)
+    }
+    // A wiki gets the general rules along with its own
+    merged := wikiRules
+    merged.Defaults = rules.Defaults || wikiRules.Defaults
+    merged.Exclude = append(append([]string{}, rules.Exclude...), wikiRules.Exclude...)
+    merged.Include = append(append([]string{}, rules.Include...), wikiRules.Include...)
+    merged.ExcludeNamespaces = append(append([]int{}, rules.ExcludeNamespaces...), wikiRules.ExcludeNamespaces...)
+    wf, err := compileFilter(merged)
+    if err != nil {
+      return nil, fmt.Errorf("wiki %s: %w", wiki, err)
+    }
+    if f.wikis == nil {
+      f.wikis = map[string]*Filter{}
+    }
+    f.wikis[wiki] = wf
+  }
+  return f, nil
+}
+
+func compileFilter(rules FilterRules) (*Filter, error) {
+  exclude := rules.Exclude
+  if rules.Defaults {
+    exclude = append(append([]string{}, boring_regex...), exclude...)
+  }
+  f := &Filter{namespaces: map[int]bool{}}
+  var err error
+  if f.exclude, err = compilePatterns(exclude); err != nil {
+    return nil, err
+  }
+  if f.include, err = compilePatterns(rules.Include); err != nil {
+    return nil, err
+  }
+  for _, ns := range rules.ExcludeNamespaces {
+    f.namespaces[ns] = true
+  }
+
+  // Wiki specific rules are hashed with their own filter
+  rules.Exclude, rules.Defaults, rules.Wikis = exclude, false, nil
+  data, _ := json.Marshal(rules)
+  sum := sha1.Sum(data)
+  f.id = hex.EncodeToString(sum[:4])
+  return f, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+  compiled := []*regexp.Regexp{}
+  for _, pattern := range patterns {
+    re, err := regexp.Compile(pattern)
+    if err != nil {
+      return nil, err
+    }
+    compiled = append(compiled, re)
+  }
+  return compiled, nil
+}
+
+// matchAny reports whether title matches any of patterns
+func matchAny(patterns []*regexp.Regexp, title string) bool {
+  for _, re := range patterns {
+    if re.MatchString(title) {
+      return true
+    }
+  }
+  return false
+}
+
+func mustFilter(rules FilterRules) *Filter {
+  f, err := NewFilter(rules)
+  if err != nil {
+    panic(err)
+  }
+  return f
+}
+
+// Boring reports whether links from or to the page titled title, in
+// namespace ns, are dropped
+func (f *Filter) Boring(ns int, title string) bool {
+  if f == nil {
+    return false
+  }
+  if f.namespaces[ns] {
+    return true
+  }
+  return matchAny(f.exclude, title) && !matchAny(f.include, title)
+}
+
+// Wiki returns the filter of the wiki whose API is served by host
+func (f *Filter) Wiki(host string) *Filter {
+  if wf, ok := f.wikis[host]; ok {
+    return wf
+  }
+  return f
+}
+
+// LoadFilter reads the rules of a Filter from path, a JSON document of
+// FilterRules if it ends in .json, plain text otherwise. See ParseFilterRules
+func LoadFilter(path string) (*Filter, error) {
+  file, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  var rules FilterRules
+  switch strings.ToLower(filepath.Ext(path)) {
+  case ".json":
+    err = json.NewDecoder(file).Decode(&rules)
+  case ".yaml", ".yml":
+    // JSON is all the structured input we read without dependencies
+    return nil, fmt.Errorf("%s: YAML filters are not supported, use JSON or plain text", path)
+  default:
+    rules, err = ParseFilterRules(file)
+  }
+  if err != nil {
+    return nil, fmt.Errorf("%s: %w", path, err)
+  }
+  return NewFilter(rules)
+}
+
+// ParseFilterRules reads filter rules written as plain text, one per line:
+//
+//   # Comments and blank lines are skipped
+//   defaults               start from the patterns of DefaultFilter
+//   exclude ^ISBN          drop links from or to titles matching a pattern
+//   include ^ISBN \(band\) but keep those matching this one
+//   exclude-namespace 10   drop links from or to pages in a namespace
+//   [de.wikipedia.org]     rules after this only apply to the wiki whose API
+//                          is served by this host
+func ParseFilterRules(r io.Reader) (FilterRules, error) {
+  rules := FilterRules{}
+  current := &rules
+  wikis := map[string]*FilterRules{}
+  scanner := bufio.NewScanner(r)
+  for n := 1; scanner.Scan(); n++ {
+    line := strings.TrimSpace(scanner.Text())
+    if len(line) == 0 || strings.HasPrefix(line, "#") {
+      continue
+    }
+    if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+      wiki := strings.TrimSpace(line[1:len(line)-1])
+      if _, ok := wikis[wiki]; !ok {
+        wikis[wiki] = &FilterRules{}
+      }
+      current = wikis[wiki]
+      continue
+    }
+
+    directive, arg := line, ""
+    if i := strings.IndexAny(line, " \t"); i > 0 {
+      directive, arg = line[:i], strings.TrimSpace(line[i+1:])
+    }
+    switch {
+    case directive == "defaults" && len(arg) == 0:
+      current.Defaults = true
+    case directive == "exclude" && len(arg) > 0:
+      current.Exclude = append(current.Exclude, arg)
+    case directive == "include" && len(arg) > 0:
+      current.Include = append(current.Include, arg)
+    case directive == "exclude-namespace" && len(arg) > 0:
+      ns, err := strconv.Atoi(arg)
+      if err != nil {
+        return FilterRules{}, fmt.Errorf("line %d: invalid namespace: %s", n, arg)
+      }
+      current.ExcludeNamespaces = append(current.ExcludeNamespaces, ns)
+    default:
+      return FilterRules{}, fmt.Errorf("line %d: invalid rule: %s", n, line)
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return FilterRules{}, err
+  }
+  for wiki, wikiRules := range wikis {
+    if rules.Wikis == nil {
+      rules.Wikis = map[string]FilterRules{}
+    }
+    rules.Wikis[wiki] = *wikiRules
+  }
+  return rules, nil
+}
@@ -0,0 +1,182 @@
+package links
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "reflect"
+  "regexp"
+  "strings"
+  "testing"
+)
+
+const filterText = `
+# Boring everywhere
+exclude ^List of
+include ^List of Wikipedians
+exclude-namespace 10
+
+[de.wikipedia.org]
+defaults
+exclude ^Normdaten
+`
+
+const filterJSON = `{
+  "exclude": ["^List of"],
+  "include": ["^List of Wikipedians"],
+  "exclude_namespaces": [10],
+  "wikis": {
+    "de.wikipedia.org": {"defaults": true, "exclude": ["^Normdaten"]}
+  }
+}`
+
+func TestFilter_Boring(t *testing.T) {
+  filter, err := NewFilter(FilterRules{Exclude: []string{"^List of"}, Include: []string{"^List of Wikipedians"}, ExcludeNamespaces: []int{10}})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  tests := []struct {
+    filter *Filter
+    ns     int
+    title  string
+    boring bool
+  }{
+    {DefaultFilter, 0, "ISBN (identifier)", true},
+    {DefaultFilter, 14, "Category:Articles needing cleanup", true},
+    {DefaultFilter, 0, "Ada Lovelace", false},
+    {NoFilter, 0, "ISBN (identifier)", false},
+    {nil, 0, "ISBN (identifier)", false},
+    {&Filter{}, 0, "ISBN (identifier)", false},
+    {filter, 0, "List of poets", true},
+    {filter, 0, "List of Wikipedians by edit count", false},
+    {filter, 10, "Template:Infobox", true},
+    {filter, 0, "ISBN (identifier)", false},
+  }
+  for i, test := range tests {
+    if boring := test.filter.Boring(test.ns, test.title); boring != test.boring {
+      t.Errorf("tests[%d]: expected %#v boring: %v, got %v", i, test.title, test.boring, boring)
+    }
+  }
+
+  if _, err := NewFilter(FilterRules{Exclude: []string{"("}}); err == nil {
+    t.Error("expected an invalid pattern to be rejected")
+  }
+}
+
+func TestParseFilterRules(t *testing.T) {
+  rules, err := ParseFilterRules(strings.NewReader(filterText))
+  if err != nil {
+    t.Fatal(err)
+  }
+  expect := FilterRules{
+    Exclude: []string{"^List of"},
+    Include: []string{"^List of Wikipedians"},
+    ExcludeNamespaces: []int{10},
+    Wikis: map[string]FilterRules{
+      "de.wikipedia.org": {Defaults: true, Exclude: []string{"^Normdaten"}},
+    },
+  }
+  if !reflect.DeepEqual(expect, rules) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, rules)
+  }
+
+  for _, text := range []string{"exclude", "boring ^ISBN", "exclude-namespace Template", "defaults ^ISBN"} {
+    if _, err := ParseFilterRules(strings.NewReader(text)); err == nil {
+      t.Errorf("expected %#v to be rejected", text)
+    }
+  }
+}
+
+func TestLoadFilter(t *testing.T) {
+  dir, err := ioutil.TempDir("", "wikiracer-filter")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  filters := []*Filter{}
+  for name, content := range map[string]string{"rules.txt": filterText, "rules.json": filterJSON} {
+    path := filepath.Join(dir, name)
+    if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+    filter, err := LoadFilter(path)
+    if err != nil {
+      t.Fatal(err)
+    }
+    filters = append(filters, filter)
+
+    // German Wikipedia gets the general rules along with its own
+    de := filter.Wiki("de.wikipedia.org")
+    if !de.Boring(0, "List of poets") || !de.Boring(0, "Normdaten") || !de.Boring(0, "ISBN (identifier)") {
+      t.Errorf("%s: expected the rules of de.wikipedia.org to drop every pattern", name)
+    }
+    if en := filter.Wiki("en.wikipedia.org"); en != filter || en.Boring(0, "Normdaten") {
+      t.Errorf("%s: expected other wikis to get the general rules", name)
+    }
+  }
+  if filters[0].id != filters[1].id || filters[0].Wiki("de.wikipedia.org").id != filters[1].Wiki("de.wikipedia.org").id {
+    t.Error("expected the same rules to hash the same in both formats")
+  }
+
+  path := filepath.Join(dir, "rules.yaml")
+  ioutil.WriteFile(path, []byte("exclude: []"), 0644)
+  if _, err := LoadFilter(path); err == nil {
+    t.Error("expected YAML to be rejected")
+  }
+}
+
+func TestMediaWiki_Filter(t *testing.T) {
+  // The only path goes through a boring page
+  graph := map[string][]string{
+    "Start":             {"ISBN (identifier)"},
+    "ISBN (identifier)": {"Target"},
+  }
+  server := fakeWiki(graph, nil)
+  defer server.Close()
+
+  if _, err := NewPageGraph(testWiki(Config{Endpoint: server.URL})).Search("Start", "Target"); err != ErrNoPath {
+    t.Errorf("expected no path through boring links, got %v", err)
+  }
+  config := Config{Endpoint: server.URL, Filter: NoFilter}
+  path, err := NewPageGraph(testWiki(config)).Search("Start", "Target")
+  if err != nil || len(path) != 3 {
+    t.Errorf("expected a path through boring links, got %#v, %v", path, err)
+  }
+
+  // Links cached under one filter aren't used with another
+  wikis := map[string]bool{}
+  for _, filter := range []*Filter{nil, DefaultFilter, NoFilter} {
+    wikis[Config{Endpoint: server.URL, Filter: filter}.Wiki()] = true
+  }
+  if len(wikis) != 2 {
+    t.Errorf("expected the default and no filter to key apart, got %#v", wikis)
+  }
+}
+
+var benchmarkTitles = []string{
+  "Ada Lovelace",
+  "ISBN (identifier)",
+  "Category:Articles needing additional references from May 2020",
+  "Analytical Engine",
+  "Charles Babbage",
+  "Doi (identifier)",
+  "Lord Byron",
+  "Category:Use dmy dates from March 2021",
+}
+
+func BenchmarkFilter_Boring(b *testing.B) {
+  for i := 0; i < b.N; i++ {
+    title := benchmarkTitles[i%len(benchmarkTitles)]
+    DefaultFilter.Boring(titleNamespace(title), title)
+  }
+}
+
+// What every link used to cost, compiling the patterns for each
+func BenchmarkFilter_CompilePerLink(b *testing.B) {
+  pattern := `(` + strings.Join(boring_regex, "|") + `)`
+  for i := 0; i < b.N; i++ {
+    regexp.MustCompile(pattern).MatchString(benchmarkTitles[i%len(benchmarkTitles)])
+  }
+}
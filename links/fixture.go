@@ -0,0 +1,242 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "io/ioutil"
+  "sync"
+)
+
+// Fixture is a LinkSource replaying previously recorded links, typically
+// loaded from a JSON file written by a Recorder. Pages that weren't recorded at
+// all are reported missing, pages whose links weren't recorded have none
+type Fixture struct {
+  // Page -> pages it links to
+  Outgoing Links `json:"links"`
+  // Page -> pages linking to it
+  Incoming Links `json:"linkshere"`
+  // Redirect or unnormalized title -> title it resolves to
+  Redirects map[string]string `json:"redirects,omitempty"`
+  // Pages known to exist without their links being recorded
+  Pages []string `json:"pages,omitempty"`
+  // Namespaces of the pages linked, if they were recorded
+  Namespaces map[string]int `json:"namespaces,omitempty"`
+}
+
+// LoadFixture reads a Fixture from a JSON file
+func LoadFixture(path string) (*Fixture, error) {
+  b, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, err
+  }
+  f := &Fixture{}
+  if err := json.Unmarshal(b, f); err != nil {
+    return nil, err
+  }
+  if f.Outgoing == nil {
+    f.Outgoing = Links{}
+  }
+  if f.Incoming == nil {
+    f.Incoming = Links{}
+  }
+  if f.Redirects == nil {
+    f.Redirects = map[string]string{}
+  }
+  if f.Namespaces == nil {
+    f.Namespaces = map[string]int{}
+  }
+  return f, nil
+}
+
+// Save writes the Fixture to a JSON file
+func (f *Fixture) Save(path string) error {
+  b, err := json.MarshalIndent(f, "", "  ")
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(path, b, 0644)
+}
+
+// LinksFrom replays the recorded links from titles as a single Response
+func (f *Fixture) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return respond(ctx, titles, f.Outgoing, f.Redirects, f.Namespaces, f.exists)
+}
+
+// LinksHere replays the recorded links to titles as a single Response
+func (f *Fixture) LinksHere(ctx context.Context, titles []string) chan Response {
+  return respond(ctx, titles, f.Incoming, f.Redirects, f.Namespaces, f.exists)
+}
+
+// Find reports which titles are missing and which redirect
+func (f *Fixture) Find(ctx context.Context, titles []string) Response {
+  return find(ctx, titles, f.Redirects, f.exists)
+}
+
+func (f *Fixture) exists(title string) bool {
+  _, from := f.Outgoing[title]
+  _, to := f.Incoming[title]
+  for _, page := range f.Pages {
+    if page == title {
+      return true
+    }
+  }
+  return from || to
+}
+
+// Suggest returns up to limit recorded titles containing title, ignoring case
+func (f *Fixture) Suggest(ctx context.Context, title string, limit int) ([]string, error) {
+  return suggest(title, limit, f.Outgoing, f.Incoming), nil
+}
+
+// Recorder is a LinkSource that passes through to Source, recording every
+// response it sees in Fixture
+type Recorder struct {
+  Source LinkSource
+  Fixture *Fixture
+  mu sync.Mutex
+  // Tracks responses still being recorded
+  wg sync.WaitGroup
+}
+
+// NewRecorder returns a Recorder with an empty Fixture
+func NewRecorder(source LinkSource) *Recorder {
+  return &Recorder{
+    Source: source,
+    Fixture: &Fixture{Outgoing: Links{}, Incoming: Links{}, Redirects: map[string]string{}, Namespaces: map[string]int{}},
+  }
+}
+
+// LinksFrom fetches and records the links from titles
+func (r *Recorder) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return r.record(ctx, titles, r.Fixture.Outgoing, r.Source.LinksFrom(ctx, titles))
+}
+
+// LinksHere fetches and records the links to titles
+func (r *Recorder) LinksHere(ctx context.Context, titles []string) chan Response {
+  return r.record(ctx, titles, r.Fixture.Incoming, r.Source.LinksHere(ctx, titles))
+}
+
+// Find passes through to Source if it is a Finder, recording the pages found
+func (r *Recorder) Find(ctx context.Context, titles []string) Response {
+  finder, ok := r.Source.(Finder)
+  if !ok {
+    return Response{}
+  }
+  resp := finder.Find(ctx, titles)
+  if resp.Err != nil {
+    return resp
+  }
+
+  missing := map[string]bool{}
+  for _, title := range resp.Missing {
+    missing[title] = true
+  }
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  for _, title := range titles {
+    if resolved, ok := resp.Redirects[title]; ok {
+      r.Fixture.Redirects[title] = resolved
+      title = resolved
+    }
+    if !missing[title] {
+      r.Fixture.Pages = append(r.Fixture.Pages, title)
+    }
+  }
+  return resp
+}
+
+// Suggest passes through to Source if it is a Finder
+func (r *Recorder) Suggest(ctx context.Context, title string, limit int) ([]string, error) {
+  if finder, ok := r.Source.(Finder); ok {
+    return finder.Suggest(ctx, title, limit)
+  }
+  return nil, nil
+}
+
+// Categories passes through to Source if it is a CategoryLister, without
+// recording them, and sends the recorded links otherwise
+func (r *Recorder) Categories(ctx context.Context, titles []string) chan Response {
+  if lister, ok := r.Source.(CategoryLister); ok {
+    return lister.Categories(ctx, titles)
+  }
+  return r.LinksFrom(ctx, titles)
+}
+
+// CountLinksHere passes through to Source if it is an InboundCounter,
+// without recording the counts, and counts the recorded links otherwise
+func (r *Recorder) CountLinksHere(ctx context.Context, titles []string) (map[string]int, FetchStats, error) {
+  if counter, ok := r.Source.(InboundCounter); ok {
+    return counter.CountLinksHere(ctx, titles)
+  }
+  return countLinksHere(ctx, r, titles)
+}
+
+// Requests passes through to Source if it counts its requests
+func (r *Recorder) Requests() int64 {
+  if counter, ok := r.Source.(RequestCounter); ok {
+    return counter.Requests()
+  }
+  return 0
+}
+
+// Save writes the recorded Fixture to a JSON file once all responses passed
+// through have been recorded
+func (r *Recorder) Save(path string) error {
+  r.wg.Wait()
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  return r.Fixture.Save(path)
+}
+
+func (r *Recorder) record(ctx context.Context, titles []string, into Links, in chan Response) chan Response {
+  c := make(chan Response)
+
+  r.wg.Add(1)
+  go func() {
+    defer r.wg.Done()
+    defer close(c)
+    missing := map[string]bool{}
+    redirects := map[string]string{}
+    failed := false
+
+    for resp := range in {
+      r.mu.Lock()
+      for title, linked := range resp.Links {
+        into[title] = append(into[title], linked...)
+      }
+      for alias, title := range resp.Redirects {
+        r.Fixture.Redirects[alias] = title
+        redirects[alias] = title
+      }
+      for title, ns := range resp.Namespaces {
+        r.Fixture.Namespaces[title] = ns
+      }
+      r.mu.Unlock()
+      for _, title := range resp.Missing {
+        missing[title] = true
+      }
+      failed = failed || resp.Err != nil
+      select {
+      case c <- resp:
+      case <-ctx.Done():
+        return
+      }
+    }
+
+    // Existing pages without any links still need an entry to replay
+    if !failed && ctx.Err() == nil {
+      r.mu.Lock()
+      for _, title := range titles {
+        if resolved, ok := redirects[title]; ok {
+          title = resolved
+        }
+        if _, ok := into[title]; !ok && !missing[title] {
+          into[title] = []string{}
+        }
+      }
+      r.mu.Unlock()
+    }
+  }()
+
+  return c
+}
@@ -0,0 +1,87 @@
+package links
+
+import (
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "reflect"
+  "testing"
+)
+
+func TestFixture_RecordReplay(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "Start": {"A", "Dead end"},
+    "A":     {"B"},
+    "B":     {"Target"},
+  })
+
+  recorder := NewRecorder(g)
+  pg := NewPageGraph(recorder)
+  expect, err := pg.Search("Start", "Target")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  dir, err := ioutil.TempDir("", "wikiracer")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "fixture.json")
+  if err := recorder.Save(path); err != nil {
+    t.Fatal(err)
+  }
+
+  fixture, err := LoadFixture(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(recorder.Fixture, fixture) {
+    t.Fatalf("expected: %#v\ngot: %#v", recorder.Fixture, fixture)
+  }
+
+  pg = NewPageGraph(fixture)
+  got, err := pg.Search("Start", "Target")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(expect, got) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, got)
+  }
+}
+
+func TestRecorder_MaxRequests(t *testing.T) {
+  server := fakeWiki(map[string][]string{
+    "Start": {"A"},
+    "A":     {"B"},
+    "B":     {"C"},
+    "C":     {"Target"},
+  }, nil)
+  defer server.Close()
+
+  // Recording doesn't lift the budget of the source's requests
+  recorder := NewRecorder(testWiki(Config{Endpoint: server.URL}))
+  _, err := NewPageGraph(recorder).Search("Start", "Target", SearchOptions{MaxRequests: 2})
+  var limitErr *LimitError
+  if !errors.As(err, &limitErr) || limitErr.Limit != LimitRequests {
+    t.Errorf("expected the requests limit, got %v", err)
+  }
+}
+
+func TestLoadFixture(t *testing.T) {
+  fixture, err := LoadFixture(filepath.Join("testdata", "fixture.json"))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  pg := NewPageGraph(fixture)
+  path, err := pg.Search("Ada Lovelace", "Robert Frost")
+  if err != nil {
+    t.Fatal(err)
+  }
+  expect := []string{"Ada Lovelace", "Artificial intelligence", "Dartmouth College", "Robert Frost"}
+  if !reflect.DeepEqual(expect, path) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, path)
+  }
+}
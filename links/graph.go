@@ -0,0 +1,255 @@
+package links
+
+import (
+  "bufio"
+  "context"
+  "encoding/binary"
+  "fmt"
+  "io"
+  "os"
+  "sort"
+  "strings"
+)
+
+// Identifies graph files, and their version
+const graphMagic = "WRGRAPH1"
+
+// Graph is a LinkSource over a compact, offline index of a whole wiki, as
+// built by ImportDump. Pages are numbered in title order and the links of
+// each direction stored as one array of page numbers
+type Graph struct {
+  // Titles of the pages, sorted
+  titles []string
+  from adjacency
+  here adjacency
+  // Redirect title -> page it resolves to
+  aliases map[string]uint32
+}
+
+// GraphStats counts what a Graph holds
+type GraphStats struct {
+  Pages int
+  Links int
+  Redirects int
+}
+
+// adjacency lists the pages linked to each page: those of page i are
+// targets[offsets[i]:offsets[i+1]]
+type adjacency struct {
+  offsets []uint32
+  targets []uint32
+}
+
+// newAdjacency indexes edges by their first page, or by their second if
+// reverse is 1. Duplicate edges are dropped
+func newAdjacency(pages int, edges [][2]uint32, reverse int) adjacency {
+  key, value := reverse, 1-reverse
+  sort.Slice(edges, func(i, j int) bool {
+    if edges[i][key] != edges[j][key] {
+      return edges[i][key] < edges[j][key]
+    }
+    return edges[i][value] < edges[j][value]
+  })
+
+  a := adjacency{offsets: make([]uint32, pages+1), targets: make([]uint32, 0, len(edges))}
+  for i, edge := range edges {
+    if i > 0 && edge == edges[i-1] {
+      continue
+    }
+    a.targets = append(a.targets, edge[value])
+    a.offsets[edge[key]+1]++
+  }
+  for i := 1; i <= pages; i++ {
+    a.offsets[i] += a.offsets[i-1]
+  }
+  return a
+}
+
+func (a adjacency) of(page uint32) []uint32 {
+  if int(page)+1 >= len(a.offsets) {
+    return nil
+  }
+  return a.targets[a.offsets[page]:a.offsets[page+1]]
+}
+
+// LoadGraph reads a Graph saved to path
+func LoadGraph(path string) (*Graph, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  r := bufio.NewReaderSize(f, 1<<20)
+
+  magic := make([]byte, len(graphMagic))
+  if _, err := io.ReadFull(r, magic); err != nil || string(magic) != graphMagic {
+    return nil, fmt.Errorf("not a wikiracer graph: %s", path)
+  }
+  var counts [3]uint32
+  if err := binary.Read(r, binary.LittleEndian, &counts); err != nil {
+    return nil, err
+  }
+  pages, links, redirects := int(counts[0]), int(counts[1]), int(counts[2])
+
+  g := &Graph{titles: make([]string, pages), aliases: make(map[string]uint32, redirects)}
+  for i := range g.titles {
+    if g.titles[i], err = readString(r); err != nil {
+      return nil, err
+    }
+  }
+  for _, a := range []*adjacency{&g.from, &g.here} {
+    a.offsets = make([]uint32, pages+1)
+    a.targets = make([]uint32, links)
+    if err := binary.Read(r, binary.LittleEndian, a.offsets); err != nil {
+      return nil, err
+    }
+    if err := binary.Read(r, binary.LittleEndian, a.targets); err != nil {
+      return nil, err
+    }
+  }
+  for i := 0; i < redirects; i++ {
+    alias, err := readString(r)
+    if err != nil {
+      return nil, err
+    }
+    var page uint32
+    if err := binary.Read(r, binary.LittleEndian, &page); err != nil {
+      return nil, err
+    }
+    if int(page) >= pages {
+      return nil, fmt.Errorf("corrupt graph: redirect to page %d of %d", page, pages)
+    }
+    g.aliases[alias] = page
+  }
+  return g, nil
+}
+
+// Save writes the graph to path
+func (g *Graph) Save(path string) error {
+  f, err := os.Create(path)
+  if err != nil {
+    return err
+  }
+  w := bufio.NewWriterSize(f, 1<<20)
+
+  stats := g.Stats()
+  io.WriteString(w, graphMagic)
+  binary.Write(w, binary.LittleEndian, [3]uint32{uint32(stats.Pages), uint32(stats.Links), uint32(stats.Redirects)})
+  for _, title := range g.titles {
+    writeString(w, title)
+  }
+  for _, a := range []adjacency{g.from, g.here} {
+    binary.Write(w, binary.LittleEndian, a.offsets)
+    binary.Write(w, binary.LittleEndian, a.targets)
+  }
+  aliases := []string{}
+  for alias := range g.aliases {
+    aliases = append(aliases, alias)
+  }
+  sort.Strings(aliases)
+  for _, alias := range aliases {
+    writeString(w, alias)
+    binary.Write(w, binary.LittleEndian, g.aliases[alias])
+  }
+
+  if err := w.Flush(); err != nil {
+    f.Close()
+    return err
+  }
+  return f.Close()
+}
+
+func readString(r *bufio.Reader) (string, error) {
+  n, err := binary.ReadUvarint(r)
+  if err != nil {
+    return "", err
+  }
+  b := make([]byte, n)
+  _, err = io.ReadFull(r, b)
+  return string(b), err
+}
+
+func writeString(w *bufio.Writer, s string) {
+  var n [binary.MaxVarintLen64]byte
+  w.Write(n[:binary.PutUvarint(n[:], uint64(len(s)))])
+  w.WriteString(s)
+}
+
+// Stats returns how many pages, links and redirects the graph holds
+func (g *Graph) Stats() GraphStats {
+  return GraphStats{Pages: len(g.titles), Links: len(g.from.targets), Redirects: len(g.aliases)}
+}
+
+// LinksFrom sends the links from titles as a single Response
+func (g *Graph) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return g.respond(ctx, titles, g.from)
+}
+
+// LinksHere sends the links to titles as a single Response
+func (g *Graph) LinksHere(ctx context.Context, titles []string) chan Response {
+  return g.respond(ctx, titles, g.here)
+}
+
+// Find reports which titles are missing and which redirect
+func (g *Graph) Find(ctx context.Context, titles []string) Response {
+  resp, ok := <-g.respond(ctx, titles, adjacency{})
+  if !ok {
+    return Response{Err: ctx.Err()}
+  }
+  resp.Links = nil
+  return resp
+}
+
+// Suggest returns up to limit titles containing title, ignoring case
+func (g *Graph) Suggest(ctx context.Context, title string, limit int) ([]string, error) {
+  title = strings.ToLower(title)
+  titles := []string{}
+  for _, candidate := range g.titles {
+    if len(titles) == limit || ctx.Err() != nil {
+      break
+    }
+    if strings.Contains(strings.ToLower(candidate), title) {
+      titles = append(titles, candidate)
+    }
+  }
+  return titles, ctx.Err()
+}
+
+// page returns the number of title
+func (g *Graph) page(title string) (uint32, bool) {
+  i := sort.SearchStrings(g.titles, title)
+  if i < len(g.titles) && g.titles[i] == title {
+    return uint32(i), true
+  }
+  return 0, false
+}
+
+// respond is the Graph version of the respond of in-memory sources
+func (g *Graph) respond(ctx context.Context, titles []string, links adjacency) chan Response {
+  c := make(chan Response, 1)
+  resp := Response{Links: Links{}, Missing: []string{}, Redirects: map[string]string{}}
+  for _, title := range titles {
+    page, ok := g.page(title)
+    if !ok {
+      if page, ok = g.aliases[title]; ok {
+        resp.Redirects[title] = g.titles[page]
+      }
+    }
+    if !ok {
+      resp.Missing = append(resp.Missing, title)
+      continue
+    }
+    if linked := links.of(page); len(linked) > 0 {
+      names := make([]string, len(linked))
+      for i, to := range linked {
+        names[i] = g.titles[to]
+      }
+      resp.Links[g.titles[page]] = names
+    }
+  }
+  if ctx.Err() == nil {
+    c <- resp
+  }
+  close(c)
+  return c
+}
@@ -0,0 +1,294 @@
+package links
+
+import (
+  "context"
+  "fmt"
+  "strings"
+  "sync"
+  "unicode"
+)
+
+// Heuristics a best-first search can be run with, see NewHeuristic
+const (
+  HeuristicTitle = "title"
+  HeuristicCategories = "categories"
+  HeuristicInbound = "inbound"
+)
+
+// Heuristic scores the pages a best-first search reached by how promising
+// they look on the way to its target. Scores only compare with each other,
+// the pages scored highest are expanded first
+type Heuristic interface {
+  // Score returns the score of each of pages, in order, and what the
+  // requests it made took
+  Score(ctx context.Context, target string, pages []string) ([]float64, FetchStats, error)
+}
+
+// ValidateHeuristic returns an error unless name is one of the heuristics
+// or empty, which stands for none
+func ValidateHeuristic(name string) error {
+  switch name {
+  case "", HeuristicTitle, HeuristicCategories, HeuristicInbound:
+    return nil
+  }
+  return fmt.Errorf("unknown heuristic: %q", name)
+}
+
+// NewHeuristic returns the heuristic of the given name looking pages up in
+// source, or nil if name is empty
+func NewHeuristic(name string, source LinkSource) (Heuristic, error) {
+  if err := ValidateHeuristic(name); err != nil {
+    return nil, err
+  }
+  switch name {
+  case HeuristicTitle:
+    return TitleHeuristic{}, nil
+  case HeuristicCategories:
+    return &CategoryHeuristic{Source: source}, nil
+  case HeuristicInbound:
+    return &InboundHeuristic{Source: source}, nil
+  }
+  return nil, nil
+}
+
+// TitleHeuristic scores pages by the words their titles share with the
+// target's, out of the words of both. Words are compared by their first
+// letters, a crude stem, and it makes no requests
+type TitleHeuristic struct{}
+
+// Letters of a word compared by TitleHeuristic
+const stemLength = 5
+
+// Words too common in titles to tell anything
+var titleStopWords = map[string]bool{
+  "a": true, "an": true, "and": true, "at": true, "by": true, "for": true,
+  "in": true, "of": true, "on": true, "or": true, "the": true, "to": true,
+}
+
+func (TitleHeuristic) Score(ctx context.Context, target string, pages []string) ([]float64, FetchStats, error) {
+  words := titleStems(target)
+  scores := make([]float64, len(pages))
+  for i, page := range pages {
+    scores[i] = overlap(words, titleStems(page))
+  }
+  return scores, FetchStats{}, nil
+}
+
+// titleStems returns the stems of the words of title, leaving out its
+// namespace
+func titleStems(title string) map[string]bool {
+  if titleNamespace(title) != 0 {
+    title = title[strings.Index(title, ":")+1:]
+  }
+  stems := map[string]bool{}
+  for _, word := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+    return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+  }) {
+    if titleStopWords[word] {
+      continue
+    }
+    if runes := []rune(word); len(runes) > stemLength {
+      word = string(runes[:stemLength])
+    }
+    stems[word] = true
+  }
+  return stems
+}
+
+// overlap returns how many of the keys of a and b both have, out of all of
+// them
+func overlap(a, b map[string]bool) float64 {
+  shared := 0
+  for key := range a {
+    if b[key] {
+      shared++
+    }
+  }
+  if all := len(a) + len(b) - shared; all > 0 {
+    return float64(shared) / float64(all)
+  }
+  return 0
+}
+
+// CategoryLister is implemented by link sources that know the categories
+// pages are in apart from their links, as the API does
+type CategoryLister interface {
+  // Categories maps each page to the categories it is in, the way
+  // LinksFrom maps it to the pages it links to
+  Categories(ctx context.Context, titles []string) chan Response
+}
+
+// CategoryHeuristic scores pages by the share of the target's categories
+// they are in too. Categories come from the source if it is a
+// CategoryLister, a request per 50 pages reached on the API, and are the
+// pages' links into categories otherwise. Those of each page are fetched
+// once, so a CategoryHeuristic serves one search
+type CategoryHeuristic struct {
+  Source LinkSource
+
+  mu sync.Mutex
+  // Categories of the pages fetched so far, the target's included
+  categories Links
+}
+
+func (h *CategoryHeuristic) Score(ctx context.Context, target string, pages []string) ([]float64, FetchStats, error) {
+  h.mu.Lock()
+  defer h.mu.Unlock()
+  if h.categories == nil {
+    h.categories = Links{}
+  }
+  unknown := []string{}
+  for _, title := range append([]string{target}, pages...) {
+    if _, ok := h.categories[title]; !ok {
+      unknown = append(unknown, title)
+      h.categories[title] = nil
+    }
+  }
+  categories, stats, err := pageCategories(ctx, h.Source, unknown)
+  if err != nil {
+    for _, title := range unknown {
+      delete(h.categories, title)
+    }
+    return nil, stats, err
+  }
+  for title, in := range categories {
+    h.categories[title] = in
+  }
+  categories = h.categories
+
+  targetCategories := map[string]bool{}
+  for _, category := range categories[target] {
+    targetCategories[category] = true
+  }
+
+  scores := make([]float64, len(pages))
+  if len(targetCategories) == 0 {
+    return scores, stats, nil
+  }
+  for i, page := range pages {
+    shared := 0
+    for _, category := range categories[page] {
+      if targetCategories[category] {
+        shared++
+      }
+    }
+    scores[i] = float64(shared) / float64(len(targetCategories))
+  }
+  return scores, stats, nil
+}
+
+// pageCategories returns the categories each of titles is in, see
+// CategoryHeuristic, and what fetching them took
+func pageCategories(ctx context.Context, source LinkSource, titles []string) (Links, FetchStats, error) {
+  if len(titles) == 0 {
+    return Links{}, FetchStats{}, nil
+  }
+  var responses chan Response
+  if lister, ok := source.(CategoryLister); ok {
+    responses = lister.Categories(ctx, titles)
+  } else {
+    responses = source.LinksFrom(ctx, titles)
+  }
+
+  categories := Links{}
+  stats := FetchStats{}
+  for resp := range responses {
+    stats.add(resp.Stats)
+    if resp.Err != nil {
+      return nil, stats, resp.Err
+    }
+    for page, linked := range resp.Links {
+      for _, title := range linked {
+        ns, known := resp.Namespaces[title]
+        if !known {
+          ns = titleNamespace(title)
+        }
+        if ns == titleNamespaces["Category"] {
+          categories.add(page, title)
+        }
+      }
+    }
+  }
+  if err := ctx.Err(); err != nil {
+    return nil, stats, err
+  }
+  return categories, stats, nil
+}
+
+// InboundCounter is implemented by link sources that count the pages linking
+// to others cheaply, up to a cap, as the API does in one request per 50 pages
+type InboundCounter interface {
+  // CountLinksHere returns how many pages link to each of titles, those
+  // linked to by too many to count given the cap, and what counting took
+  CountLinksHere(ctx context.Context, titles []string) (map[string]int, FetchStats, error)
+}
+
+// InboundHeuristic scores pages by how many pages link to them, heading for
+// the hubs most pages are a few links away from whatever the target. Counts
+// come from the source if it is an InboundCounter, which saturate at its
+// cap, and from every link to the pages reached otherwise. Each page is
+// counted once, so an InboundHeuristic serves one search
+type InboundHeuristic struct {
+  Source LinkSource
+
+  mu sync.Mutex
+  // Counts of the pages scored so far
+  counts map[string]int
+}
+
+func (h *InboundHeuristic) Score(ctx context.Context, target string, pages []string) ([]float64, FetchStats, error) {
+  h.mu.Lock()
+  defer h.mu.Unlock()
+  if h.counts == nil {
+    h.counts = map[string]int{}
+  }
+  unknown := []string{}
+  for _, page := range pages {
+    if _, ok := h.counts[page]; !ok {
+      unknown = append(unknown, page)
+    }
+  }
+
+  var counts map[string]int
+  var stats FetchStats
+  var err error
+  if len(unknown) == 0 {
+    counts = map[string]int{}
+  } else if counter, ok := h.Source.(InboundCounter); ok {
+    counts, stats, err = counter.CountLinksHere(ctx, unknown)
+  } else {
+    counts, stats, err = countLinksHere(ctx, h.Source, unknown)
+  }
+  if err != nil {
+    return nil, stats, err
+  }
+  for _, page := range unknown {
+    h.counts[page] = counts[page]
+  }
+
+  scores := make([]float64, len(pages))
+  for i, page := range pages {
+    scores[i] = float64(h.counts[page])
+  }
+  return scores, stats, nil
+}
+
+// countLinksHere counts every page linking to each of titles, for sources
+// that aren't InboundCounters
+func countLinksHere(ctx context.Context, source LinkSource, titles []string) (map[string]int, FetchStats, error) {
+  counts := map[string]int{}
+  stats := FetchStats{}
+  for resp := range source.LinksHere(ctx, titles) {
+    stats.add(resp.Stats)
+    if resp.Err != nil {
+      return nil, stats, resp.Err
+    }
+    for page, linking := range resp.Links {
+      counts[page] += len(linking)
+    }
+  }
+  if err := ctx.Err(); err != nil {
+    return nil, stats, err
+  }
+  return counts, stats, nil
+}
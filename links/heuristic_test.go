@@ -0,0 +1,142 @@
+package links
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "reflect"
+  "testing"
+)
+
+func TestNewHeuristic(t *testing.T) {
+  g := NewMemoryGraph(Links{})
+  for name, expect := range map[string]Heuristic{
+    "":                  nil,
+    HeuristicTitle:      TitleHeuristic{},
+    HeuristicCategories: &CategoryHeuristic{Source: g},
+    HeuristicInbound:    &InboundHeuristic{Source: g},
+  } {
+    if heuristic, err := NewHeuristic(name, g); err != nil || !reflect.DeepEqual(expect, heuristic) {
+      t.Errorf("%q: unexpected heuristic: %#v, %v", name, heuristic, err)
+    }
+  }
+  if _, err := NewHeuristic("closest", g); err == nil {
+    t.Error("expected an unknown heuristic to be rejected")
+  }
+}
+
+func TestTitleHeuristic(t *testing.T) {
+  pages := []string{"Computer program", "Programming language", "History of computing", "Category:Computer programming", "London"}
+  scores, _, err := TitleHeuristic{}.Score(context.Background(), "Computer programming", pages)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // Words compare by stem, "of" and namespaces leave no mark
+  expect := []float64{1, 1.0 / 3, 1.0 / 3, 1, 0}
+  if !reflect.DeepEqual(expect, scores) {
+    t.Errorf("expected: %v, got: %v", expect, scores)
+  }
+}
+
+func TestCategoryHeuristic(t *testing.T) {
+  graph := map[string][]string{
+    "Target":     {"Category:A", "Category:B"},
+    "Both":       {"Category:A", "Category:B", "Target"},
+    "One":        {"Category:B", "Category:C"},
+    "None":       {"Category:C", "Target"},
+    "Category:A": {"Both"},
+  }
+  var requests int64
+  server := fakeWiki(graph, &requests)
+  defer server.Close()
+
+  for _, source := range []LinkSource{NewMemoryGraph(graph), testWiki(Config{Endpoint: server.URL})} {
+    heuristic := &CategoryHeuristic{Source: source}
+    scores, _, err := heuristic.Score(context.Background(), "Target", []string{"Both", "One", "None"})
+    if err != nil {
+      t.Fatal(err)
+    }
+    if expect := []float64{1, 0.5, 0}; !reflect.DeepEqual(expect, scores) {
+      t.Errorf("%T: expected: %v, got: %v", source, expect, scores)
+    }
+
+    // Categories already fetched, the target's included, aren't asked again
+    scores, stats, err := heuristic.Score(context.Background(), "Target", []string{"One", "Both"})
+    if err != nil || !reflect.DeepEqual([]float64{0.5, 1}, scores) || stats.Requests != 0 {
+      t.Errorf("%T: unexpected scores: %v in %d requests, %v", source, scores, stats.Requests, err)
+    }
+  }
+  if requests != 1 {
+    t.Errorf("expected a single request, got %d", requests)
+  }
+}
+
+func TestInboundHeuristic(t *testing.T) {
+  graph := map[string][]string{
+    "A":   {"Hub", "B"},
+    "B":   {"Hub"},
+    "C":   {"Hub", "B"},
+    "Hub": {"A"},
+  }
+  var requests int64
+  server := fakeWiki(graph, &requests)
+  defer server.Close()
+
+  for _, source := range []LinkSource{NewMemoryGraph(graph), testWiki(Config{Endpoint: server.URL})} {
+    scores, stats, err := (&InboundHeuristic{Source: source}).Score(context.Background(), "Anywhere", []string{"Hub", "B", "A", "C"})
+    if err != nil {
+      t.Fatal(err)
+    }
+    if expect := []float64{3, 2, 1, 0}; !reflect.DeepEqual(expect, scores) {
+      t.Errorf("%T: expected: %v, got: %v", source, expect, scores)
+    }
+    if int64(stats.Requests) != requests {
+      t.Errorf("%T: expected %d requests counted, got %d", source, requests, stats.Requests)
+    }
+  }
+  if requests != 1 {
+    t.Errorf("expected a single request, got %d", requests)
+  }
+
+  // Pages are counted once
+  heuristic := &InboundHeuristic{Source: testWiki(Config{Endpoint: server.URL})}
+  for i := 0; i < 2; i++ {
+    if _, _, err := heuristic.Score(context.Background(), "Anywhere", []string{"Hub", "B"}); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if requests != 2 {
+    t.Errorf("expected one more request, got %d in all", requests)
+  }
+}
+
+func TestMediaWiki_CountLinksHere(t *testing.T) {
+  // The listing stopped in the middle of Hub, and never got to Other
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if limit := r.URL.Query().Get("lhlimit"); limit != "500" {
+      t.Errorf("expected a capped request, got lhlimit=%s", limit)
+    }
+    w.Write([]byte(`{
+      "continue": {"lhcontinue": "20|123", "continue": "||"},
+      "query": {
+        "redirects": [{"from": "Redirect", "to": "Small"}],
+        "pages": {
+          "10": {"pageid": 10, "ns": 0, "title": "Small", "linkshere": [{"pageid": 1}, {"pageid": 2}]},
+          "20": {"pageid": 20, "ns": 0, "title": "Hub", "linkshere": [{"pageid": 3}]},
+          "30": {"pageid": 30, "ns": 0, "title": "Other"},
+          "-1": {"ns": 0, "title": "Nowhere", "missing": ""}
+        }
+      }
+    }`))
+  }))
+  defer server.Close()
+
+  counts, stats, err := testWiki(Config{Endpoint: server.URL}).CountLinksHere(context.Background(), []string{"Redirect", "Hub", "Other", "Nowhere"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  expect := map[string]int{"Redirect": 2, "Hub": inboundLimit, "Other": inboundLimit, "Nowhere": 0}
+  if !reflect.DeepEqual(expect, counts) || stats.Requests != 1 {
+    t.Errorf("expected: %v in a request, got: %v in %d", expect, counts, stats.Requests)
+  }
+}
@@ -0,0 +1,314 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "html"
+  "net/url"
+  "strings"
+)
+
+// HTMLRules pick the links of a rendered article a human reader could click
+// in its body prose
+type HTMLRules struct {
+  // Elements with any of these classes are skipped along with their content,
+  // links with them too
+  ExcludeClasses []string
+  // Ids of the elements, typically section headings, where the body prose
+  // ends. Nothing after the first of them is followed
+  StopIDs []string
+}
+
+// DefaultHTMLRules follow the links of Wikipedia articles up to their end
+// matter, skipping navigation boxes, sidebars, infoboxes, hatnotes and
+// references
+var DefaultHTMLRules = HTMLRules{
+  ExcludeClasses: []string{
+    // Navigation around the article
+    "navbox", "navbox-styles", "vertical-navbox", "sidebar", "portalbox", "sistersitebox", "side-box", "catlinks", "toc",
+    // Boxes and notes about the article
+    "infobox", "hatnote", "dablink", "ambox", "metadata", "shortdescription", "noprint",
+    // References and the markers pointing at them
+    "reference", "references", "reflist", "mw-references-wrap",
+    // Links that don't lead to another article
+    "mw-editsection", "new", "image", "mw-file-description", "external", "extiw",
+  },
+  StopIDs: []string{"See_also", "Notes", "References", "Citations", "Sources", "Bibliography", "Further_reading", "External_links"},
+}
+
+// Elements that never have content nor a closing tag
+var voidElements = map[string]bool{
+  "area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+  "input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// ParseHTMLLinks returns the titles of the wiki pages linked from the body
+// prose of page, the HTML of a rendered article, in order and without
+// repeats. Hidden elements are skipped along with those rules exclude
+func ParseHTMLLinks(page string, rules HTMLRules) []string {
+  excluded := map[string]bool{}
+  for _, class := range rules.ExcludeClasses {
+    excluded[class] = true
+  }
+  stops := map[string]bool{}
+  for _, id := range rules.StopIDs {
+    stops[id] = true
+  }
+
+  type element struct {
+    name string
+    skip bool
+  }
+  open := []element{}
+  // Open elements being skipped
+  skipping := 0
+  titles := []string{}
+  seen := map[string]bool{}
+
+  for i := 0; i < len(page); {
+    lt := strings.IndexByte(page[i:], '<')
+    if lt < 0 {
+      break
+    }
+    i += lt
+
+    switch {
+    case strings.HasPrefix(page[i:], "<!--"):
+      end := strings.Index(page[i+4:], "-->")
+      if end < 0 {
+        return titles
+      }
+      i += 4 + end + 3
+      continue
+    case strings.HasPrefix(page[i:], "</"):
+      gt := strings.IndexByte(page[i:], '>')
+      if gt < 0 {
+        return titles
+      }
+      name := strings.ToLower(strings.TrimSpace(page[i+2 : i+gt]))
+      i += gt + 1
+      // Closes the innermost element of that name, and any left open in it
+      for j := len(open) - 1; j >= 0; j-- {
+        if open[j].name == name {
+          for _, e := range open[j:] {
+            if e.skip {
+              skipping--
+            }
+          }
+          open = open[:j]
+          break
+        }
+      }
+      continue
+    case i+1 < len(page) && isTagStart(page[i+1]):
+    default:
+      // A "<" of the text, or a doctype
+      i++
+      continue
+    }
+
+    name, attrs, selfClosing, end := parseTag(page, i)
+    i = end
+    if name == "script" || name == "style" {
+      closing := strings.Index(strings.ToLower(page[i:]), "</"+name)
+      if closing < 0 {
+        return titles
+      }
+      i += closing
+      continue
+    }
+    if stops[attrs["id"]] {
+      return titles
+    }
+
+    skip := hidden(attrs["style"])
+    for _, class := range strings.Fields(attrs["class"]) {
+      skip = skip || excluded[class]
+    }
+    if name == "a" && !skip && skipping == 0 {
+      if title, ok := hrefTitle(attrs["href"]); ok && !seen[title] {
+        seen[title] = true
+        titles = append(titles, title)
+      }
+    }
+    if voidElements[name] || selfClosing {
+      continue
+    }
+    open = append(open, element{name: name, skip: skip})
+    if skip {
+      skipping++
+    }
+  }
+  return titles
+}
+
+func isTagStart(b byte) bool {
+  return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// parseTag reads the start tag at page[i], returning its lower cased name,
+// attributes, whether it closes itself and where it ends
+func parseTag(page string, i int) (string, map[string]string, bool, int) {
+  attrs := map[string]string{}
+  j := i + 1
+  for j < len(page) && !strings.ContainsRune(" \t\r\n/>", rune(page[j])) {
+    j++
+  }
+  name := strings.ToLower(page[i+1 : j])
+
+  for j < len(page) {
+    for j < len(page) && strings.ContainsRune(" \t\r\n", rune(page[j])) {
+      j++
+    }
+    switch {
+    case j >= len(page):
+      return name, attrs, false, j
+    case page[j] == '>':
+      return name, attrs, false, j + 1
+    case strings.HasPrefix(page[j:], "/>"):
+      return name, attrs, true, j + 2
+    case page[j] == '/':
+      j++
+      continue
+    }
+
+    start := j
+    for j < len(page) && !strings.ContainsRune(" \t\r\n=/>", rune(page[j])) {
+      j++
+    }
+    attr := strings.ToLower(page[start:j])
+    value := ""
+    if j < len(page) && page[j] == '=' {
+      j++
+      if j < len(page) && (page[j] == '"' || page[j] == '\'') {
+        quote := page[j]
+        end := strings.IndexByte(page[j+1:], quote)
+        if end < 0 {
+          return name, attrs, false, len(page)
+        }
+        value = page[j+1 : j+1+end]
+        j += end + 2
+      } else {
+        start := j
+        for j < len(page) && !strings.ContainsRune(" \t\r\n>", rune(page[j])) {
+          j++
+        }
+        value = page[start:j]
+      }
+    }
+    attrs[attr] = html.UnescapeString(value)
+  }
+  return name, attrs, false, j
+}
+
+// hidden reports whether an inline style hides its element
+func hidden(style string) bool {
+  return strings.Contains(strings.ToLower(strings.Replace(style, " ", "", -1)), "display:none")
+}
+
+// hrefTitle returns the title of the wiki page an href leads to, either a
+// "/wiki/Title" link or a "./Title" one of Parsoid
+func hrefTitle(href string) (string, bool) {
+  var path string
+  switch {
+  case strings.HasPrefix(href, "/wiki/"):
+    path = href[len("/wiki/"):]
+  case strings.HasPrefix(href, "./"):
+    path = href[len("./"):]
+  default:
+    return "", false
+  }
+  if i := strings.IndexAny(path, "#?"); i >= 0 {
+    path = path[:i]
+  }
+  title, err := url.PathUnescape(path)
+  if err != nil || len(title) == 0 {
+    return "", false
+  }
+  return strings.Replace(title, "_", " ", -1), true
+}
+
+// HTMLSource is a LinkSource following only the links in the body prose of
+// rendered articles, those a human racing on Wikipedia could click. The
+// API parses one page per request: LinksHere checks each page the API says
+// links in, so backward searches take a request per page reached
+type HTMLSource struct {
+  *MediaWiki
+  Rules HTMLRules
+}
+
+// NewHTMLSource returns an HTMLSource parsing the articles of mw with
+// DefaultHTMLRules
+func NewHTMLSource(mw *MediaWiki) *HTMLSource {
+  return &HTMLSource{MediaWiki: mw, Rules: DefaultHTMLRules}
+}
+
+// LinksFrom sends the body links of each of titles as a Response of its own
+func (s *HTMLSource) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return s.fetchAll(ctx, batch(titles, 1), s.pageLinks)
+}
+
+// LinksHere sends the pages linking to titles from their body prose, out of
+// those the API says link to them
+func (s *HTMLSource) LinksHere(ctx context.Context, titles []string) chan Response {
+  return s.checkedLinksHere(ctx, titles, s.pageLinks)
+}
+
+// parseResponse is the part of the API's action=parse response we read
+type parseResponse struct {
+  Error map[string]interface{} `json:"error"`
+  Parse struct {
+    Title string `json:"title"`
+    Text string `json:"text"`
+    Links []struct {
+      NS int `json:"ns"`
+      Title string `json:"title"`
+    } `json:"links"`
+  } `json:"parse"`
+}
+
+// pageLinks fetches the rendered article of the only one of titles and hands
+// the links of its body prose to send. Returns false once the stream has
+// ended
+func (s *HTMLSource) pageLinks(ctx context.Context, titles []string, send func(Response) bool) bool {
+  params := url.Values{
+    "action":        {"parse"},
+    "format":        {"json"},
+    "formatversion": {"2"},
+    "page":          {titles[0]},
+    "prop":          {"text|links"},
+    "redirects":     {"1"},
+  }
+  body, err := s.get(ctx, s.buildURL(params))
+  if ctx.Err() != nil {
+    return false
+  }
+  if err != nil {
+    return send(Response{Err: err})
+  }
+
+  var parsed parseResponse
+  if err := json.Unmarshal(body, &parsed); err != nil {
+    return send(Response{Err: err})
+  }
+  stats := FetchStats{Requests: 1, Bytes: int64(len(body))}
+  if parsed.Error != nil {
+    err := extractError(map[string]interface{}{"error": parsed.Error})
+    if apiErr, ok := err.(*ErrAPI); ok && apiErr.Code == "missingtitle" {
+      return send(Response{Links: Links{}, Missing: []string{titles[0]}, Stats: stats})
+    }
+    return send(Response{Err: err})
+  }
+
+  page := parsed.Parse.Title
+  // The links the API lists tell the namespaces of those in the text
+  namespaces := map[string]int{}
+  for _, link := range parsed.Parse.Links {
+    namespaces[link.Title] = link.NS
+  }
+  resp := s.pageResponse(page, ParseHTMLLinks(parsed.Parse.Text, s.Rules), namespaces, stats)
+  if page != titles[0] {
+    resp.Redirects[titles[0]] = page
+  }
+  return send(resp)
+}
@@ -0,0 +1,201 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "sync/atomic"
+  "testing"
+)
+
+// Articles saved from the parser's output, by title
+var htmlPages = []string{"Ada Lovelace", "Analytical Engine", "Alan Turing", "Charles Babbage"}
+
+func readHTML(t *testing.T, title string) string {
+  data, err := ioutil.ReadFile(filepath.Join("testdata", "html", strings.Replace(title, " ", "_", -1)+".html"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  return string(data)
+}
+
+func TestParseHTMLLinks(t *testing.T) {
+  page := readHTML(t, "Ada Lovelace")
+
+  // Not the hatnote, infobox, sidebar, references, red or external links,
+  // images, hidden or commented out links, nor anything from "See also" on
+  expect := []string{
+    "Mathematician", "Charles Babbage", "Analytical Engine", "Calculation", "Lord Byron",
+    "Algorithm", "Note G", "Difference engine", "Augustus De Morgan", "Mary Somerville",
+  }
+  if got := ParseHTMLLinks(page, DefaultHTMLRules); !reflect.DeepEqual(expect, got) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, got)
+  }
+
+  all := ParseHTMLLinks(page, HTMLRules{})
+  for _, title := range []string{"Lovelace (disambiguation)", "London", "Feminism", "File:Difference engine.jpg", "Women in computing", "Doi (identifier)", "Alan Turing"} {
+    if !contains(all, title) {
+      t.Errorf("expected %#v without rules, got %#v", title, all)
+    }
+  }
+  for _, title := range []string{"Hidden page", "Commented out"} {
+    if contains(all, title) {
+      t.Errorf("expected no %#v even without rules", title)
+    }
+  }
+
+  tests := []struct {
+    page   string
+    expect []string
+  }{
+    {`<p><a href="./Ada_Lovelace">Ada</a> <A HREF='/wiki/Caf%C3%A9?x=1'>café</A> <a href=/wiki/Turing_machine>machine</a></p>`, []string{"Ada Lovelace", "Café", "Turing machine"}},
+    {`<div class="infobox"><br><img src="x.png"><a href="/wiki/In_box">in</a></div><a href="/wiki/Out">out</a>`, []string{"Out"}},
+    {`<table class="navbox"><tr><td><a href="/wiki/A">a</a></table><p>1 < 2 <a href="/wiki/B">b</a>`, []string{"B"}},
+    {`<script>document.write("<a href='/wiki/A'>")</script><a href="/wiki/B">b</a><a href="/wiki/`, []string{"B"}},
+  }
+  for i, test := range tests {
+    if got := ParseHTMLLinks(test.page, DefaultHTMLRules); !reflect.DeepEqual(test.expect, got) {
+      t.Errorf("tests[%d]: expected: %#v, got: %#v", i, test.expect, got)
+    }
+  }
+}
+
+func contains(titles []string, title string) bool {
+  for _, t := range titles {
+    if t == title {
+      return true
+    }
+  }
+  return false
+}
+
+// htmlWiki serves the saved articles, parsed under action=parse and with
+// every link of them, as the API lists them, under "links" and "linkshere"
+// queries. "Ada Byron" redirects to "Ada Lovelace", pages linked from the
+// saved ones are empty, others are missing. Counts parse requests
+func htmlWiki(t *testing.T, parses *int64) *httptest.Server {
+  texts := map[string]string{}
+  graph := map[string][]string{}
+  for _, title := range htmlPages {
+    texts[title] = readHTML(t, title)
+    graph[title] = ParseHTMLLinks(texts[title], HTMLRules{})
+  }
+  api := fakeWiki(graph, nil)
+
+  return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    if query.Get("action") != "parse" {
+      api.Config.Handler.ServeHTTP(w, r)
+      return
+    }
+    atomic.AddInt64(parses, 1)
+
+    title := query.Get("page")
+    if title == "Ada Byron" {
+      title = "Ada Lovelace"
+    }
+    text, ok := texts[title]
+    if !ok {
+      for _, tos := range graph {
+        ok = ok || contains(tos, title)
+      }
+    }
+    if !ok {
+      json.NewEncoder(w).Encode(map[string]interface{}{
+        "error": map[string]interface{}{"code": "missingtitle", "info": "The page you specified doesn't exist."},
+      })
+      return
+    }
+    links := []map[string]interface{}{}
+    for _, to := range graph[title] {
+      links = append(links, map[string]interface{}{"ns": titleNamespace(to), "title": to, "exists": true})
+    }
+    json.NewEncoder(w).Encode(map[string]interface{}{
+      "parse": map[string]interface{}{"title": title, "text": text, "links": links},
+    })
+  }))
+}
+
+func TestHTMLSource_LinksFrom(t *testing.T) {
+  var parses int64
+  server := htmlWiki(t, &parses)
+  defer server.Close()
+
+  source := NewHTMLSource(testWiki(Config{Endpoint: server.URL}))
+  links, missing, redirects := Links{}, []string{}, map[string]string{}
+  for resp := range source.LinksFrom(context.Background(), []string{"Ada Byron", "Alan Turing", "Nowhere"}) {
+    if resp.Err != nil {
+      t.Fatal(resp.Err)
+    }
+    for from, tos := range resp.Links {
+      links[from] = tos
+    }
+    missing = append(missing, resp.Missing...)
+    for from, to := range resp.Redirects {
+      redirects[from] = to
+    }
+  }
+  if parses != 3 {
+    t.Errorf("expected a request per page, got %d", parses)
+  }
+
+  expect := Links{
+    "Ada Lovelace": ParseHTMLLinks(readHTML(t, "Ada Lovelace"), DefaultHTMLRules),
+    "Alan Turing":  {"Mathematician", "Computer scientist", "Computer science"},
+  }
+  if !reflect.DeepEqual(expect, links) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, links)
+  }
+  if !reflect.DeepEqual([]string{"Nowhere"}, missing) {
+    t.Errorf("expected Nowhere missing, got %#v", missing)
+  }
+  if !reflect.DeepEqual(map[string]string{"Ada Byron": "Ada Lovelace"}, redirects) {
+    t.Errorf("expected Ada Byron to redirect, got %#v", redirects)
+  }
+}
+
+func TestHTMLSource_Search(t *testing.T) {
+  var parses int64
+  server := htmlWiki(t, &parses)
+  defer server.Close()
+
+  // Ada Lovelace links to Alan Turing from the navbox at the bottom only
+  config := Config{Endpoint: server.URL}
+  path, err := NewPageGraph(testWiki(config)).Search("Ada Lovelace", "Alan Turing")
+  if err != nil || !reflect.DeepEqual([]string{"Ada Lovelace", "Alan Turing"}, path) {
+    t.Errorf("expected the link of the navbox, got %#v, %v", path, err)
+  }
+
+  // Charles Babbage links to Alan Turing from a navbox too, and Alan Turing
+  // to Analytical Engine from "See also": none of them count
+  path, err = NewPageGraph(NewHTMLSource(testWiki(config))).Search("Ada Lovelace", "Alan Turing")
+  expect := []string{"Ada Lovelace", "Analytical Engine", "Alan Turing"}
+  if err != nil || !reflect.DeepEqual(expect, path) {
+    t.Errorf("expected: %#v, got: %#v, %v", expect, path, err)
+  }
+  if parses == 0 {
+    t.Error("expected the articles to be parsed")
+  }
+
+  if _, err := NewPageGraph(NewHTMLSource(testWiki(config))).Search("Alan Turing", "Ada Lovelace"); err != ErrNoPath {
+    t.Errorf("expected no path through navboxes, got %v", err)
+  }
+}
+
+func TestConfig_Rules(t *testing.T) {
+  if err := (Config{Rules: "robot"}).Validate(); err == nil {
+    t.Error("expected unknown rules to be rejected")
+  }
+  if _, ok := NewSource(Config{Rules: RulesHuman}).(*HTMLSource); !ok {
+    t.Error("expected an HTMLSource for human rules")
+  }
+  // Links found under one rules aren't cached for the other
+  if (Config{}).Wiki() == (Config{Rules: RulesHuman}).Wiki() || (Config{}).Wiki() != (Config{Rules: RulesAll}).Wiki() {
+    t.Error("expected human rules alone to key apart")
+  }
+}
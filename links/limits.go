@@ -0,0 +1,134 @@
+package links
+
+import (
+  "context"
+  "errors"
+  "time"
+)
+
+// Limits a search can exceed, see LimitError
+const (
+  LimitDepth = "depth"
+  LimitPages = "pages"
+  LimitRequests = "requests"
+  LimitTimeout = "timeout"
+)
+
+// SearchOptions bound the work a search may do and the pages it goes through.
+// Zero values leave the matching limit off
+type SearchOptions struct {
+  // Most links in the path
+  MaxDepth int
+  // Most pages whose links are requested
+  MaxPages int64
+  // Most API requests made by the source, if it counts them. Requests in
+  // flight when the limit is reached may still complete
+  MaxRequests int64
+  // Longest time the search may take
+  Timeout time.Duration
+  // Namespaces the pages between both ends of a path may be in, any if
+  // empty. Sources that don't tell the namespaces of their pages have them
+  // guessed from their titles, see ModeNamespaces
+  Namespaces []int
+  // Searches forward best-first when set, expanding the pages it scores
+  // highest first rather than whole layers from both ends. Paths found may
+  // be longer than the shortest
+  Heuristic Heuristic
+}
+
+// searchOptions returns the first of options, if any
+func searchOptions(options []SearchOptions) SearchOptions {
+  if len(options) > 0 {
+    return options[0]
+  }
+  return SearchOptions{}
+}
+
+// budget keeps track of what a search used of its SearchOptions
+type budget struct {
+  SearchOptions
+  forward, backward *layers
+  counter RequestCounter
+  // Requests the source had made before the search
+  requests int64
+  // Pages whose links were requested by the search
+  pages int64
+}
+
+func newBudget(options SearchOptions, source LinkSource) *budget {
+  b := &budget{SearchOptions: options}
+  if counter, ok := source.(RequestCounter); ok {
+    b.counter = counter
+    b.requests = counter.Requests()
+  }
+  return b
+}
+
+// expand returns a LimitError if requesting the links of l's frontier would
+// go over budget, and counts them otherwise
+func (b *budget) expand(l *layers) error {
+  // Paths found by the next layer are one link longer than the layers so far
+  if b.MaxDepth > 0 && b.forward.depth+b.backward.depth >= b.MaxDepth {
+    return b.exceeded(LimitDepth)
+  }
+  if b.MaxPages > 0 && b.pages+int64(len(l.frontier)) > b.MaxPages {
+    return b.exceeded(LimitPages)
+  }
+  if b.MaxRequests > 0 && b.counter != nil && b.counter.Requests()-b.requests >= b.MaxRequests {
+    return b.exceeded(LimitRequests)
+  }
+  b.pages += int64(len(l.frontier))
+  return nil
+}
+
+// fetched returns a LimitError once the source made more requests than it
+// may
+func (b *budget) fetched() error {
+  if b.MaxRequests > 0 && b.counter != nil && b.counter.Requests()-b.requests > b.MaxRequests {
+    return b.exceeded(LimitRequests)
+  }
+  return nil
+}
+
+// allows reports whether paths may go through pages in namespace ns
+func (b *budget) allows(ns int) bool {
+  if len(b.Namespaces) == 0 {
+    return true
+  }
+  for _, allowed := range b.Namespaces {
+    if ns == allowed {
+      return true
+    }
+  }
+  return false
+}
+
+// timeout turns the error of a search that ran out of time into a
+// LimitError. ctx is the context the search was given
+func (b *budget) timeout(ctx context.Context, err error) error {
+  if b.Timeout > 0 && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+    return b.exceeded(LimitTimeout)
+  }
+  return err
+}
+
+func (b *budget) exceeded(limit string) *LimitError {
+  return &LimitError{Limit: limit, Forward: b.forward.frontierStats(), Backward: b.backward.frontierStats()}
+}
+
+// FrontierStats tells how far one direction of a search got
+type FrontierStats struct {
+  // Layers of links expanded
+  Depth int `json:"depth"`
+  // Pages reached, including those of the frontier
+  Pages int `json:"pages"`
+  // Pages reached by the last layer, whose links were not requested yet
+  Frontier int `json:"frontier"`
+}
+
+func (l *layers) frontierStats() FrontierStats {
+  if l == nil {
+    return FrontierStats{}
+  }
+  return FrontierStats{Depth: l.depth, Pages: len(l.depths), Frontier: len(l.frontier)}
+}
@@ -0,0 +1,101 @@
+package links
+
+import (
+  "context"
+  "errors"
+  "testing"
+  "time"
+)
+
+func TestSearch_Limits(t *testing.T) {
+  g := NewMemoryGraph(chain(Links{}, "Page", 10))
+
+  tests := []struct {
+    options SearchOptions
+    limit   string
+  }{
+    {SearchOptions{MaxDepth: 8}, LimitDepth},
+    {SearchOptions{MaxDepth: 9}, ""},
+    {SearchOptions{MaxPages: 5}, LimitPages},
+    {SearchOptions{MaxPages: 9}, ""},
+    // Memory graphs make no requests
+    {SearchOptions{MaxRequests: 1}, ""},
+  }
+
+  for i, test := range tests {
+    pg := NewPageGraph(g)
+    path, err := pg.Search("Page0", "Page9", test.options)
+    if len(test.limit) == 0 {
+      if err != nil || len(path) != 10 {
+        t.Errorf("tests[%d]: expected a path, got %#v, %v", i, path, err)
+      }
+      continue
+    }
+
+    var limitErr *LimitError
+    if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+      t.Fatalf("tests[%d]: expected limit exceeded, got %#v, %v", i, path, err)
+    }
+    if limitErr.Limit != test.limit {
+      t.Errorf("tests[%d]: expected %s limit, got %s", i, test.limit, limitErr.Limit)
+    }
+    if test.options.MaxPages > 0 && pg.Explored() > test.options.MaxPages {
+      t.Errorf("tests[%d]: explored %d pages", i, pg.Explored())
+    }
+    // Each direction reached the pages of its layers, one per layer
+    for _, stats := range []FrontierStats{limitErr.Forward, limitErr.Backward} {
+      if stats.Pages != stats.Depth+1 || stats.Frontier != 1 {
+        t.Errorf("tests[%d]: unexpected stats: %#v", i, limitErr)
+      }
+    }
+    if depth := limitErr.Forward.Depth + limitErr.Backward.Depth; depth > 8 {
+      t.Errorf("tests[%d]: searched %d layers", i, depth)
+    }
+  }
+}
+
+func TestSearch_MaxRequests(t *testing.T) {
+  graph := chain(chain(map[string][]string{}, "From", 100), "To", 100)
+  server := fakeWiki(graph, nil)
+  defer server.Close()
+  wiki := testWiki(Config{Endpoint: server.URL})
+
+  pg := NewPageGraph(wiki)
+  _, err := pg.Search("From0", "To99", SearchOptions{MaxRequests: 5})
+  var limitErr *LimitError
+  if !errors.As(err, &limitErr) || limitErr.Limit != LimitRequests {
+    t.Fatalf("expected requests limit exceeded, got %v", err)
+  }
+  // The preflight check and one request per layer
+  if wiki.Requests() > 6 {
+    t.Errorf("expected at most 6 requests, got %d", wiki.Requests())
+  }
+}
+
+func TestSearch_Timeout(t *testing.T) {
+  graph := chain(chain(map[string][]string{}, "From", 10000), "To", 10000)
+  server := fakeWiki(graph, nil)
+  defer server.Close()
+  wiki := testWiki(Config{Endpoint: server.URL})
+
+  pg := NewPageGraph(wiki)
+  start := time.Now()
+  _, err := pg.Search("From0", "To9999", SearchOptions{Timeout: 50 * time.Millisecond})
+  var limitErr *LimitError
+  if !errors.As(err, &limitErr) || limitErr.Limit != LimitTimeout {
+    t.Fatalf("expected timeout, got %v", err)
+  }
+  if elapsed := time.Since(start); elapsed > time.Second {
+    t.Errorf("expected the search to stop after 50ms, took %s", elapsed)
+  }
+  if limitErr.Forward.Depth == 0 && limitErr.Backward.Depth == 0 {
+    t.Errorf("expected progress, got %#v", limitErr)
+  }
+
+  // The deadline of the caller is not a limit of the search
+  ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+  defer cancel()
+  if _, err := pg.SearchContext(ctx, "From0", "To9999", SearchOptions{Timeout: time.Minute}); err != context.DeadlineExceeded {
+    t.Errorf("expected deadline exceeded, got %v", err)
+  }
+}
@@ -1,36 +1,16 @@
 package links
 
 import (
-  "encoding/json"
-  "fmt"
-  "io/ioutil"
-  "net/http"
-  "net/url"
-  "time"
-  "strings"
-  "os"
+  "context"
   "log"
-  "regexp"
+  "sort"
   "sync"
-)
-
-const (
-  apiEndpoint = "http://en.wikipedia.org/w/api.php"
-  userAgent= "wikiracer/0.86 (http://github.com/86me/wikiracer); egon@hyszczak.net"
-
-  /* https://en.wikipedia.org/wiki/Wikipedia:Namespace#Programming */
-  namespace = "0|14|100" // main|category|portal
+  "sync/atomic"
 )
 
 var (
-  tr = &http.Transport{
-    MaxIdleConns:     10,
-    IdleConnTimeout:  30 * time.Second,
-    DisableCompression: true,
-  }
-  client = &http.Client{ Transport: tr, Timeout: 30 * time.Second }
-
-  // Ignore uninteresting or "boring" term relationships
+  // Ignore uninteresting or "boring" term relationships, the patterns of
+  // DefaultFilter
   boring_regex = []string {
     "^Category:Articles needing.*$",
     "^Category:Articles with unsourced.*$",
@@ -67,22 +47,32 @@ var (
     "Bibliothèque nationale de France",
     "^.*\\(identifier\\)$",
   }
-  boring_regex_pattern = `(` + strings.Join(boring_regex, "|") + `)`
 )
 
+// PageGraph searches for paths between pages. It is safe for concurrent use,
+// searches share the redirects they learn until Reset
 type PageGraph struct {
-  forward safeStringMap
-  forwardQueue []string
-  backward safeStringMap
-  backwardQueue []string
+  source LinkSource
+  // Redirect or unnormalized title -> title it resolves to
+  aliases *safeStringMap
+
+  // Number of pages whose links were requested
+  explored int64
+
+  mu sync.Mutex
+  // Told about the progress of searches, if set
+  observer Observer
+  // Cancel the running searches
+  searches map[int]context.CancelFunc
+  nextSearch int
 }
 
-func NewPageGraph() PageGraph {
-  return PageGraph {
-    forward:    newSafeStringMap(),
-    forwardQueue:   []string{},
-    backward:     newSafeStringMap(),
-    backwardQueue:  []string{},
+// NewPageGraph returns a PageGraph that searches the links in source
+func NewPageGraph(source LinkSource) *PageGraph {
+  return &PageGraph {
+    source:     source,
+    aliases:      newSafeStringMap(),
+    searches:     map[int]context.CancelFunc{},
   }
 }
 
@@ -91,8 +81,8 @@ type safeStringMap struct {
   sync.RWMutex
 }
 
-func newSafeStringMap() safeStringMap {
-  return safeStringMap{map[string]string{}, sync.RWMutex{}}
+func newSafeStringMap() *safeStringMap {
+  return &safeStringMap{strings: map[string]string{}}
 }
 
 func (m *safeStringMap) Get(key string) (value string, exists bool) {
@@ -102,209 +92,406 @@ func (m *safeStringMap) Get(key string) (value string, exists bool) {
   return
 }
 
+// Clear removes every key
+func (m *safeStringMap) Clear() {
+  m.Lock()
+  defer m.Unlock()
+  m.strings = map[string]string{}
+}
+
 func (m *safeStringMap) Set(key, value string) {
   m.Lock()
   defer m.Unlock()
   m.strings[key] = value
 }
 
-// Takes starting and ending search terms and returns a path of links from the starting page to the ending page
-func (pg *PageGraph) Search(from string, to string) []string {
-  midpoint := make(chan string)
-
-  go func() {
-    midpoint <- pg.searchForward(from)
-  }()
-
-  go func() {
-    midpoint <- pg.searchBackward(to)
-  }()
-
-  return pg.path(<-midpoint)
+// Takes starting and ending search terms and returns a shortest path of links
+// from the starting page to the ending page. The search gives up with a
+// LimitError once it reaches any of the options given
+func (pg *PageGraph) Search(from string, to string, options ...SearchOptions) ([]string, error) {
+  return pg.SearchContext(context.Background(), from, to, options...)
 }
 
-func (pg *PageGraph) path(midpoint string) []string {
-  path := []string{}
+// SearchContext is like Search but gives up as soon as ctx is done, returning
+// the context's error. Both search directions and their API requests are torn
+// down before it returns
+func (pg *PageGraph) SearchContext(ctx context.Context, from, to string, options ...SearchOptions) ([]string, error) {
+  result, err := pg.searchResult(ctx, from, to, 1, searchOptions(options))
+  return result.Path, err
+}
 
-  // Build path from start to midpoint
-  ptr := midpoint
-  for len(ptr) > 0 {
-    log.Printf("FOUND PATH FORWARD: %#v", ptr)
-    path = append(path, ptr)
-    ptr, _ = pg.forward.Get(ptr)
+// start returns the context of a new search, which Stop cancels, and the
+// function to call once the search is over
+func (pg *PageGraph) start(ctx context.Context) (context.Context, func()) {
+  ctx, cancel := context.WithCancel(ctx)
+  pg.mu.Lock()
+  defer pg.mu.Unlock()
+  id := pg.nextSearch
+  pg.nextSearch++
+  pg.searches[id] = cancel
+  return ctx, func() {
+    cancel()
+    pg.mu.Lock()
+    defer pg.mu.Unlock()
+    delete(pg.searches, id)
   }
+}
 
-  // Swap path for backwards search
-  for i := 0; i < len(path)/2; i++ {
-    swap := len(path)-i-1
-    path[i], path[swap] = path[swap], path[i]
+// search runs a breadth-first search from both ends at once, one whole layer
+// at a time, always expanding the direction with the smaller frontier. It
+// stops after the first layer reaching a page the other direction reached,
+// and returns both directions along with the pages they met at on a shortest
+// path, sorted. Searches with a Heuristic go best-first instead, see
+// bestFirst
+func (pg *PageGraph) search(ctx context.Context, from, to string, options SearchOptions) (forward, backward *layers, meetings []string, err error) {
+  b := newBudget(options, pg.source)
+  if options.Timeout > 0 {
+    parent := ctx
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+    defer cancel()
+    defer func() {
+      err = b.timeout(parent, err)
+    }()
   }
 
-  // If no links exist, fail gracefully
-  if len(path) == 0 {
-    fmt.Println("No results.")
-    os.Exit(1)
+  if finder, ok := pg.source.(Finder); ok {
+    if from, to, err = pg.preflight(ctx, finder, from, to); err != nil {
+      return nil, nil, nil, err
+    }
   }
 
-  // Pop midpoint of the stack (following loop re-adds it)
-  path = path[0:len(path)-1]
-
-  // Add path from midpoint to end
-  ptr = midpoint
-  for len(ptr) > 0 {
-    log.Printf("FOUND PATH BACKWARDS: %#v", ptr)
-    path = append(path, ptr)
-    ptr, _ = pg.backward.Get(ptr)
+  forward, backward = newLayers(Forward, from), newLayers(Backward, to)
+  b.forward, b.backward = forward, backward
+  if from == to {
+    return forward, backward, []string{from}, nil
   }
-  return path
-}
-
-func (pg *PageGraph) searchForward(from string) string {
-  pg.forward.Set(from, "")
-  pg.forwardQueue = append(pg.forwardQueue, from)
 
-  for len(pg.forwardQueue) != 0 {
-    pages := pg.forwardQueue
-    pg.forwardQueue = []string{}
+  if options.Heuristic != nil {
+    return pg.bestFirst(ctx, forward, backward, options.Heuristic, b)
+  }
 
-    log.Printf("SEARCHING FORWARD: %#v", pages)
-    for links := range LinksFrom(pages) {
-      for from, tos := range links {
-        for _, to := range tos {
-          if pg.checkForward(from, to) {
-            return to
-          }
-        }
-      }
+  // Any path shorter than the layers searched so far would have had a page
+  // in both of them, so the first layer to meet the other direction holds
+  // every shortest path
+  for len(forward.frontier) > 0 && len(backward.frontier) > 0 {
+    expand, other, fetch := forward, backward, pg.source.LinksFrom
+    if len(backward.frontier) < len(forward.frontier) {
+      expand, other, fetch = backward, forward, pg.source.LinksHere
+    }
+    if err := b.expand(expand); err != nil {
+      return forward, backward, nil, err
+    }
+    met, err := pg.expand(ctx, expand, other, fetch, b)
+    if err != nil {
+      return forward, backward, nil, err
+    }
+    if len(met) > 0 {
+      return forward, backward, pg.shortest(forward, backward, met), nil
     }
   }
-
-  log.Println("FORWARD QUEUE EXHAUSTED")
-  return ""
+  if err := ctx.Err(); err != nil {
+    return forward, backward, nil, err
+  }
+  log.Println("SEARCH EXHAUSTED")
+  return forward, backward, nil, ErrNoPath
 }
 
-func (pg *PageGraph) checkForward(from, to string) (done bool) {
-  _, exists := pg.forward.Get(to)
-  if !exists {
-    log.Printf("FORWARD %#v -> %#v", from, to)
-    // "to" page has no path to source yet
-    pg.forward.Set(to, from)
-    pg.forwardQueue = append(pg.forwardQueue, to)
+// shortest returns the meetings on the shortest paths, leaving out those that
+// turned out to redirect to another one
+func (pg *PageGraph) shortest(forward, backward *layers, meetings []string) []string {
+  best := -1
+  for _, page := range meetings {
+    if depth := forward.depths[page] + backward.depths[page]; best < 0 || depth < best {
+      best = depth
+    }
+  }
+  met := map[string]bool{}
+  for _, page := range meetings {
+    met[page] = forward.depths[page] + backward.depths[page] == best
   }
 
-  // If path to destination exists, search complete
-  _, done = pg.backward.Get(to)
-  return done
+  shortest := []string{}
+  for _, page := range meetings {
+    if resolved := pg.Resolve(page); met[page] && (resolved == page || !met[resolved]) {
+      shortest = append(shortest, page)
+    }
+  }
+  return shortest
 }
 
-func (pg *PageGraph) searchBackward(to string) string {
-  pg.backward.Set(to, "")
-  pg.backwardQueue = append(pg.backwardQueue, to)
+// Number of "did you mean" titles offered for a page that doesn't exist
+const suggestions = 5
 
-  for len(pg.backwardQueue) != 0 {
-    pages := pg.backwardQueue
-    pg.backwardQueue = []string{}
+// preflight makes sure both pages exist and returns the titles they resolve to
+func (pg *PageGraph) preflight(ctx context.Context, finder Finder, from, to string) (string, string, error) {
+  resp := finder.Find(ctx, []string{from, to})
+  if err := ctx.Err(); err != nil {
+    return "", "", err
+  }
+  if resp.Err != nil {
+    return "", "", resp.Err
+  }
+  for alias, title := range resp.Redirects {
+    pg.aliases.Set(alias, title)
+  }
 
-    log.Printf("SEARCHING BACKWARD: %#v", pages)
-    for links := range LinksFrom(pages) {
-      for to, froms := range links {
-        for _, from := range froms {
-          if pg.checkBackward(from, to) {
-            return to
-          }
-        }
-      }
+  missing := map[string]bool{}
+  for _, title := range resp.Missing {
+    missing[title] = true
+  }
+  for _, title := range []string{from, to} {
+    if missing[title] || missing[pg.Resolve(title)] {
+      log.Printf("PAGE NOT FOUND: %#v", title)
+      // Suggestions are a courtesy, failing to get them is not an error
+      suggested, _ := finder.Suggest(ctx, title, suggestions)
+      return "", "", &PageNotFoundError{Title: title, Suggestions: suggested}
     }
   }
+  return pg.Resolve(from), pg.Resolve(to), nil
+}
 
-  log.Println("BACKWARD QUEUE EXHAUSTED")
-  return ""
+// Resolve returns the title the given title was found to redirect or
+// normalize to during the search, or the title itself
+func (pg *PageGraph) Resolve(title string) string {
+  return followRedirects(title, pg.aliases.Get)
 }
 
-func (pg *PageGraph) checkBackward(from, to string) (done bool) {
-  _, exists := pg.backward.Get(from)
-  if !exists {
-    log.Printf("BACKWARD %#v -> %#v", from, to)
-    // "from" page has no path to destination yet
-    pg.backward.Set(from, to)
-    pg.backwardQueue = append(pg.backwardQueue, from)
+// followRedirects returns the title title redirects to, as told by lookup,
+// following at most maxRedirects of them in case of a redirect loop
+func followRedirects(title string, lookup func(string) (string, bool)) string {
+  for i := 0; i < maxRedirects; i++ {
+    resolved, ok := lookup(title)
+    if !ok || resolved == title {
+      break
+    }
+    title = resolved
   }
+  return title
+}
 
-  // If path to source exists, search complete
-  _, done = pg.forward.Get(to)
-  return done
+// resolveAll replaces the titles of path by the pages they resolve to, to show
+// those rather than the redirects followed
+func (pg *PageGraph) resolveAll(path []string) []string {
+  for i := range path {
+    path[i] = pg.Resolve(path[i])
+  }
+  return path
 }
 
-// Prevent further searches
-func (pg *PageGraph) Stop() (done bool) {
-  log.Println("STOPPING FURTHER SEARCHES")
-  return done
+// layers is one direction of a breadth-first search that keeps every page a
+// page was reached from at the previous depth, rather than the first
+type layers struct {
+  direction string
+  depth int
+  frontier []string
+  // Page -> depth it was reached at
+  depths map[string]int
+  // Page -> pages one link closer to where the direction started
+  parents map[string][]string
+  // Page -> namespace the source said it is in
+  namespaces map[string]int
+  stats DirectionStats
 }
 
-// Returns the given slice as batches with a maximum size
-func batch(slice []string, max int) [][]string {
-  batches := [][]string{}
-  var start, end int
+func newLayers(direction, root string) *layers {
+  return &layers{
+    direction: direction,
+    frontier: []string{root},
+    depths: map[string]int{root: 0},
+    parents: map[string][]string{root: nil},
+    namespaces: map[string]int{},
+    stats: DirectionStats{Reached: []int{1}},
+  }
+}
 
-  for start < len(slice) {
-    end = start + max
-    if end > len(slice) {
-      end = len(slice)
+// reach records that page was reached from parent, returning true if it's new
+func (l *layers) reach(page, parent string) bool {
+  depth, ok := l.depths[page]
+  if !ok {
+    l.depths[page] = l.depth + 1
+    l.parents[page] = []string{parent}
+    if len(l.stats.Reached) <= l.depth+1 {
+      l.stats.Reached = append(l.stats.Reached, 0)
+    }
+    l.stats.Reached[l.depth+1]++
+    return true
+  }
+  if depth == l.depth+1 {
+    for _, known := range l.parents[page] {
+      if known == parent {
+        return false
+      }
     }
-    batches = append(batches, slice[start:end])
-    start = end
+    l.parents[page] = append(l.parents[page], parent)
   }
-  return batches
+  return false
 }
 
-func buildQuery(prefix, prop string, terms []string, cont string) (string) {
-  params := url.Values {
-    "action":     {"query"},
-    "format":     {"json"},
-    "prop":     {prop},
-    "titles":     {strings.Join(terms, "|")},
-    //"explaintext":  {""},
+// alias makes page and the title it resolves to stand for each other in l,
+// returning whichever of them l already had reached, if any
+func (l *layers) alias(page, title string) (string, bool) {
+  depth, ok := l.depths[page]
+  titleDepth, known := l.depths[title]
+  switch {
+  case ok && !known:
+    log.Printf("%s %#v => %#v", l.direction, page, title)
+    l.depths[title] = depth
+    l.parents[title] = l.parents[page]
+    return title, true
+  case known && !ok:
+    // Redirects linking to a page are aliases of it as well
+    l.depths[page] = titleDepth
+    l.parents[page] = l.parents[title]
+    return page, true
   }
-  params.Add(fmt.Sprintf("%snamespace", prefix), namespace)
-  params.Add(fmt.Sprintf("%slimit", prefix), "max")
-  if len(cont) > 0 {
-    params.Add(fmt.Sprintf("%scontinue", prefix), cont)
+  return title, ok
+}
+
+// expand requests the links of the frontier of l and makes the pages they
+// lead to its next frontier. Returns the pages reached that other has
+// reached too, sorted
+func (pg *PageGraph) expand(ctx context.Context, l, other *layers, fetch func(context.Context, []string) chan Response, b *budget) ([]string, error) {
+  pages := l.frontier
+  l.frontier = []string{}
+  log.Printf("SEARCHING %s: %#v", l.direction, pages)
+  atomic.AddInt64(&pg.explored, int64(len(pages)))
+  for len(l.stats.Expanded) <= l.depth {
+    l.stats.Expanded = append(l.stats.Expanded, 0)
   }
-  log.Printf("QUERY STRING: %s?%s", apiEndpoint, params.Encode())
+  l.stats.Expanded[l.depth] += len(pages)
+  pg.emit(Event{Type: EventExpanded, Direction: l.direction, Depth: l.depth, Pages: len(pages)})
 
-  return fmt.Sprintf("%s?%s", apiEndpoint, params.Encode())
-}
+  meetings := map[string]bool{}
+  meet := func(page string) {
+    if _, ok := other.depths[page]; ok {
+      meetings[page] = true
+    }
+  }
+
+  for resp := range fetch(ctx, pages) {
+    if resp.Err != nil {
+      return nil, resp.Err
+    }
+    l.stats.add(resp.Stats)
+    l.stats.Links += resp.Links.count()
+    pg.emit(Event{Type: EventFetched, Direction: l.direction, Depth: l.depth, Pages: len(resp.Links), Links: resp.Links.count()})
+    if err := b.fetched(); err != nil {
+      return nil, err
+    }
+    // Later layers routinely contain links to pages that don't exist
+    if l.depth == 0 && len(resp.Missing) > 0 {
+      return nil, &PageNotFoundError{Title: pages[0]}
+    }
 
-func get(url string) ([]byte, error) {
-  request, err := http.NewRequest("GET", url, nil)
-  if err != nil {
+    for alias, title := range resp.Redirects {
+      pg.aliases.Set(alias, title)
+      if page, ok := l.alias(alias, title); ok {
+        meet(page)
+      }
+    }
+
+    for page, linked := range resp.Links {
+      if ns, ok := resp.Namespaces[page]; ok {
+        l.namespaces[pg.Resolve(page)] = ns
+      }
+      page = pg.Resolve(page)
+      for _, link := range linked {
+        ns, known := resp.Namespaces[link]
+        link = pg.Resolve(link)
+        if link == page {
+          continue
+        }
+        if !known {
+          ns = titleNamespace(link)
+        }
+        // Wherever the other direction started is allowed to end a path
+        if depth, end := other.depths[link]; !b.allows(ns) && (!end || depth > 0) {
+          continue
+        }
+        if known {
+          l.namespaces[link] = ns
+        }
+        if l.reach(link, page) {
+          log.Printf("%s %#v -> %#v", l.direction, page, link)
+          l.frontier = append(l.frontier, link)
+          pg.emit(Event{Type: EventDiscovered, Direction: l.direction, Depth: l.depth + 1, Title: link, Parent: page})
+        }
+        if l.depths[link] == l.depth+1 {
+          meet(link)
+        }
+      }
+    }
+  }
+  if err := ctx.Err(); err != nil {
     return nil, err
   }
-  request.Header.Set("User-Agent", userAgent)
+  l.depth++
 
-  response, err := client.Do(request)
-  if err != nil {
-    return nil, err
+  sorted := []string{}
+  for page := range meetings {
+    sorted = append(sorted, page)
   }
-  defer response.Body.Close()
+  sort.Strings(sorted)
+  return sorted, nil
+}
+
+// Explored returns the number of pages whose links have been requested, in
+// either direction
+func (pg *PageGraph) Explored() int64 {
+  return atomic.LoadInt64(&pg.explored)
+}
 
-  if response.StatusCode != http.StatusOK {
-    return nil, fmt.Errorf("got status code: %s", response.Status)
+// Stop the running searches. Returns false if none was running
+func (pg *PageGraph) Stop() (done bool) {
+  log.Println("STOPPING SEARCHES")
+  pg.mu.Lock()
+  defer pg.mu.Unlock()
+  for _, cancel := range pg.searches {
+    cancel()
+    done = true
   }
+  return done
+}
 
-  return ioutil.ReadAll(response.Body)
+// Reset stops the running searches and forgets the redirects learned and
+// the pages explored so far, as if the PageGraph was new
+func (pg *PageGraph) Reset() {
+  pg.Stop()
+  pg.aliases.Clear()
+  atomic.StoreInt64(&pg.explored, 0)
 }
 
-// Links is a mapping of directional page links using page titles
+// Links is a mapping of directional page links using page titles. For
+// LinksFrom the key is the linking page, for LinksHere it is the linked page
 type Links map[string][]string
 
-func (pl Links) add(from, to string) {
-  // Check against boring title expressions and discard matches
-  boring := regexp.MustCompile(boring_regex_pattern)
-  if boring.Match([]byte(from)) || boring.Match([]byte(to)) {
-    return
+// Response is a single API response worth of links sent by LinksFrom and
+// LinksHere. If Err is set it is the last Response sent
+type Response struct {
+  Links Links
+  // Requested titles that do not exist
+  Missing []string
+  // Requested or linking titles that redirect or normalize to another title
+  Redirects map[string]string
+  // Namespaces of the titles in Links, if the source knows them
+  Namespaces map[string]int
+  // What it took to get this Response
+  Stats FetchStats
+  Err error
+}
+
+// count returns the number of links
+func (pl Links) count() int {
+  n := 0
+  for _, linked := range pl {
+    n += len(linked)
   }
+  return n
+}
 
+// add adds the link from one page to another, unless they are the same page
+func (pl Links) add(from, to string) {
   // Ignore self-referential links
   if from == to {
     return
@@ -316,94 +503,41 @@ func (pl Links) add(from, to string) {
   pl[from] = append(pl[from], to)
 }
 
-// LinksFrom takes one or more Wikipedia page titles and returns a channel that will receive one or more Links objects, each containing partial or full mappings of page to linked page. The channel will be closed after all results have been fetched
-func LinksFrom(titles []string) chan Links {
-  return allLinks("pl", "links", titles)
-}
-
-// allLinks batches API requests to fetch the maximum number of results allowed by Wikipedia and then sends Links objects containing those responses from Wikipedia on the returned channel
-func allLinks(prefix, prop string, titles []string) chan Links {
-  c := make(chan Links)
-
-  go func(prefix, prop string, titles []string) {
-    // Holds Wikipedia's "continue" string if we have more results to fetch. Set after the first request
-    var cont string
-
-    // Wikipedia can batch process up to 50 page titles at a time
-    for _, titlesBatch := range batch(titles, 50) {
-      // Continue paginating through results as long as Wikipedia is telling us to continue
-      for i := 0; i == 0 || len(cont) > 0; i++ {
-        queryURL := buildQuery(prefix, prop, titlesBatch, cont)
-        body, err := get(queryURL)
-        if err != nil {
-          // If Wikipedia returns an error, just panic instead of doing an exponential back-off
-          panic(err)
-        }
-
-        // Parse the response
-        resp := linksResponse{prefix: prefix, prop: prop}
-        err = json.Unmarshal(body, &resp)
-        if err != nil {
-          panic(err)
-        }
-
-        c <- resp.Links
-        cont = resp.Continue
-      }
-    }
-    close(c)
-  }(prefix, prop, titles)
-
-  return c
+// LinkSource provides the links between pages that PageGraph searches. Both
+// methods stream Responses keyed by the requested titles and close the channel
+// once all of them have been sent or ctx is done
+type LinkSource interface {
+  // LinksFrom maps each page to the pages it links to
+  LinksFrom(ctx context.Context, titles []string) chan Response
+  // LinksHere maps each page to the pages linking to it
+  LinksHere(ctx context.Context, titles []string) chan Response
 }
 
-// -- api response format
-
-// linksResponse encapsulates Wikipedia's query API response with either
-// "links" or "linkshere" properties enumerated
-type linksResponse struct {
-  prefix   string
-  prop   string
-  Continue string
-  Links  Links
+// Finder is implemented by link sources that can look up pages without
+// fetching their links. PageGraph uses it to reject races between pages that
+// don't exist before crawling
+type Finder interface {
+  // Find reports which titles are missing and which redirect elsewhere. The
+  // returned Response holds no Links
+  Find(ctx context.Context, titles []string) Response
+  // Suggest returns up to limit existing titles similar to title
+  Suggest(ctx context.Context, title string, limit int) ([]string, error)
 }
 
-func (r *linksResponse) UnmarshalJSON(b []byte) error {
-  data := map[string]interface{}{}
-  json.Unmarshal(b, &data)
-
-  r.Continue = extractContinue(data, fmt.Sprintf("%scontinue", r.prefix))
-  r.Links = extractLinks(data, r.prop)
-
-  return nil
+// RequestCounter is implemented by link sources that query an API, counting
+// the requests they made
+type RequestCounter interface {
+  Requests() int64
 }
 
-// extractContinue takes as input a Wikipedia API query response and returns the "continue" string. If no continue string is set, an empty string is returned
-func extractContinue(data map[string]interface{}, subkey string) string {
-  if cont, ok := data["continue"]; ok {
-    if contValue, ok := cont.(map[string]interface{})[subkey]; ok {
-      return contValue.(string)
-    }
-  }
-  return ""
+// LinksFrom returns the links from the given English Wikipedia pages, see
+// MediaWiki.LinksFrom
+func LinksFrom(ctx context.Context, titles []string) chan Response {
+  return NewMediaWiki(Config{}).LinksFrom(ctx, titles)
 }
 
-// extractLinks takes as input a Wikipedia API query response with either "links" or "linkshere" properties enumerated for a set of pages and returns a complete Links representation of that response
-func extractLinks(data map[string]interface{}, subkey string) Links {
-  links := Links{}
-
-  query := data["query"].(map[string]interface{})
-  pages := query["pages"].(map[string]interface{})
-  for _, page := range pages {
-    pageMap := page.(map[string]interface{})
-    fromTitle := pageMap["title"].(string)
-    linksSlice, ok := pageMap[subkey].([]interface{})
-    if ok {
-      for _, link := range linksSlice {
-        linkMap := link.(map[string]interface{})
-        links.add(fromTitle, linkMap["title"].(string))
-      }
-    }
-  }
-  return links
+// LinksHere returns the links to the given English Wikipedia pages, see
+// MediaWiki.LinksHere
+func LinksHere(ctx context.Context, titles []string) chan Response {
+  return NewMediaWiki(Config{}).LinksHere(ctx, titles)
 }
@@ -1,10 +1,20 @@
 package links
 
 import (
+  "context"
   "encoding/json"
+  "errors"
+  "fmt"
+  "math/rand"
+  "net/http"
+  "net/http/httptest"
   "reflect"
+  "sort"
   "strings"
+  "sync"
+  "sync/atomic"
   "testing"
+  "time"
 )
 
 const (
@@ -69,6 +79,78 @@ func TestLinksResponse_UnmarshalJSON(t *testing.T) {
   if !reflect.DeepEqual(expectLinks, resp.Links) {
     t.Errorf("expected: %#v\ngot: %#v", expectLinks, resp.Links)
   }
+  if len(resp.Namespaces) != 4 || resp.Namespaces["2009 Golden Globe Awards"] != 0 {
+    t.Errorf("expected the namespace of every page, got %#v", resp.Namespaces)
+  }
+}
+
+func TestLinksResponse_Redirects(t *testing.T) {
+  body := `{
+    "query": {
+      "normalized": [{"from": "king George", "to": "King George"}],
+      "redirects": [{"from": "King George", "to": "George IV of the United Kingdom"}],
+      "pages": {
+        "12345": {
+          "pageid": 12345,
+          "ns": 0,
+          "title": "George IV of the United Kingdom",
+          "linkshere": [
+            {"pageid": 1, "ns": 0, "title": "Brighton"},
+            {"pageid": 2, "ns": 0, "title": "Prince Regent", "redirect": ""}
+          ]
+        }
+      }
+    }
+  }`
+
+  resp := linksResponse{prefix: "lh", prop: "linkshere"}
+  if err := json.Unmarshal([]byte(body), &resp); err != nil {
+    t.Fatal(err)
+  }
+
+  expect := map[string]string{
+    "king George":   "George IV of the United Kingdom",
+    "King George":   "George IV of the United Kingdom",
+    "Prince Regent": "George IV of the United Kingdom",
+  }
+  if !reflect.DeepEqual(expect, resp.Redirects) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, resp.Redirects)
+  }
+}
+
+func TestMediaWiki_LinksHereRedirects(t *testing.T) {
+  graph := map[string][]string{
+    "A": {"Redirect"},
+    "B": {"Target"},
+    "C": {"Again"},
+  }
+  redirects := map[string]string{"Redirect": "Target", "Again": "Redirect"}
+  server := fakeRedirectWiki(graph, redirects, nil)
+  defer server.Close()
+
+  // The pages linking through a redirect link to the page it redirects to
+  links, linked := Links{}, map[string]string{}
+  for resp := range testWiki(Config{Endpoint: server.URL}).LinksHere(context.Background(), []string{"Target"}) {
+    if resp.Err != nil {
+      t.Fatal(resp.Err)
+    }
+    for title, froms := range resp.Links {
+      for _, from := range froms {
+        links.add(title, from)
+      }
+    }
+    for alias, title := range resp.Redirects {
+      linked[alias] = title
+    }
+  }
+  sort.Strings(links["Target"])
+  if expect := []string{"A", "Again", "B", "Redirect"}; !reflect.DeepEqual(Links{"Target": expect}, links) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, links)
+  }
+  // Redirects to the redirect aren't followed any further, but resolve
+  if expect := map[string]string{"Redirect": "Target", "Again": "Target"}; !reflect.DeepEqual(expect, linked) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, linked)
+  }
 }
 
 func TestBatch(t *testing.T) {
@@ -93,7 +175,7 @@ func TestBatch(t *testing.T) {
 }
 
 func TestBuildQuery(t *testing.T) {
-  url := buildQuery("xx", "titles", []string{"foo", "bar"}, "abc")
+  url := NewMediaWiki(Config{}).buildQuery("xx", "titles", []string{"foo", "bar"}, "abc")
 
   params := []string{
     "prop=titles",
@@ -101,6 +183,7 @@ func TestBuildQuery(t *testing.T) {
     "xxcontinue=abc",
     "xxlimit=max",
     "xxnamespace=0",
+    "redirects=1",
   }
   for _, expected := range params {
     if !strings.Contains(url, expected) {
@@ -108,3 +191,707 @@ func TestBuildQuery(t *testing.T) {
     }
   }
 }
+
+// testWiki returns a MediaWiki source that neither limits nor retries requests
+func testWiki(config Config) *MediaWiki {
+  return &MediaWiki{Config: config, Client: &Client{}}
+}
+
+// fakeWiki serves "links" and "linkshere" queries for the given graph of
+// page title -> linked page titles, counting requests if requests is non-nil,
+// and "categories" ones for the links into categories. Titles that appear
+// nowhere in the graph are reported missing
+func fakeWiki(graph map[string][]string, requests *int64) *httptest.Server {
+  return fakeRedirectWiki(graph, nil, requests)
+}
+
+// fakeRedirectWiki is fakeWiki with redirects of alias -> title, which are
+// followed when asked to and listed among the pages linking to their title
+func fakeRedirectWiki(graph map[string][]string, redirects map[string]string, requests *int64) *httptest.Server {
+  return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if requests != nil {
+      atomic.AddInt64(requests, 1)
+    }
+    query := r.URL.Query()
+    prop := query.Get("prop")
+
+    pages := map[string]interface{}{}
+    followed := []map[string]interface{}{}
+    for i, title := range strings.Split(query.Get("titles"), "|") {
+      if target, ok := redirects[title]; ok && query.Get("redirects") == "1" {
+        followed = append(followed, map[string]interface{}{"from": title, "to": target})
+        title = target
+      }
+      exists := false
+      linked := []map[string]interface{}{}
+      for from, tos := range graph {
+        exists = exists || from == title
+        for _, to := range tos {
+          exists = exists || to == title
+          if prop == "links" && from == title {
+            linked = append(linked, map[string]interface{}{"ns": 0, "title": to})
+          }
+          if prop == "linkshere" && to == title {
+            linked = append(linked, map[string]interface{}{"ns": 0, "title": from})
+          }
+          if prop == "categories" && from == title && titleNamespace(to) == 14 {
+            linked = append(linked, map[string]interface{}{"ns": 14, "title": to})
+          }
+        }
+      }
+      for alias, target := range redirects {
+        exists = exists || alias == title
+        if prop == "links" && alias == title {
+          linked = append(linked, map[string]interface{}{"ns": 0, "title": target})
+        }
+        if prop == "linkshere" && target == title {
+          linked = append(linked, map[string]interface{}{"ns": 0, "title": alias, "redirect": ""})
+        }
+      }
+      if !exists {
+        pages[fmt.Sprint(-1-i)] = map[string]interface{}{"ns": 0, "title": title, "missing": ""}
+        continue
+      }
+      pages[fmt.Sprint(i)] = map[string]interface{}{"ns": 0, "title": title, prop: linked}
+    }
+
+    json.NewEncoder(w).Encode(map[string]interface{}{
+      "query": map[string]interface{}{"pages": pages, "redirects": followed},
+    })
+  }))
+}
+
+func TestSearch_OnlyRealLinks(t *testing.T) {
+  // "Target" links back to "A", which a backward search over outgoing links
+  // would mistake for a link from "A" to "Target"
+  graph := map[string][]string{
+    "Start":  {"A"},
+    "A":      {"B"},
+    "B":      {"Target"},
+    "Target": {"A"},
+  }
+  var requests int64
+  server := fakeWiki(graph, &requests)
+  defer server.Close()
+  wiki := testWiki(Config{Endpoint: server.URL})
+
+  pg := NewPageGraph(wiki)
+  path, err := pg.Search("Start", "Target")
+  if err != nil {
+    t.Fatal(err)
+  }
+  // Requests of the losing direction may be cancelled before they're sent
+  if wiki.Requests() < atomic.LoadInt64(&requests) {
+    t.Errorf("expected at least %d requests, counted %d", atomic.LoadInt64(&requests), wiki.Requests())
+  }
+  if pg.Explored() < 2 {
+    t.Errorf("expected at least both pages to be explored, got %d", pg.Explored())
+  }
+
+  expect := []string{"Start", "A", "B", "Target"}
+  if !reflect.DeepEqual(expect, path) {
+    t.Fatalf("expected: %#v\ngot: %#v", expect, path)
+  }
+
+  for i := 1; i < len(path); i++ {
+    found := false
+    for _, to := range graph[path[i-1]] {
+      found = found || to == path[i]
+    }
+    if !found {
+      t.Errorf("path contains missing link %#v -> %#v", path[i-1], path[i])
+    }
+  }
+}
+
+// randomGraph returns a graph of n pages, each linking to any other with
+// probability p
+func randomGraph(r *rand.Rand, n int, p float64) Links {
+  graph := Links{}
+  for i := 0; i < n; i++ {
+    from := fmt.Sprintf("Page%d", i)
+    graph[from] = []string{}
+    for j := 0; j < n; j++ {
+      if i != j && r.Float64() < p {
+        graph[from] = append(graph[from], fmt.Sprintf("Page%d", j))
+      }
+    }
+  }
+  return graph
+}
+
+// bruteForce returns the length of the shortest paths from one page to
+// another with a plain breadth-first search, -1 if there are none, and how
+// many of them there are
+func bruteForce(graph Links, from, to string) (int, int) {
+  depths := map[string]int{from: 0}
+  counts := map[string]int{from: 1}
+  queue := []string{from}
+  for len(queue) > 0 {
+    page := queue[0]
+    queue = queue[1:]
+    for _, link := range graph[page] {
+      if _, ok := depths[link]; !ok {
+        depths[link] = depths[page] + 1
+        queue = append(queue, link)
+      }
+      if depths[link] == depths[page]+1 {
+        counts[link] += counts[page]
+      }
+    }
+  }
+  if depth, ok := depths[to]; ok {
+    return depth, counts[to]
+  }
+  return -1, 0
+}
+
+func TestSearch_Shortest(t *testing.T) {
+  r := rand.New(rand.NewSource(1))
+  for i := 0; i < 200; i++ {
+    n := 2 + r.Intn(25)
+    graph := randomGraph(r, n, r.Float64()*4/float64(n))
+    from, to := fmt.Sprintf("Page%d", r.Intn(n)), fmt.Sprintf("Page%d", r.Intn(n))
+    depth, count := bruteForce(graph, from, to)
+    g := NewMemoryGraph(graph)
+
+    pg := NewPageGraph(g)
+    path, err := pg.Search(from, to)
+    if depth < 0 {
+      if !errors.Is(err, ErrNoPath) {
+        t.Fatalf("graphs[%d] %s -> %s: expected no path, got %#v, %v", i, from, to, path, err)
+      }
+      continue
+    }
+    if err != nil {
+      t.Fatalf("graphs[%d] %s -> %s: %v", i, from, to, err)
+    }
+    if len(path) != depth+1 || path[0] != from || path[len(path)-1] != to {
+      t.Fatalf("graphs[%d] %s -> %s: expected %d hops, got %#v", i, from, to, depth, path)
+    }
+    for j := 1; j < len(path); j++ {
+      found := false
+      for _, link := range graph[path[j-1]] {
+        found = found || link == path[j]
+      }
+      if !found {
+        t.Fatalf("graphs[%d]: path contains missing link %#v -> %#v", i, path[j-1], path[j])
+      }
+    }
+
+    pg = NewPageGraph(g)
+    paths, total, err := pg.SearchAll(context.Background(), from, to, 0)
+    if err != nil || total != count || len(paths) != count {
+      t.Fatalf("graphs[%d] %s -> %s: expected %d paths, got %d of %d, %v", i, from, to, count, len(paths), total, err)
+    }
+  }
+}
+
+func TestSearch_ShortestRedirects(t *testing.T) {
+  // The shortest path goes through a redirect to the target, which the pages
+  // linking to the target don't list
+  graph := map[string][]string{
+    "S": {"A", "B"},
+    "A": {"R"},
+    "B": {"C"},
+    "C": {"T"},
+  }
+  server := fakeRedirectWiki(graph, map[string]string{"R": "T"}, nil)
+  defer server.Close()
+  memory := NewMemoryGraph(graph)
+  memory.Redirect("R", "T")
+
+  for _, source := range []LinkSource{testWiki(Config{Endpoint: server.URL}), memory} {
+    path, err := NewPageGraph(source).Search("S", "T")
+    if err != nil || !reflect.DeepEqual([]string{"S", "A", "T"}, path) {
+      t.Errorf("%T: unexpected path: %#v, %v", source, path, err)
+    }
+  }
+
+  // The target is only linked to through the redirect
+  graph = map[string][]string{
+    "S":  {"A1"},
+    "A1": {"R"},
+    "T":  {"X"},
+  }
+  server = fakeRedirectWiki(graph, map[string]string{"R": "T"}, nil)
+  defer server.Close()
+  memory = NewMemoryGraph(graph)
+  memory.Redirect("R", "T")
+
+  for _, source := range []LinkSource{testWiki(Config{Endpoint: server.URL}), memory} {
+    path, err := NewPageGraph(source).Search("S", "T")
+    if err != nil || !reflect.DeepEqual([]string{"S", "A1", "T"}, path) {
+      t.Errorf("%T: unexpected path: %#v, %v", source, path, err)
+    }
+    here := Links{}
+    for resp := range source.LinksHere(context.Background(), []string{"T"}) {
+      for title, linking := range resp.Links {
+        here[title] = append(here[title], linking...)
+      }
+    }
+    if !contains(here["T"], "A1") {
+      t.Errorf("%T: expected A1 to link to T through R, got %#v", source, here)
+    }
+  }
+}
+
+// searchRandomly runs races between random pages of graph on pg, each
+// checked against a plain breadth-first search
+func searchRandomly(t testing.TB, pg *PageGraph, graph Links, r *rand.Rand, races int) {
+  n := len(graph)
+  for i := 0; i < races; i++ {
+    from, to := fmt.Sprintf("Page%d", r.Intn(n)), fmt.Sprintf("Page%d", r.Intn(n))
+    depth, _ := bruteForce(graph, from, to)
+    path, err := pg.Search(from, to)
+    if depth < 0 && !errors.Is(err, ErrNoPath) || depth >= 0 && (err != nil || len(path) != depth+1) {
+      t.Errorf("%s -> %s: expected %d hops, got %#v, %v", from, to, depth, path, err)
+    }
+  }
+}
+
+func TestSearch_Concurrent(t *testing.T) {
+  graph := randomGraph(rand.New(rand.NewSource(1)), 50, 0.05)
+  pg := NewPageGraph(NewMemoryGraph(graph))
+
+  var wg sync.WaitGroup
+  for i := 0; i < 8; i++ {
+    wg.Add(1)
+    go func(seed int64) {
+      defer wg.Done()
+      searchRandomly(t, pg, graph, rand.New(rand.NewSource(seed)), 20)
+    }(int64(i))
+  }
+  // Observers and counters may be used while searching
+  pg.Observe(func(Event) {})
+  pg.Explored()
+  wg.Wait()
+  if pg.Stop() {
+    t.Errorf("expected no search to be running")
+  }
+}
+
+func TestPageGraph_Reset(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "Start":     {"King George"},
+    "George IV": {"Target"},
+  })
+  g.Redirect("King George", "George IV")
+
+  pg := NewPageGraph(g)
+  for i := 0; i < 2; i++ {
+    path, err := pg.Search("Start", "Target")
+    if err != nil || len(path) != 3 {
+      t.Fatalf("search %d: unexpected path %#v, %v", i, path, err)
+    }
+    if resolved := pg.Resolve("King George"); resolved != "George IV" || pg.Explored() == 0 {
+      t.Errorf("search %d: expected King George to resolve to George IV, got %#v after %d pages", i, resolved, pg.Explored())
+    }
+
+    pg.Reset()
+    if resolved := pg.Resolve("King George"); resolved != "King George" || pg.Explored() != 0 {
+      t.Errorf("search %d: expected reset graph, got %#v after %d pages", i, resolved, pg.Explored())
+    }
+  }
+}
+
+func BenchmarkSearch_Concurrent(b *testing.B) {
+  graph := randomGraph(rand.New(rand.NewSource(1)), 200, 0.02)
+  pg := NewPageGraph(NewMemoryGraph(graph))
+  var seed int64
+  b.ResetTimer()
+  b.RunParallel(func(pb *testing.PB) {
+    r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+    for pb.Next() {
+      searchRandomly(b, pg, graph, r, 1)
+    }
+  })
+}
+
+// chain returns a graph linking prefix0 -> prefix1 -> ... -> prefix<n-1>
+func chain(graph Links, prefix string, n int) Links {
+  for i := 1; i < n; i++ {
+    from := fmt.Sprintf("%s%d", prefix, i-1)
+    graph[from] = append(graph[from], fmt.Sprintf("%s%d", prefix, i))
+  }
+  return graph
+}
+
+func TestSearchContext_Cancel(t *testing.T) {
+  // Two long disconnected chains that never meet
+  var requests int64
+  graph := chain(chain(map[string][]string{}, "From", 10000), "To", 10000)
+  server := fakeWiki(graph, &requests)
+  defer server.Close()
+  wiki := testWiki(Config{Endpoint: server.URL})
+
+  ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+  defer cancel()
+
+  pg := NewPageGraph(wiki)
+  path, err := pg.SearchContext(ctx, "From0", "To9999")
+  if err != context.DeadlineExceeded {
+    t.Fatalf("expected deadline exceeded, got path %#v, err %v", path, err)
+  }
+
+  // Neither direction may keep crawling once SearchContext has returned. An
+  // aborted request may still reach the server shortly after
+  time.Sleep(20 * time.Millisecond)
+  after := atomic.LoadInt64(&requests)
+  time.Sleep(50 * time.Millisecond)
+  if now := atomic.LoadInt64(&requests); now != after {
+    t.Errorf("%d requests made after search returned", now-after)
+  }
+}
+
+func TestStop(t *testing.T) {
+  graph := chain(chain(map[string][]string{}, "From", 10000), "To", 10000)
+  server := fakeWiki(graph, nil)
+  defer server.Close()
+  wiki := testWiki(Config{Endpoint: server.URL})
+
+  pg := NewPageGraph(wiki)
+  if pg.Stop() {
+    t.Errorf("expected no search to stop")
+  }
+
+  done := make(chan error)
+  go func() {
+    _, err := pg.SearchContext(context.Background(), "From0", "To9999")
+    done <- err
+  }()
+
+  time.Sleep(20 * time.Millisecond)
+  pg.Stop()
+
+  select {
+  case err := <-done:
+    if err != context.Canceled {
+      t.Errorf("expected canceled, got %v", err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("search did not stop")
+  }
+}
+
+func TestSearch_Errors(t *testing.T) {
+  graph := map[string][]string{
+    "Start": {"A"},
+    "B":     {"Target"},
+  }
+  server := fakeWiki(graph, nil)
+  defer server.Close()
+  wiki := testWiki(Config{Endpoint: server.URL})
+
+  tests := []struct {
+    from, to string
+    expect   error
+  }{
+    {"Start", "Target", ErrNoPath},
+    {"Nowhere", "Target", ErrPageMissing},
+    {"Start", "Nowhere", ErrPageMissing},
+  }
+  for i, test := range tests {
+    pg := NewPageGraph(wiki)
+    path, err := pg.Search(test.from, test.to)
+    if !errors.Is(err, test.expect) {
+      t.Errorf("tests[%d]: expected: %v, got: %#v, %v", i, test.expect, path, err)
+    }
+  }
+}
+
+func TestSearch_APIErrors(t *testing.T) {
+  tests := []struct {
+    status int
+    body   string
+    expect error
+  }{
+    {http.StatusTooManyRequests, ``, ErrRateLimited},
+    {http.StatusOK, `{"error": {"code": "ratelimited", "info": "slow down"}}`, ErrRateLimited},
+    {http.StatusOK, `{"error": {"code": "badvalue", "info": "nope"}}`, &ErrAPI{"badvalue", "nope"}},
+    {http.StatusOK, `{"batchcomplete": ""}`, nil},
+    {http.StatusOK, `not json`, nil},
+  }
+
+  for i, test := range tests {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      w.WriteHeader(test.status)
+      w.Write([]byte(test.body))
+    }))
+    wiki := testWiki(Config{Endpoint: server.URL})
+
+    pg := NewPageGraph(wiki)
+    _, err := pg.Search("Start", "Target")
+    switch expect := test.expect.(type) {
+    case nil:
+      if err == nil {
+        t.Errorf("tests[%d]: expected an error", i)
+      }
+    case *ErrAPI:
+      var apiErr *ErrAPI
+      if !errors.As(err, &apiErr) || *apiErr != *expect {
+        t.Errorf("tests[%d]: expected: %v, got: %v", i, expect, err)
+      }
+    default:
+      if !errors.Is(err, expect) {
+        t.Errorf("tests[%d]: expected: %v, got: %v", i, expect, err)
+      }
+    }
+
+    server.Close()
+  }
+}
+
+func TestConfig(t *testing.T) {
+  tests := []struct {
+    config   Config
+    endpoint string
+    valid    bool
+  }{
+    {Config{}, "https://en.wikipedia.org/w/api.php", true},
+    {Config{Lang: "de"}, "https://de.wikipedia.org/w/api.php", true},
+    {Config{Lang: "zh-yue"}, "https://zh-yue.wikipedia.org/w/api.php", true},
+    {Config{Lang: "de", Endpoint: "http://wiki.local/api.php"}, "http://wiki.local/api.php", true},
+    {Config{Lang: "evil.com/"}, "https://evil.com/.wikipedia.org/w/api.php", false},
+    {Config{Endpoint: "file:///etc/passwd"}, "file:///etc/passwd", false},
+  }
+
+  for i, test := range tests {
+    if got := test.config.APIEndpoint(); got != test.endpoint {
+      t.Errorf("tests[%d]: expected: %#v, got: %#v", i, test.endpoint, got)
+    }
+    if err := test.config.Validate(); (err == nil) != test.valid {
+      t.Errorf("tests[%d]: unexpected validation result: %v", i, err)
+    }
+  }
+}
+
+func TestModeNamespaces(t *testing.T) {
+  tests := []struct {
+    mode       string
+    namespaces string
+    expect     string
+  }{
+    {"", "", "0|14|100"},
+    {ModeLoose, "", "0|14|100"},
+    {ModeStrict, "", "0"},
+    {ModeCustom, "0|14", "0|14"},
+    {"", "0|4", "0|4"},
+    {ModeStrict, "0|14", ""},
+    {ModeCustom, "", ""},
+    {ModeCustom, "0|Category", ""},
+    {"human", "", ""},
+  }
+
+  for i, test := range tests {
+    namespaces, err := ModeNamespaces(test.mode, test.namespaces)
+    if namespaces != test.expect || (err == nil) != (len(test.expect) > 0) {
+      t.Errorf("tests[%d]: expected %#v, got %#v, %v", i, test.expect, namespaces, err)
+    }
+  }
+  if err := (Config{Namespaces: "0|x"}).Validate(); err == nil {
+    t.Error("expected invalid namespaces to be rejected")
+  }
+}
+
+func TestSearch_Namespaces(t *testing.T) {
+  // The shortest path goes through a category, the pages of the strict one
+  // are articles but for where it ends
+  g := NewMemoryGraph(Links{
+    "Start":             {"Category:Shortcut", "A"},
+    "Category:Shortcut": {"Target"},
+    "A":                 {"B"},
+    "B":                 {"Target", "Portal:End"},
+  })
+
+  tests := []struct {
+    to         string
+    namespaces []int
+    expect     []string
+  }{
+    {"Target", nil, []string{"Start", "Category:Shortcut", "Target"}},
+    {"Target", []int{0, 14}, []string{"Start", "Category:Shortcut", "Target"}},
+    {"Target", []int{0}, []string{"Start", "A", "B", "Target"}},
+    {"Portal:End", []int{0}, []string{"Start", "A", "B", "Portal:End"}},
+  }
+  for i, test := range tests {
+    pg := NewPageGraph(g)
+    result, err := pg.SearchResult(context.Background(), "Start", test.to, SearchOptions{Namespaces: test.namespaces})
+    if err != nil {
+      t.Fatalf("tests[%d]: %s", i, err)
+    }
+    if !reflect.DeepEqual(test.expect, result.Path) {
+      t.Errorf("tests[%d]: expected: %#v\ngot: %#v", i, test.expect, result.Path)
+    }
+    for _, title := range result.Path {
+      if ns, ok := result.Namespaces[title]; !ok || ns != titleNamespace(title) {
+        t.Errorf("tests[%d]: unexpected namespaces: %#v", i, result.Namespaces)
+      }
+    }
+  }
+
+  // Namespaces told by the source win over those of titles
+  fixture := &Fixture{
+    Outgoing: Links{"Start": {"Category:Shortcut"}, "Category:Shortcut": {"Target"}},
+    Incoming: Links{"Target": {"Category:Shortcut"}, "Category:Shortcut": {"Start"}},
+    Namespaces: map[string]int{"Category:Shortcut": 0},
+  }
+  result, err := NewPageGraph(fixture).SearchResult(context.Background(), "Start", "Target", SearchOptions{Namespaces: []int{0}})
+  if err != nil || len(result.Path) != 3 || result.Namespaces["Category:Shortcut"] != 0 {
+    t.Errorf("unexpected result: %#v, %v", result, err)
+  }
+}
+
+func TestMediaWiki_Config(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if ua := r.Header.Get("User-Agent"); ua != "racer/1.0" {
+      t.Errorf("unexpected User-Agent: %#v", ua)
+    }
+    if ns := r.URL.Query().Get("plnamespace"); ns != "0" {
+      t.Errorf("unexpected namespaces: %#v", ns)
+    }
+    w.Write([]byte(`{"query": {"pages": {}}}`))
+  }))
+  defer server.Close()
+
+  wiki := testWiki(Config{Endpoint: server.URL, UserAgent: "racer/1.0", Namespaces: "0"})
+  for resp := range wiki.LinksFrom(context.Background(), []string{"Berlin"}) {
+    if resp.Err != nil {
+      t.Fatal(resp.Err)
+    }
+  }
+}
+
+func TestMediaWiki_BatchWorkers(t *testing.T) {
+  // Every batch has a second page of results, continuing from its first title
+  var inFlight, most int64
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    n := atomic.AddInt64(&inFlight, 1)
+    defer atomic.AddInt64(&inFlight, -1)
+    for m := atomic.LoadInt64(&most); n > m && !atomic.CompareAndSwapInt64(&most, m, n); m = atomic.LoadInt64(&most) {
+    }
+    time.Sleep(20 * time.Millisecond)
+
+    query := r.URL.Query()
+    titles := strings.Split(query.Get("titles"), "|")
+    cont := query.Get("plcontinue")
+    if len(cont) > 0 && cont != titles[0] {
+      t.Errorf("batch of %#v continued from %#v", titles[0], cont)
+    }
+    pages := map[string]interface{}{}
+    for i, title := range titles {
+      link := title + " link"
+      if len(cont) > 0 {
+        link = title + " more"
+      }
+      pages[fmt.Sprint(i)] = map[string]interface{}{"ns": 0, "title": title, "links": []map[string]interface{}{{"ns": 0, "title": link}}}
+    }
+    data := map[string]interface{}{"query": map[string]interface{}{"pages": pages}}
+    if len(cont) == 0 {
+      data["continue"] = map[string]interface{}{"plcontinue": titles[0], "continue": "||"}
+    }
+    json.NewEncoder(w).Encode(data)
+  }))
+  defer server.Close()
+
+  titles := []string{}
+  for i := 0; i < 200; i++ {
+    titles = append(titles, fmt.Sprintf("Page%d", i))
+  }
+  wiki := &MediaWiki{Config: Config{Endpoint: server.URL, BatchWorkers: 3}, Client: &Client{MaxInFlight: 10}}
+  links := Links{}
+  for resp := range wiki.LinksFrom(context.Background(), titles) {
+    if resp.Err != nil {
+      t.Fatal(resp.Err)
+    }
+    for from, tos := range resp.Links {
+      links[from] = append(links[from], tos...)
+    }
+  }
+
+  for _, title := range titles {
+    if len(links[title]) != 2 {
+      t.Errorf("expected both pages of links of %#v, got %#v", title, links[title])
+    }
+  }
+  // 4 batches of 2 requests
+  if wiki.Requests() != 8 {
+    t.Errorf("expected 8 requests, got %d", wiki.Requests())
+  }
+  if most := atomic.LoadInt64(&most); most != 3 {
+    t.Errorf("expected 3 batches fetched at once, got %d", most)
+  }
+}
+
+func TestMediaWiki_BatchError(t *testing.T) {
+  var requests int64
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt64(&requests, 1)
+    if strings.HasPrefix(r.URL.Query().Get("titles"), "Page0|") {
+      w.Write([]byte(`{"error": {"code": "badvalue", "info": "Bad value"}}`))
+      return
+    }
+    time.Sleep(50 * time.Millisecond)
+    w.Write([]byte(`{"query": {"pages": {}}}`))
+  }))
+  defer server.Close()
+
+  titles := []string{}
+  for i := 0; i < 500; i++ {
+    titles = append(titles, fmt.Sprintf("Page%d", i))
+  }
+  wiki := &MediaWiki{Config: Config{Endpoint: server.URL, BatchWorkers: 2}, Client: &Client{}}
+  responses := []Response{}
+  for resp := range wiki.LinksFrom(context.Background(), titles) {
+    responses = append(responses, resp)
+  }
+
+  // The error ends the stream, and the batches not started yet are dropped
+  if len(responses) == 0 || responses[len(responses)-1].Err == nil {
+    t.Fatalf("expected the stream to end with the error, got %#v", responses)
+  }
+  for _, resp := range responses[:len(responses)-1] {
+    if resp.Err != nil {
+      t.Errorf("expected a single error, got %v", resp.Err)
+    }
+  }
+  if n := atomic.LoadInt64(&requests); n >= 10 {
+    t.Errorf("expected the batches to stop after the error, got %d requests", n)
+  }
+}
+
+func TestMediaWiki_FindSuggest(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    if query.Get("list") == "search" {
+      if query.Get("srsearch") != "Robrt Frost" || query.Get("srlimit") != "5" {
+        t.Errorf("unexpected search: %#v", query)
+      }
+      w.Write([]byte(`{"query": {"search": [{"ns": 0, "title": "Robert Frost"}, {"ns": 0, "title": "Frost"}]}}`))
+      return
+    }
+    w.Write([]byte(`{"query": {
+      "normalized": [{"from": "ada Lovelace", "to": "Ada Lovelace"}],
+      "pages": {
+        "-1": {"ns": 0, "title": "Robrt Frost", "missing": ""},
+        "974": {"pageid": 974, "ns": 0, "title": "Ada Lovelace"}
+      }
+    }}`))
+  }))
+  defer server.Close()
+
+  pg := NewPageGraph(testWiki(Config{Endpoint: server.URL}))
+  _, err := pg.Search("ada Lovelace", "Robrt Frost")
+
+  var notFound *PageNotFoundError
+  if !errors.As(err, &notFound) {
+    t.Fatalf("expected page not found, got: %v", err)
+  }
+  expect := &PageNotFoundError{Title: "Robrt Frost", Suggestions: []string{"Robert Frost", "Frost"}}
+  if !reflect.DeepEqual(expect, notFound) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, notFound)
+  }
+  if resolved := pg.Resolve("ada Lovelace"); resolved != "Ada Lovelace" {
+    t.Errorf("expected normalized title, got: %#v", resolved)
+  }
+}
@@ -0,0 +1,692 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "log"
+  "net/url"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+)
+
+// Most titles the API takes in one query
+const batchSize = 50
+
+// MediaWiki is a LinkSource that queries a live MediaWiki API
+type MediaWiki struct {
+  Config
+  Client *Client
+
+  requests int64
+}
+
+// NewMediaWiki returns a MediaWiki source for the API described by config,
+// sending requests with DefaultClient
+func NewMediaWiki(config Config) *MediaWiki {
+  return &MediaWiki{Config: config, Client: DefaultClient}
+}
+
+// NewSource returns the source of the links config races on: those of a
+// MediaWiki source, of a RevisionSource if it races as of a time, or of an
+// HTMLSource for RulesHuman
+func NewSource(config Config) LinkSource {
+  switch {
+  case !config.AsOf.IsZero():
+    return NewRevisionSource(NewMediaWiki(config))
+  case config.Rules == RulesHuman:
+    return NewHTMLSource(NewMediaWiki(config))
+  }
+  return NewMediaWiki(config)
+}
+
+// LinksFrom takes one or more Wikipedia page titles and returns a channel that will receive one or more Response objects, each containing partial or full mappings of page to linked page. The channel will be closed after all results have been fetched or ctx is done
+func (mw *MediaWiki) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return mw.allLinks(ctx, "pl", "links", titles)
+}
+
+// LinksHere takes one or more Wikipedia page titles and returns a channel that will receive one or more Response objects, each containing partial or full mappings of page to the pages linking to it, directly or through a redirect. The channel will be closed after all results have been fetched or ctx is done
+func (mw *MediaWiki) LinksHere(ctx context.Context, titles []string) chan Response {
+  return mw.fetchAll(ctx, batch(titles, batchSize), mw.batchLinksHere)
+}
+
+// batchLinksHere fetches the pages linking to one batch of titles, then those
+// linking to the redirects among them, which link to the titles redirected to
+// as well. Returns false once the stream has ended
+func (mw *MediaWiki) batchLinksHere(ctx context.Context, titles []string, send func(Response) bool) bool {
+  requested := map[string]bool{}
+  for _, title := range titles {
+    requested[title] = true
+  }
+  // Redirect linking to one of titles -> title it redirects to
+  aliases := map[string]string{}
+  ok := mw.batchLinks(ctx, "lh", "linkshere", func(cont string) string {
+    return mw.buildQuery("lh", "linkshere", titles, cont)
+  }, func(resp Response) bool {
+    for alias, title := range resp.Redirects {
+      if !requested[alias] {
+        aliases[alias] = title
+      }
+    }
+    return send(resp)
+  })
+  if !ok || len(aliases) == 0 {
+    return ok
+  }
+
+  sorted := []string{}
+  for alias := range aliases {
+    sorted = append(sorted, alias)
+  }
+  sort.Strings(sorted)
+  for _, aliasBatch := range batch(sorted, batchSize) {
+    // Without following them, which would list the pages linking to the
+    // titles again
+    params := mw.queryParams("lh", "linkshere", aliasBatch, "")
+    params.Del("redirects")
+    ok := mw.batchLinks(ctx, "lh", "linkshere", func(cont string) string {
+      if len(cont) > 0 {
+        params.Set("lhcontinue", cont)
+      }
+      return mw.buildURL(params)
+    }, func(resp Response) bool {
+      links := Links{}
+      for alias, linking := range resp.Links {
+        for _, from := range linking {
+          links.add(aliases[alias], from)
+        }
+      }
+      redirects := map[string]string{}
+      for _, alias := range aliasBatch {
+        redirects[alias] = aliases[alias]
+      }
+      // Redirects to the redirects
+      for from, to := range resp.Redirects {
+        if title, ok := aliases[to]; ok {
+          redirects[from] = title
+        }
+      }
+      resp.Links, resp.Redirects, resp.Missing = links, redirects, nil
+      return send(resp)
+    })
+    if !ok {
+      return false
+    }
+  }
+  return true
+}
+
+// Categories sends the categories each of titles is in, boring ones left out
+func (mw *MediaWiki) Categories(ctx context.Context, titles []string) chan Response {
+  return mw.allLinks(ctx, "cl", "categories", titles)
+}
+
+// Pages linking in CountLinksHere lists at most for a batch of titles, the
+// most one request returns
+const inboundLimit = 500
+
+// CountLinksHere counts the pages linking to each of titles with a single
+// request per batch, without continuing: the titles the listing stopped at
+// or didn't get to count inboundLimit
+func (mw *MediaWiki) CountLinksHere(ctx context.Context, titles []string) (map[string]int, FetchStats, error) {
+  counts := map[string]int{}
+  stats := FetchStats{}
+  for _, titleBatch := range batch(titles, batchSize) {
+    params := mw.queryParams("lh", "linkshere", titleBatch, "")
+    params.Set("lhlimit", fmt.Sprint(inboundLimit))
+    params.Set("lhprop", "pageid")
+    body, err := mw.get(ctx, mw.buildURL(params))
+    if err != nil {
+      return nil, stats, err
+    }
+    stats.add(FetchStats{Requests: 1, Bytes: int64(len(body))})
+
+    var resp inboundResponse
+    if err := json.Unmarshal(body, &resp); err != nil {
+      return nil, stats, err
+    }
+    if resp.Error != nil {
+      return nil, stats, extractError(map[string]interface{}{"error": resp.Error})
+    }
+    // Pages are listed by id, up to the one the continuation starts at
+    stopped := int64(-1)
+    if cont := resp.Continue.LHContinue; len(cont) > 0 {
+      stopped, _ = strconv.ParseInt(strings.Split(cont, "|")[0], 10, 64)
+    }
+    pages := map[string]int{}
+    for _, page := range resp.Query.Pages {
+      pages[page.Title] = len(page.LinksHere)
+      if stopped >= 0 && page.PageID >= stopped {
+        pages[page.Title] = inboundLimit
+      }
+    }
+
+    renamed := map[string]string{}
+    for _, change := range append(resp.Query.Normalized, resp.Query.Redirects...) {
+      renamed[change.From] = change.To
+    }
+    for _, title := range titleBatch {
+      page := title
+      for i := 0; i < maxRedirects; i++ {
+        to, ok := renamed[page]
+        if !ok {
+          break
+        }
+        page = to
+      }
+      counts[title] = pages[page]
+    }
+  }
+  return counts, stats, nil
+}
+
+// Returns the given slice as batches with a maximum size
+func batch(slice []string, max int) [][]string {
+  batches := [][]string{}
+  var start, end int
+
+  for start < len(slice) {
+    end = start + max
+    if end > len(slice) {
+      end = len(slice)
+    }
+    batches = append(batches, slice[start:end])
+    start = end
+  }
+  return batches
+}
+
+func (mw *MediaWiki) buildQuery(prefix, prop string, terms []string, cont string) (string) {
+  return mw.buildURL(mw.queryParams(prefix, prop, terms, cont))
+}
+
+// queryParams returns the parameters of a query of the prop of terms, see
+// buildQuery
+func (mw *MediaWiki) queryParams(prefix, prop string, terms []string, cont string) url.Values {
+  params := url.Values {
+    "action":     {"query"},
+    "format":     {"json"},
+    "prop":     {prop},
+    "titles":     {strings.Join(terms, "|")},
+    "redirects":  {"1"},
+    //"explaintext":  {""},
+  }
+  // Categories are all in theirs
+  if prop != "categories" {
+    params.Add(fmt.Sprintf("%snamespace", prefix), mw.namespaces())
+  }
+  params.Add(fmt.Sprintf("%slimit", prefix), "max")
+  if len(cont) > 0 {
+    params.Add(fmt.Sprintf("%scontinue", prefix), cont)
+  }
+  return params
+}
+
+func (mw *MediaWiki) buildURL(params url.Values) string {
+  if mw.Client.MaxLag > 0 {
+    params.Set("maxlag", fmt.Sprint(mw.Client.MaxLag))
+  }
+  log.Printf("QUERY STRING: %s?%s", mw.APIEndpoint(), params.Encode())
+
+  return fmt.Sprintf("%s?%s", mw.APIEndpoint(), params.Encode())
+}
+
+// Find looks up whether titles exist and what they redirect to
+func (mw *MediaWiki) Find(ctx context.Context, titles []string) Response {
+  params := url.Values {
+    "action":     {"query"},
+    "format":     {"json"},
+    "titles":     {strings.Join(titles, "|")},
+    "redirects":  {"1"},
+  }
+  body, err := mw.get(ctx, mw.buildURL(params))
+  if err != nil {
+    return Response{Err: err}
+  }
+
+  resp := linksResponse{}
+  if err := json.Unmarshal(body, &resp); err != nil {
+    return Response{Err: err}
+  }
+  return Response{Missing: resp.Missing, Redirects: resp.Redirects}
+}
+
+// Suggest uses the wiki's full text search to find up to limit pages similar
+// to title
+func (mw *MediaWiki) Suggest(ctx context.Context, title string, limit int) ([]string, error) {
+  params := url.Values {
+    "action":       {"query"},
+    "format":       {"json"},
+    "list":         {"search"},
+    "srsearch":     {title},
+    "srnamespace":  {mw.namespaces()},
+    "srlimit":      {fmt.Sprint(limit)},
+    "srprop":       {""},
+  }
+  body, err := mw.get(ctx, mw.buildURL(params))
+  if err != nil {
+    return nil, err
+  }
+
+  data := map[string]interface{}{}
+  if err := json.Unmarshal(body, &data); err != nil {
+    return nil, err
+  }
+  if err := extractError(data); err != nil {
+    return nil, err
+  }
+
+  titles := []string{}
+  query, _ := data["query"].(map[string]interface{})
+  results, _ := query["search"].([]interface{})
+  for _, result := range results {
+    resultMap, _ := result.(map[string]interface{})
+    if title, ok := resultMap["title"].(string); ok {
+      titles = append(titles, title)
+    }
+  }
+  return titles, nil
+}
+
+// Requests returns the number of API requests made, not counting retries
+func (mw *MediaWiki) Requests() int64 {
+  return atomic.LoadInt64(&mw.requests)
+}
+
+func (mw *MediaWiki) get(ctx context.Context, url string) ([]byte, error) {
+  atomic.AddInt64(&mw.requests, 1)
+  return mw.Client.Get(ctx, url, mw.userAgent())
+}
+
+// allLinks batches API requests to fetch the maximum number of results allowed by Wikipedia and then sends Response objects containing those responses from Wikipedia on the returned channel, as they arrive. Batches are fetched by up to BatchWorkers at once. The first error ends the stream
+func (mw *MediaWiki) allLinks(ctx context.Context, prefix, prop string, titles []string) chan Response {
+  return mw.fetchAll(ctx, batch(titles, batchSize), func(ctx context.Context, titles []string, send func(Response) bool) bool {
+    return mw.batchLinks(ctx, prefix, prop, func(cont string) string {
+      return mw.buildQuery(prefix, prop, titles, cont)
+    }, send)
+  })
+}
+
+// fetchAll calls fetch for every batch of titles, by up to BatchWorkers at
+// once, sending the Responses fetch hands to send on the returned channel. The
+// first error ends the stream
+func (mw *MediaWiki) fetchAll(ctx context.Context, batches [][]string, fetch func(context.Context, []string, func(Response) bool) bool) chan Response {
+  c := make(chan Response)
+
+  go func() {
+    defer close(c)
+    // Ends every batch once one of them failed
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    // Nothing is sent after an error, which is the last Response
+    var mu sync.Mutex
+    send := func(resp Response) bool {
+      mu.Lock()
+      defer mu.Unlock()
+      if ctx.Err() != nil {
+        return false
+      }
+      select {
+      case c <- resp:
+      case <-ctx.Done():
+        return false
+      }
+      if resp.Err != nil {
+        cancel()
+        return false
+      }
+      return true
+    }
+
+    workers := mw.batchWorkers()
+    if workers > len(batches) {
+      workers = len(batches)
+    }
+
+    queue := make(chan []string)
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+      wg.Add(1)
+      go func() {
+        defer wg.Done()
+        for titlesBatch := range queue {
+          if !fetch(ctx, titlesBatch, send) {
+            return
+          }
+        }
+      }()
+    }
+
+  feed:
+    for _, titlesBatch := range batches {
+      select {
+      case queue <- titlesBatch:
+      case <-ctx.Done():
+        break feed
+      }
+    }
+    close(queue)
+    wg.Wait()
+  }()
+
+  return c
+}
+
+// checkedLinksHere sends the pages linking to titles, out of those the API
+// says link to them now, whose links as fetch finds them lead to titles.
+// fetch hands the links of the only one of its titles to send, see fetchAll
+func (mw *MediaWiki) checkedLinksHere(ctx context.Context, titles []string, fetch func(context.Context, []string, func(Response) bool) bool) chan Response {
+  c := make(chan Response)
+
+  go func() {
+    defer close(c)
+    send := func(resp Response) bool {
+      select {
+      case c <- resp:
+        return resp.Err == nil
+      case <-ctx.Done():
+        return false
+      }
+    }
+
+    for here := range mw.LinksHere(ctx, titles) {
+      if here.Err != nil {
+        send(here)
+        return
+      }
+      // Pages linking in -> pages they link to
+      linking := map[string][]string{}
+      candidates := []string{}
+      for title, froms := range here.Links {
+        for _, from := range froms {
+          // Redirects link to nothing but their target
+          if here.Redirects[from] == title {
+            continue
+          }
+          if _, ok := linking[from]; !ok {
+            candidates = append(candidates, from)
+          }
+          linking[from] = append(linking[from], title)
+        }
+      }
+
+      resolve := func(title string) string {
+        if resolved, ok := here.Redirects[title]; ok {
+          return resolved
+        }
+        return title
+      }
+      checked := Response{Links: Links{}, Missing: here.Missing, Redirects: here.Redirects, Namespaces: here.Namespaces, Stats: here.Stats}
+      for from := range mw.fetchAll(ctx, batch(candidates, 1), fetch) {
+        if from.Err != nil {
+          send(from)
+          return
+        }
+        checked.Stats.add(from.Stats)
+        for page, body := range from.Links {
+          linked := map[string]bool{}
+          for _, to := range body {
+            linked[resolve(to)] = true
+          }
+          for _, title := range linking[page] {
+            if linked[title] {
+              checked.Links.add(title, page)
+            }
+          }
+        }
+      }
+      if ctx.Err() != nil || !send(checked) {
+        return
+      }
+    }
+  }()
+
+  return c
+}
+
+// pageResponse returns the Response of the links from page to titles, those
+// into the namespaces races go through that aren't boring. The namespaces of
+// page and titles are looked up in namespaces, or guessed from their prefix
+func (mw *MediaWiki) pageResponse(page string, titles []string, namespaces map[string]int, stats FetchStats) Response {
+  pageNS, ok := namespaces[page]
+  if !ok {
+    pageNS = titleNamespace(page)
+  }
+  resp := Response{Links: Links{}, Redirects: map[string]string{}, Namespaces: map[string]int{page: pageNS}, Stats: stats}
+  allowed := map[int]bool{}
+  numbers, _ := ParseNamespaces(mw.namespaces())
+  for _, ns := range numbers {
+    allowed[ns] = true
+  }
+
+  filter := mw.filter()
+  resp.Links[page] = []string{}
+  for _, title := range titles {
+    ns, ok := namespaces[title]
+    if !ok {
+      ns = titleNamespace(title)
+    }
+    if !allowed[ns] {
+      continue
+    }
+    if filter.Boring(resp.Namespaces[page], page) || filter.Boring(ns, title) {
+      resp.Stats.Filtered++
+      continue
+    }
+    resp.Links.add(page, title)
+    resp.Namespaces[title] = ns
+  }
+  return resp
+}
+
+// batchLinks fetches every page of results of the query of one batch of
+// titles, whose URL query builds given the continuation, handing them to
+// send. Returns false once the stream has ended
+func (mw *MediaWiki) batchLinks(ctx context.Context, prefix, prop string, query func(cont string) string, send func(Response) bool) bool {
+  // Holds Wikipedia's "continue" string if we have more results to fetch. Set after the first request
+  var cont string
+
+  // Continue paginating through results as long as Wikipedia is telling us to continue
+  for i := 0; i == 0 || len(cont) > 0; i++ {
+    queryURL := query(cont)
+    body, err := mw.get(ctx, queryURL)
+    if ctx.Err() != nil {
+      // Search was stopped, the request error is expected
+      return false
+    }
+    if err != nil {
+      return send(Response{Err: err})
+    }
+
+    // Parse the response
+    resp := linksResponse{prefix: prefix, prop: prop, filter: mw.filter()}
+    err = json.Unmarshal(body, &resp)
+    if err != nil {
+      return send(Response{Err: err})
+    }
+
+    stats := FetchStats{Requests: 1, Bytes: int64(len(body)), Filtered: resp.Filtered}
+    if i > 0 {
+      stats.Continuations = 1
+    }
+    if !send(Response{Links: resp.Links, Missing: resp.Missing, Redirects: resp.Redirects, Namespaces: resp.Namespaces, Stats: stats}) {
+      return false
+    }
+    cont = resp.Continue
+  }
+  return true
+}
+
+// -- api response format
+
+// linksResponse encapsulates Wikipedia's query API response with either
+// "links" or "linkshere" properties enumerated
+type linksResponse struct {
+  prefix   string
+  prop   string
+  // Drops boring links, none if nil
+  filter *Filter
+  Continue string
+  Links  Links
+  Missing []string
+  Redirects map[string]string
+  // Namespaces of the titles in Links
+  Namespaces map[string]int
+  // Links dropped as boring
+  Filtered int
+}
+
+func (r *linksResponse) UnmarshalJSON(b []byte) error {
+  data := map[string]interface{}{}
+  if err := json.Unmarshal(b, &data); err != nil {
+    return err
+  }
+  if err := extractError(data); err != nil {
+    return err
+  }
+
+  r.Continue = extractContinue(data, fmt.Sprintf("%scontinue", r.prefix))
+  r.Redirects = extractRedirects(data)
+  r.Namespaces = map[string]int{}
+  links, missing, filtered, err := extractLinks(data, r.prop, r.Redirects, r.Namespaces, r.filter)
+  if err != nil {
+    return err
+  }
+  r.Links = links
+  r.Missing = missing
+  r.Filtered = filtered
+
+  return nil
+}
+
+// inboundResponse is the part of the API's prop=linkshere response
+// CountLinksHere reads
+type inboundResponse struct {
+  Error map[string]interface{} `json:"error"`
+  Continue struct {
+    LHContinue string `json:"lhcontinue"`
+  } `json:"continue"`
+  Query struct {
+    Normalized []titleChange `json:"normalized"`
+    Redirects []titleChange `json:"redirects"`
+    Pages map[string]struct {
+      PageID int64 `json:"pageid"`
+      Title string `json:"title"`
+      LinksHere []json.RawMessage `json:"linkshere"`
+    } `json:"pages"`
+  } `json:"query"`
+}
+
+// titleChange is a title the API normalized or followed a redirect from
+type titleChange struct {
+  From string `json:"from"`
+  To string `json:"to"`
+}
+
+// extractError returns the error reported in a Wikipedia API response, if any
+func extractError(data map[string]interface{}) error {
+  errMap, ok := data["error"].(map[string]interface{})
+  if !ok {
+    return nil
+  }
+  code, _ := errMap["code"].(string)
+  info, _ := errMap["info"].(string)
+  if code == "ratelimited" {
+    return ErrRateLimited
+  }
+  return &ErrAPI{Code: code, Info: info}
+}
+
+// extractContinue takes as input a Wikipedia API query response and returns the "continue" string. If no continue string is set, an empty string is returned
+func extractContinue(data map[string]interface{}, subkey string) string {
+  if cont, ok := data["continue"].(map[string]interface{}); ok {
+    if contValue, ok := cont[subkey].(string); ok {
+      return contValue
+    }
+  }
+  return ""
+}
+
+// extractRedirects takes as input a Wikipedia API query response and returns the titles that were normalized or followed as a redirect, mapped to the title they finally resolved to
+func extractRedirects(data map[string]interface{}) map[string]string {
+  redirects := map[string]string{}
+
+  query, _ := data["query"].(map[string]interface{})
+  // Titles are normalized before redirects are resolved
+  for _, key := range []string{"normalized", "redirects"} {
+    entries, _ := query[key].([]interface{})
+    for _, entry := range entries {
+      entryMap, _ := entry.(map[string]interface{})
+      from, _ := entryMap["from"].(string)
+      to, _ := entryMap["to"].(string)
+      if len(from) > 0 && len(to) > 0 && from != to {
+        redirects[from] = to
+      }
+    }
+  }
+
+  // Point normalized titles at their redirect target
+  for from, to := range redirects {
+    if final, ok := redirects[to]; ok {
+      redirects[from] = final
+    }
+  }
+  return redirects
+}
+
+// extractLinks takes as input a Wikipedia API query response with either "links" or "linkshere" properties enumerated for a set of pages and returns a complete Links representation of that response, along with the titles of any pages that do not exist and the number of links dropped as boring by filter. Redirect pages listed by "linkshere" are added to redirects, and the namespace of every page linked or linking to namespaces
+func extractLinks(data map[string]interface{}, subkey string, redirects map[string]string, namespaces map[string]int, filter *Filter) (Links, []string, int, error) {
+  links := Links{}
+  missing := []string{}
+  filtered := 0
+
+  query, ok := data["query"].(map[string]interface{})
+  if !ok {
+    return nil, nil, 0, fmt.Errorf("unexpected API response: no query")
+  }
+  pages, ok := query["pages"].(map[string]interface{})
+  if !ok {
+    return nil, nil, 0, fmt.Errorf("unexpected API response: no pages")
+  }
+  for _, page := range pages {
+    pageMap, ok := page.(map[string]interface{})
+    if !ok {
+      return nil, nil, 0, fmt.Errorf("unexpected API response: page is %T", page)
+    }
+    fromTitle, _ := pageMap["title"].(string)
+    fromNS, _ := pageMap["ns"].(float64)
+    _, isMissing := pageMap["missing"]
+    _, isInvalid := pageMap["invalid"]
+    if isMissing || isInvalid {
+      missing = append(missing, fromTitle)
+      continue
+    }
+    linksSlice, ok := pageMap[subkey].([]interface{})
+    if ok {
+      for _, link := range linksSlice {
+        linkMap, ok := link.(map[string]interface{})
+        if !ok {
+          return nil, nil, 0, fmt.Errorf("unexpected API response: link is %T", link)
+        }
+        if title, ok := linkMap["title"].(string); ok {
+          if _, isRedirect := linkMap["redirect"]; isRedirect && subkey == "linkshere" {
+            redirects[title] = fromTitle
+          }
+          ns, _ := linkMap["ns"].(float64)
+          if filter.Boring(int(fromNS), fromTitle) || filter.Boring(int(ns), title) {
+            filtered++
+            continue
+          }
+          links.add(fromTitle, title)
+          namespaces[fromTitle] = int(fromNS)
+          namespaces[title] = int(ns)
+        }
+      }
+    }
+  }
+  return links, missing, filtered, nil
+}
@@ -0,0 +1,150 @@
+package links
+
+import (
+  "context"
+  "sort"
+  "strings"
+)
+
+// MemoryGraph is a LinkSource over a fixed, in-memory set of links. Pages
+// that appear nowhere in it do not exist
+type MemoryGraph struct {
+  links Links
+  linksHere Links
+  redirects map[string]string
+}
+
+// NewMemoryGraph returns a MemoryGraph of the given page -> linked pages.
+// Links are filtered the same way as Wikipedia's
+func NewMemoryGraph(links Links) *MemoryGraph {
+  g := &MemoryGraph{links: Links{}, linksHere: Links{}, redirects: map[string]string{}}
+  for from, tos := range links {
+    if _, ok := g.links[from]; !ok {
+      g.links[from] = []string{}
+    }
+    for _, to := range tos {
+      if DefaultFilter.Boring(titleNamespace(from), from) || DefaultFilter.Boring(titleNamespace(to), to) {
+        continue
+      }
+      g.links.add(from, to)
+      g.linksHere.add(to, from)
+    }
+  }
+  return g
+}
+
+// Redirect makes alias resolve to title, the way a Wikipedia redirect page does
+func (g *MemoryGraph) Redirect(alias, title string) {
+  g.redirects[alias] = title
+}
+
+// LinksFrom sends the links from titles as a single Response
+func (g *MemoryGraph) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return respond(ctx, titles, g.links, g.redirects, nil, g.exists)
+}
+
+// LinksHere sends the links to titles as a single Response, those to the
+// redirects to them included
+func (g *MemoryGraph) LinksHere(ctx context.Context, titles []string) chan Response {
+  here := Links{}
+  for _, title := range titles {
+    if resolved, ok := g.redirects[title]; ok {
+      title = resolved
+    }
+    if g.exists(title) {
+      here[title] = append([]string{}, g.linksHere[title]...)
+    }
+  }
+  for alias, title := range g.redirects {
+    if _, ok := here[title]; ok {
+      for _, from := range g.linksHere[alias] {
+        here.add(title, from)
+      }
+    }
+  }
+  return respond(ctx, titles, here, g.redirects, nil, g.exists)
+}
+
+// Find reports which titles are missing and which redirect
+func (g *MemoryGraph) Find(ctx context.Context, titles []string) Response {
+  return find(ctx, titles, g.redirects, g.exists)
+}
+
+// Suggest returns up to limit titles containing title, ignoring case
+func (g *MemoryGraph) Suggest(ctx context.Context, title string, limit int) ([]string, error) {
+  return suggest(title, limit, g.links, g.linksHere), nil
+}
+
+func (g *MemoryGraph) exists(title string) bool {
+  _, from := g.links[title]
+  _, to := g.linksHere[title]
+  return from || to
+}
+
+// respond sends the entries of links for titles as a single Response, after
+// resolving redirects, listing titles that don't exist as missing. The
+// namespaces of the pages sent are looked up in namespaces, if any
+func respond(ctx context.Context, titles []string, links Links, redirects map[string]string, namespaces map[string]int, exists func(string) bool) chan Response {
+  c := make(chan Response, 1)
+  resp := Response{Links: Links{}, Missing: []string{}, Redirects: map[string]string{}, Namespaces: map[string]int{}}
+  for _, title := range titles {
+    if resolved, ok := redirects[title]; ok {
+      resp.Redirects[title] = resolved
+      title = resolved
+    }
+    if !exists(title) {
+      resp.Missing = append(resp.Missing, title)
+      continue
+    }
+    if tos, ok := links[title]; ok && len(tos) > 0 {
+      resp.Links[title] = tos
+      for _, to := range tos {
+        if ns, ok := namespaces[to]; ok {
+          resp.Namespaces[to] = ns
+        }
+      }
+    }
+    if ns, ok := namespaces[title]; ok {
+      resp.Namespaces[title] = ns
+    }
+  }
+  if ctx.Err() == nil {
+    c <- resp
+  }
+  close(c)
+  return c
+}
+
+// find is respond for sources that know every page up front, without links
+func find(ctx context.Context, titles []string, redirects map[string]string, exists func(string) bool) Response {
+  resp, ok := <-respond(ctx, titles, Links{}, redirects, nil, exists)
+  if !ok {
+    return Response{Err: ctx.Err()}
+  }
+  resp.Links = nil
+  return resp
+}
+
+// suggest returns up to limit of the pages in sets whose title contains title,
+// ignoring case
+func suggest(title string, limit int, sets ...Links) []string {
+  title = strings.ToLower(title)
+  found := map[string]bool{}
+  for _, set := range sets {
+    for candidate := range set {
+      if strings.Contains(strings.ToLower(candidate), title) {
+        found[candidate] = true
+      }
+    }
+  }
+
+  titles := []string{}
+  for candidate := range found {
+    titles = append(titles, candidate)
+  }
+  sort.Strings(titles)
+  if len(titles) > limit {
+    titles = titles[:limit]
+  }
+  return titles
+}
@@ -0,0 +1,104 @@
+package links
+
+import (
+  "context"
+  "errors"
+  "reflect"
+  "testing"
+)
+
+func TestMemoryGraph(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "A": {"B", "C", "A"},
+    "B": {"C"},
+    "D": {},
+  })
+
+  resp := <-g.LinksFrom(context.Background(), []string{"A", "C", "D", "E"})
+  expectFrom := Links{"A": {"B", "C"}}
+  if !reflect.DeepEqual(expectFrom, resp.Links) {
+    t.Errorf("expected: %#v\ngot: %#v", expectFrom, resp.Links)
+  }
+  if !reflect.DeepEqual([]string{"E"}, resp.Missing) {
+    t.Errorf("expected E to be missing, got: %#v", resp.Missing)
+  }
+
+  resp = <-g.LinksHere(context.Background(), []string{"C"})
+  if len(resp.Links["C"]) != 2 {
+    t.Errorf("expected 2 links to C, got: %#v", resp.Links)
+  }
+}
+
+func TestMemoryGraph_Search(t *testing.T) {
+  g := NewMemoryGraph(chain(chain(Links{}, "From", 20), "To", 20))
+  g.links.add("From19", "To0")
+  g.linksHere.add("To0", "From19")
+
+  pg := NewPageGraph(g)
+  path, err := pg.Search("From0", "To19")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(path) != 40 || path[0] != "From0" || path[39] != "To19" {
+    t.Errorf("unexpected path: %#v", path)
+  }
+
+  pg = NewPageGraph(g)
+  if _, err = pg.Search("To0", "From0"); !errors.Is(err, ErrNoPath) {
+    t.Errorf("expected no path, got: %v", err)
+  }
+}
+
+func TestMemoryGraph_Redirects(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "Start":     {"King George"},
+    "George IV": {"Target"},
+  })
+  g.Redirect("King George", "George IV")
+
+  pg := NewPageGraph(g)
+  path, err := pg.Search("Start", "Target")
+  if err != nil {
+    t.Fatal(err)
+  }
+  expect := []string{"Start", "George IV", "Target"}
+  if !reflect.DeepEqual(expect, path) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, path)
+  }
+
+  pg = NewPageGraph(g)
+  path, err = pg.Search("King George", "Target")
+  if err != nil {
+    t.Fatal(err)
+  }
+  expect = []string{"George IV", "Target"}
+  if !reflect.DeepEqual(expect, path) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, path)
+  }
+  if resolved := pg.Resolve("King George"); resolved != "George IV" {
+    t.Errorf("expected King George to resolve to George IV, got: %#v", resolved)
+  }
+}
+
+func TestMemoryGraph_PageNotFound(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "Robert Frost": {"Poetry"},
+    "Robert Burns": {"Poetry"},
+    "Ada Lovelace": {"Poetry"},
+  })
+
+  pg := NewPageGraph(g)
+  _, err := pg.Search("Ada Lovelace", "robert")
+
+  var notFound *PageNotFoundError
+  if !errors.As(err, &notFound) || !errors.Is(err, ErrPageMissing) {
+    t.Fatalf("expected page not found, got: %v", err)
+  }
+  if notFound.Title != "robert" {
+    t.Errorf("unexpected title: %#v", notFound.Title)
+  }
+  expect := []string{"Robert Burns", "Robert Frost"}
+  if !reflect.DeepEqual(expect, notFound.Suggestions) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, notFound.Suggestions)
+  }
+}
@@ -0,0 +1,93 @@
+package links
+
+import (
+  "context"
+  "math"
+  "sort"
+)
+
+// SearchAll is like SearchContext but finds every shortest path instead of
+// one of them. It returns up to limit of them, all if limit is 0, in
+// a stable order, along with how many there are in total (capped at the
+// largest int)
+func (pg *PageGraph) SearchAll(ctx context.Context, from, to string, limit int, options ...SearchOptions) ([][]string, int, error) {
+  result, err := pg.searchResult(ctx, from, to, limit, searchOptions(options))
+  return result.Paths, result.TotalPaths, err
+}
+
+// allPaths returns up to limit of the paths through the meetings of forward
+// and backward, and how many there are
+func allPaths(forward, backward *layers, meetings []string, limit int) ([][]string, int) {
+  counts := map[string]int{}
+  var count func(l *layers, page string) int
+  count = func(l *layers, page string) int {
+    if len(l.parents[page]) == 0 {
+      return 1
+    }
+    key := l.direction + "\x00" + page
+    if n, ok := counts[key]; ok {
+      return n
+    }
+    n := 0
+    for _, parent := range l.parents[page] {
+      n = saturatingAdd(n, count(l, parent))
+    }
+    counts[key] = n
+    return n
+  }
+
+  total := 0
+  for _, page := range meetings {
+    total = saturatingAdd(total, saturatingMul(count(forward, page), count(backward, page)))
+  }
+
+  // Chains of pages from page back to where l started, in sorted order
+  var chains func(l *layers, page string, chain []string, each func([]string) bool) bool
+  chains = func(l *layers, page string, chain []string, each func([]string) bool) bool {
+    chain = append(chain, page)
+    parents := append([]string{}, l.parents[page]...)
+    if len(parents) == 0 {
+      return each(chain)
+    }
+    sort.Strings(parents)
+    for _, parent := range parents {
+      if !chains(l, parent, chain, each) {
+        return false
+      }
+    }
+    return true
+  }
+
+  paths := [][]string{}
+  for _, page := range meetings {
+    done := !chains(forward, page, nil, func(head []string) bool {
+      return chains(backward, page, nil, func(tail []string) bool {
+        path := make([]string, 0, len(head)+len(tail)-1)
+        for i := len(head) - 1; i >= 0; i-- {
+          path = append(path, head[i])
+        }
+        path = append(path, tail[1:]...)
+        paths = append(paths, path)
+        return limit <= 0 || len(paths) < limit
+      })
+    })
+    if done {
+      break
+    }
+  }
+  return paths, total
+}
+
+func saturatingAdd(a, b int) int {
+  if a > math.MaxInt - b {
+    return math.MaxInt
+  }
+  return a + b
+}
+
+func saturatingMul(a, b int) int {
+  if a != 0 && b > math.MaxInt / a {
+    return math.MaxInt
+  }
+  return a * b
+}
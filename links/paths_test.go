@@ -0,0 +1,109 @@
+package links
+
+import (
+  "context"
+  "errors"
+  "reflect"
+  "testing"
+)
+
+func TestSearchAll(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "A":  {"B1", "B2", "B3", "X"},
+    "B1": {"C1"},
+    "B2": {"C1", "C2"},
+    "B3": {"C2"},
+    "C1": {"D"},
+    "C2": {"D"},
+    "X":  {"Y"},
+    "Y":  {"Z"},
+    "Z":  {"D"},
+  })
+  expect := [][]string{
+    {"A", "B1", "C1", "D"},
+    {"A", "B2", "C1", "D"},
+    {"A", "B2", "C2", "D"},
+    {"A", "B3", "C2", "D"},
+  }
+
+  pg := NewPageGraph(g)
+  paths, total, err := pg.SearchAll(context.Background(), "A", "D", 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if total != 4 || !reflect.DeepEqual(expect, paths) {
+    t.Errorf("expected %d paths: %#v\ngot %d: %#v", len(expect), expect, total, paths)
+  }
+
+  // The same paths every time, up to the limit
+  for i := 0; i < 5; i++ {
+    pg = NewPageGraph(g)
+    paths, total, err = pg.SearchAll(context.Background(), "A", "D", 2)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if total != 4 || !reflect.DeepEqual(expect[:2], paths) {
+      t.Errorf("expected 2 of 4 paths: %#v\ngot %d of %d: %#v", expect[:2], len(paths), total, paths)
+    }
+  }
+}
+
+func TestSearchAll_Redirects(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "Start":     {"King George", "George IV"},
+    "George IV": {"Target"},
+  })
+  g.Redirect("King George", "George IV")
+  g.Redirect("Beginning", "Start")
+
+  pg := NewPageGraph(g)
+  paths, total, err := pg.SearchAll(context.Background(), "Beginning", "Target", 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  expect := [][]string{{"Start", "George IV", "Target"}}
+  if total != 1 || !reflect.DeepEqual(expect, paths) {
+    t.Errorf("expected: %#v\ngot %d: %#v", expect, total, paths)
+  }
+}
+
+func TestSearchAll_NoPath(t *testing.T) {
+  g := NewMemoryGraph(Links{"A": {"B"}, "C": {"A"}})
+
+  pg := NewPageGraph(g)
+  if _, _, err := pg.SearchAll(context.Background(), "A", "C", 0); !errors.Is(err, ErrNoPath) {
+    t.Errorf("expected no path, got: %v", err)
+  }
+
+  pg = NewPageGraph(g)
+  paths, total, err := pg.SearchAll(context.Background(), "A", "A", 0)
+  if err != nil || total != 1 || !reflect.DeepEqual([][]string{{"A"}}, paths) {
+    t.Errorf("expected a path to itself, got %d: %#v, %v", total, paths, err)
+  }
+
+  pg = NewPageGraph(g)
+  var notFound *PageNotFoundError
+  if _, _, err := pg.SearchAll(context.Background(), "A", "Nowhere", 0); !errors.As(err, &notFound) || notFound.Title != "Nowhere" {
+    t.Errorf("expected Nowhere not to be found, got: %v", err)
+  }
+}
+
+func TestAllPaths_Total(t *testing.T) {
+  // 2^20 paths through 20 diamonds in a row, too many to list
+  graph := Links{}
+  for i := 0; i < 20; i++ {
+    from, to := string(rune('a'+i)), string(rune('a'+i+1))
+    graph[from] = []string{from + "1", from + "2"}
+    graph[from+"1"] = []string{to}
+    graph[from+"2"] = []string{to}
+  }
+
+  pg := NewPageGraph(NewMemoryGraph(graph))
+  paths, total, err := pg.SearchAll(context.Background(), "a", "u", 10)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if total != 1<<20 || len(paths) != 10 || len(paths[0]) != 41 {
+    t.Errorf("expected 10 of %d paths of 41 pages, got %d of %d: %#v", 1<<20, len(paths), total, paths[0])
+  }
+}
@@ -0,0 +1,305 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "html"
+  "net/url"
+  "regexp"
+  "strings"
+  "sync"
+  "time"
+)
+
+var (
+  // Parts of wikitext whose links aren't rendered: comments, and the content
+  // of tags shown as is
+  unrenderedPattern = regexp.MustCompile(`(?is)<!--.*?-->|<(nowiki|pre|math|syntaxhighlight|source)\b[^>]*>.*?</(nowiki|pre|math|syntaxhighlight|source)>`)
+  redirectPattern = regexp.MustCompile(`(?i)^\s*#redirect\s*:?\s*\[\[([^\[\]|]+)`)
+  // Prefixes of links to other wikis, eg. "de" or "wikt", which are lower
+  // case unlike those of titles
+  interwikiPattern = regexp.MustCompile(`^:?[a-z][a-z-]*:`)
+)
+
+// wikiNamespaces are the names of the namespaces of a wiki, which the titles
+// links point at are written with
+type wikiNamespaces struct {
+  // Names titles are written with, by number
+  names map[int]string
+  // Numbers by every name links may use: the wiki's own, the English one and
+  // aliases, first letter upper case
+  numbers map[string]int
+}
+
+// englishNamespaces are those of English Wikipedia, see titleNamespaces
+var englishNamespaces = wikiNamespaces{
+  names: map[int]string{-2: "Media", -1: "Special"},
+  numbers: map[string]int{"Media": -2, "Special": -1, "Project": 4, "Project talk": 5, "Image": 6, "Image talk": 7},
+}
+
+func init() {
+  for name, ns := range titleNamespaces {
+    englishNamespaces.names[ns] = name
+    englishNamespaces.numbers[name] = ns
+  }
+}
+
+// ParseWikitextLinks returns the titles of the wiki pages text, the wikitext
+// of a page on English Wikipedia, links to, in order and without repeats.
+// Categories the page is in, files it shows and links to other wikis aren't
+// links to pages, and links of the templates it uses aren't in its wikitext
+func ParseWikitextLinks(text string) []string {
+  titles, _ := parseWikitextLinks(text, englishNamespaces)
+  return titles
+}
+
+// parseWikitextLinks returns the titles text, the wikitext of a page on the
+// wiki of namespaces, links to like ParseWikitextLinks, and their namespaces
+func parseWikitextLinks(text string, namespaces wikiNamespaces) ([]string, map[string]int) {
+  text = unrenderedPattern.ReplaceAllString(text, "")
+  titles := []string{}
+  linked := map[string]int{}
+  for _, match := range wikiLinkRegexp.FindAllStringSubmatch(text, -1) {
+    target := strings.Join(strings.Fields(html.UnescapeString(match[1])), " ")
+    // Template parameters and subpages
+    if strings.ContainsAny(target, "{}<>") || strings.HasPrefix(target, "/") {
+      continue
+    }
+    // Links to other wikis, unless their prefix is a namespace in lower case
+    if prefix := interwikiPattern.FindString(target); len(prefix) > 0 {
+      if _, ok := namespaces.numbers[upperFirst(strings.Trim(prefix, ":"))]; !ok {
+        continue
+      }
+    }
+    title, ns := wikilinkTitle(target, namespaces.names, namespaces.numbers, false)
+    if _, seen := linked[title]; len(title) > 0 && !seen {
+      linked[title] = ns
+      titles = append(titles, title)
+    }
+  }
+  return titles, linked
+}
+
+// wikitextRedirect returns the title text, the wikitext of a redirect on the
+// wiki of namespaces, redirects to
+func wikitextRedirect(text string, namespaces wikiNamespaces) (string, bool) {
+  match := redirectPattern.FindStringSubmatch(text)
+  if match == nil {
+    return "", false
+  }
+  title, _ := wikilinkTitle(html.UnescapeString(match[1]), namespaces.names, namespaces.numbers, true)
+  return title, len(title) > 0
+}
+
+// Most redirects followed from a title, in case of a loop
+const maxRedirects = 4
+
+// RevisionSource is a LinkSource racing on the revisions of pages current at
+// Config.AsOf, following the links of their wikitext, so races can be run
+// again and compared as Wikipedia changes. The API returns the old revision
+// of one page per request, and only knows which pages link to another now:
+// LinksHere checks the old revision of each, missing those that linked in
+// then but no longer do
+type RevisionSource struct {
+  *MediaWiki
+
+  mu sync.Mutex
+  // Names of the wiki's namespaces, once loaded
+  names *wikiNamespaces
+}
+
+// NewRevisionSource returns a RevisionSource reading the old revisions of mw
+func NewRevisionSource(mw *MediaWiki) *RevisionSource {
+  return &RevisionSource{MediaWiki: mw}
+}
+
+// LinksFrom sends the links of each of titles as a Response of its own
+func (s *RevisionSource) LinksFrom(ctx context.Context, titles []string) chan Response {
+  return s.fetchAll(ctx, batch(titles, 1), s.pageLinks)
+}
+
+// LinksHere sends the pages linking to titles then, out of those the API
+// says link to them now
+func (s *RevisionSource) LinksHere(ctx context.Context, titles []string) chan Response {
+  return s.checkedLinksHere(ctx, titles, s.pageLinks)
+}
+
+// revisionsResponse is the part of the API's prop=revisions response we read
+type revisionsResponse struct {
+  Error map[string]interface{} `json:"error"`
+  Query struct {
+    Pages []struct {
+      NS int `json:"ns"`
+      Title string `json:"title"`
+      Missing bool `json:"missing"`
+      Invalid bool `json:"invalid"`
+      Revisions []struct {
+        Slots struct {
+          Main struct {
+            Content string `json:"content"`
+          } `json:"main"`
+        } `json:"slots"`
+      } `json:"revisions"`
+    } `json:"pages"`
+  } `json:"query"`
+}
+
+// siteinfoResponse is the part of the API's meta=siteinfo response we read
+type siteinfoResponse struct {
+  Error map[string]interface{} `json:"error"`
+  Query struct {
+    Namespaces map[string]struct {
+      ID int `json:"id"`
+      Name string `json:"name"`
+      Canonical string `json:"canonical"`
+    } `json:"namespaces"`
+    NamespaceAliases []struct {
+      ID int `json:"id"`
+      Alias string `json:"alias"`
+    } `json:"namespacealiases"`
+  } `json:"query"`
+}
+
+// siteNamespaces returns the names of the namespaces of the wiki, asking the
+// API for them the first time, as they differ from one language to another
+func (s *RevisionSource) siteNamespaces(ctx context.Context) (wikiNamespaces, FetchStats, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if s.names != nil {
+    return *s.names, FetchStats{}, nil
+  }
+
+  params := url.Values{
+    "action":        {"query"},
+    "format":        {"json"},
+    "formatversion": {"2"},
+    "meta":          {"siteinfo"},
+    "siprop":        {"namespaces|namespacealiases"},
+  }
+  body, err := s.get(ctx, s.buildURL(params))
+  if err != nil {
+    return wikiNamespaces{}, FetchStats{}, err
+  }
+  stats := FetchStats{Requests: 1, Bytes: int64(len(body))}
+
+  var resp siteinfoResponse
+  if err := json.Unmarshal(body, &resp); err != nil {
+    return wikiNamespaces{}, stats, err
+  }
+  if resp.Error != nil {
+    return wikiNamespaces{}, stats, extractError(map[string]interface{}{"error": resp.Error})
+  }
+  if len(resp.Query.Namespaces) == 0 {
+    return wikiNamespaces{}, stats, fmt.Errorf("no namespaces in the siteinfo of %s", s.Endpoint)
+  }
+  names := wikiNamespaces{names: map[int]string{}, numbers: map[string]int{}}
+  for _, ns := range resp.Query.Namespaces {
+    names.names[ns.ID] = ns.Name
+    for _, name := range []string{ns.Name, ns.Canonical} {
+      if len(name) > 0 {
+        names.numbers[name] = ns.ID
+      }
+    }
+  }
+  for _, alias := range resp.Query.NamespaceAliases {
+    names.numbers[alias.Alias] = alias.ID
+  }
+  s.names = &names
+  return names, stats, nil
+}
+
+// pageRevision is the revision of a page current at some time
+type pageRevision struct {
+  // Title of the page, after normalization
+  Title string
+  NS int
+  // Whether the page existed then, and still does
+  Exists bool
+  Text string
+}
+
+// revision fetches the wikitext of the revision of title current at AsOf
+func (s *RevisionSource) revision(ctx context.Context, title string) (pageRevision, FetchStats, error) {
+  params := url.Values{
+    "action":        {"query"},
+    "format":        {"json"},
+    "formatversion": {"2"},
+    "prop":          {"revisions"},
+    "titles":        {title},
+    "rvprop":        {"content"},
+    "rvslots":       {"main"},
+    "rvlimit":       {"1"},
+    "rvdir":         {"older"},
+    "rvstart":       {s.AsOf.UTC().Format(time.RFC3339)},
+  }
+  body, err := s.get(ctx, s.buildURL(params))
+  if err != nil {
+    return pageRevision{}, FetchStats{}, err
+  }
+  stats := FetchStats{Requests: 1, Bytes: int64(len(body))}
+
+  var resp revisionsResponse
+  if err := json.Unmarshal(body, &resp); err != nil {
+    return pageRevision{}, stats, err
+  }
+  if resp.Error != nil {
+    return pageRevision{}, stats, extractError(map[string]interface{}{"error": resp.Error})
+  }
+  if len(resp.Query.Pages) == 0 {
+    return pageRevision{Title: title}, stats, nil
+  }
+  page := resp.Query.Pages[0]
+  rev := pageRevision{Title: page.Title, NS: page.NS}
+  // Pages created later have no revision that old
+  if !page.Missing && !page.Invalid && len(page.Revisions) > 0 {
+    rev.Exists = true
+    rev.Text = page.Revisions[0].Slots.Main.Content
+  }
+  return rev, stats, nil
+}
+
+// pageLinks fetches the revision of the only one of titles current at AsOf,
+// following the redirects it was then, and hands its links to send. Returns
+// false once the stream has ended
+func (s *RevisionSource) pageLinks(ctx context.Context, titles []string, send func(Response) bool) bool {
+  namespaces, stats, err := s.siteNamespaces(ctx)
+  if ctx.Err() != nil {
+    return false
+  }
+  if err != nil {
+    return send(Response{Err: err})
+  }
+  // Titles that led to the page, which all redirect to it
+  aliases := []string{}
+  title := titles[0]
+  for i := 0; ; i++ {
+    rev, revStats, err := s.revision(ctx, title)
+    stats.add(revStats)
+    if ctx.Err() != nil {
+      return false
+    }
+    if err != nil {
+      return send(Response{Err: err})
+    }
+    if !rev.Exists {
+      return send(Response{Links: Links{}, Missing: []string{titles[0]}, Stats: stats})
+    }
+    if rev.Title != title {
+      aliases = append(aliases, title)
+    }
+
+    target, redirect := wikitextRedirect(rev.Text, namespaces)
+    if !redirect || i == maxRedirects {
+      linked, linkedNS := parseWikitextLinks(rev.Text, namespaces)
+      linkedNS[rev.Title] = rev.NS
+      resp := s.pageResponse(rev.Title, linked, linkedNS, stats)
+      for _, alias := range aliases {
+        resp.Redirects[alias] = rev.Title
+      }
+      return send(resp)
+    }
+    aliases = append(aliases, rev.Title)
+    title = target
+  }
+}
@@ -0,0 +1,294 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "reflect"
+  "sort"
+  "strconv"
+  "strings"
+  "testing"
+  "time"
+)
+
+// revisionHistory is a recorded prop=revisions response of every revision of
+// a page, newest first
+type revisionHistory struct {
+  Query struct {
+    Pages []map[string]interface{} `json:"pages"`
+  } `json:"query"`
+}
+
+func readRevisions(t *testing.T) map[string]map[string]interface{} {
+  files, err := filepath.Glob(filepath.Join("testdata", "revisions", "*.json"))
+  if err != nil || len(files) == 0 {
+    t.Fatalf("no revisions: %v", err)
+  }
+  pages := map[string]map[string]interface{}{}
+  for _, file := range files {
+    data, err := ioutil.ReadFile(file)
+    if err != nil {
+      t.Fatal(err)
+    }
+    var history revisionHistory
+    if err := json.Unmarshal(data, &history); err != nil {
+      t.Fatalf("%s: %v", file, err)
+    }
+    page := history.Query.Pages[0]
+    pages[page["title"].(string)] = page
+  }
+  return pages
+}
+
+// revisionText returns the wikitext of a recorded revision
+func revisionText(revision interface{}) string {
+  slots := revision.(map[string]interface{})["slots"].(map[string]interface{})
+  return slots["main"].(map[string]interface{})["content"].(string)
+}
+
+// serveSiteinfo answers a meta=siteinfo query with namespaces, their other
+// names as aliases
+func serveSiteinfo(w http.ResponseWriter, namespaces wikiNamespaces) {
+  names := map[string]interface{}{}
+  for ns, name := range namespaces.names {
+    names[strconv.Itoa(ns)] = map[string]interface{}{"id": ns, "name": name}
+  }
+  aliases := []map[string]interface{}{}
+  for name, ns := range namespaces.numbers {
+    if namespaces.names[ns] != name {
+      aliases = append(aliases, map[string]interface{}{"id": ns, "alias": name})
+    }
+  }
+  json.NewEncoder(w).Encode(map[string]interface{}{
+    "batchcomplete": true,
+    "query":         map[string]interface{}{"namespaces": names, "namespacealiases": aliases},
+  })
+}
+
+// revisionWiki serves the recorded revisions under prop=revisions queries,
+// the latest one current at rvstart, and their latest links under "links" and
+// "linkshere" queries the way fakeWiki does
+func revisionWiki(t *testing.T) *httptest.Server {
+  pages := readRevisions(t)
+  graph := map[string][]string{}
+  for title, page := range pages {
+    text := revisionText(page["revisions"].([]interface{})[0])
+    if _, redirect := wikitextRedirect(text, englishNamespaces); !redirect {
+      graph[title] = ParseWikitextLinks(text)
+    }
+  }
+  api := fakeWiki(graph, nil)
+
+  return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    if query.Get("meta") == "siteinfo" {
+      serveSiteinfo(w, englishNamespaces)
+      return
+    }
+    if query.Get("prop") != "revisions" {
+      api.Config.Handler.ServeHTTP(w, r)
+      return
+    }
+
+    requested := query.Get("titles")
+    title := upperFirst(strings.Replace(requested, "_", " ", -1))
+    result := map[string]interface{}{}
+    if title != requested {
+      result["normalized"] = []map[string]interface{}{{"fromencoded": false, "from": requested, "to": title}}
+    }
+    recorded, ok := pages[title]
+    if !ok {
+      result["pages"] = []map[string]interface{}{{"ns": 0, "title": title, "missing": true}}
+      json.NewEncoder(w).Encode(map[string]interface{}{"batchcomplete": true, "query": result})
+      return
+    }
+    page := map[string]interface{}{"pageid": recorded["pageid"], "ns": recorded["ns"], "title": title}
+    for _, revision := range recorded["revisions"].([]interface{}) {
+      if revision.(map[string]interface{})["timestamp"].(string) <= query.Get("rvstart") {
+        page["revisions"] = []interface{}{revision}
+        break
+      }
+    }
+    result["pages"] = []map[string]interface{}{page}
+    json.NewEncoder(w).Encode(map[string]interface{}{"batchcomplete": true, "query": result})
+  }))
+}
+
+func TestParseWikitextLinks(t *testing.T) {
+  page := readRevisions(t)["Ada Lovelace"]
+  text := revisionText(page["revisions"].([]interface{})[1])
+
+  // Not the comment, nowiki, section, other wikis, categories nor files
+  expect := []string{
+    "London", "Mathematician", "Charles Babbage", "Analytical Engine", "Oxford University Press",
+    "Alfred Edward Chalon", "Lord Byron", "Note G", "Category:Women mathematicians",
+  }
+  if got := ParseWikitextLinks(text); !reflect.DeepEqual(expect, got) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, got)
+  }
+
+  tests := []struct {
+    text   string
+    expect []string
+  }{
+    {"[[category:Foo]] [[:category:foo]] [[wikipedia:About]] [[user talk:Bar|bar]]", []string{"Category:Foo", "Wikipedia:About", "User talk:Bar"}},
+    {"[[image:x.png|thumb|A [[Inner link]]]] [[Media:y.ogg]] [[File:z.svg]]", []string{"Inner link"}},
+    {"[[{{{1}}}]] [[/Subpage]] [[fr:Ada]] [[ada   lovelace]] [[Ada_lovelace|Ada]]", []string{"Ada lovelace"}},
+    {"<pre>[[Pre]]</pre><math>[[Math]]</math>[[Après]] [[Caf&eacute;]]", []string{"Après", "Café"}},
+  }
+  for i, test := range tests {
+    if got := ParseWikitextLinks(test.text); !reflect.DeepEqual(test.expect, got) {
+      t.Errorf("tests[%d]: expected: %#v, got: %#v", i, test.expect, got)
+    }
+  }
+
+  for text, expect := range map[string]string{
+    "#REDIRECT [[Ada Lovelace]]":        "Ada Lovelace",
+    "#redirect:[[ada_Lovelace#Legacy]]": "Ada Lovelace",
+    "#REDIRECT [[Category:Mathematicians]]": "Category:Mathematicians",
+    "Not a #REDIRECT [[Ada Lovelace]]":  "",
+  } {
+    if got, _ := wikitextRedirect(text, englishNamespaces); got != expect {
+      t.Errorf("%#v: expected a redirect to %#v, got %#v", text, expect, got)
+    }
+  }
+}
+
+func TestRevisionSource_LinksFrom(t *testing.T) {
+  server := revisionWiki(t)
+  defer server.Close()
+
+  asOf := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+  source := NewRevisionSource(testWiki(Config{Endpoint: server.URL, AsOf: asOf}))
+  links, missing, redirects := Links{}, []string{}, map[string]string{}
+  for resp := range source.LinksFrom(context.Background(), []string{"Ada Byron", "ada_Lovelace", "Women in computing", "Nowhere"}) {
+    if resp.Err != nil {
+      t.Fatal(resp.Err)
+    }
+    for from, tos := range resp.Links {
+      links[from] = tos
+    }
+    missing = append(missing, resp.Missing...)
+    for from, to := range resp.Redirects {
+      redirects[from] = to
+    }
+  }
+
+  // The revision of 2023, which didn't link to Alan Turing yet
+  if tos := links["Ada Lovelace"]; len(links) != 1 || !contains(tos, "Analytical Engine") || contains(tos, "Alan Turing") {
+    t.Errorf("unexpected links: %#v", links)
+  }
+  // Women in computing was written later
+  sort.Strings(missing)
+  if !reflect.DeepEqual([]string{"Nowhere", "Women in computing"}, missing) {
+    t.Errorf("unexpected missing pages: %#v", missing)
+  }
+  expect := map[string]string{"Ada Byron": "Ada Lovelace", "ada_Lovelace": "Ada Lovelace"}
+  if !reflect.DeepEqual(expect, redirects) {
+    t.Errorf("expected: %#v\ngot: %#v", expect, redirects)
+  }
+}
+
+func TestRevisionSource_Namespaces(t *testing.T) {
+  // German Wikipedia, whose namespaces go by other names
+  de := wikiNamespaces{
+    names:   map[int]string{-2: "Medium", 0: "", 2: "Benutzer", 6: "Datei", 14: "Kategorie"},
+    numbers: map[string]int{"Medium": -2, "Benutzer": 2, "Datei": 6, "Kategorie": 14, "Media": -2, "User": 2, "File": 6, "Category": 14, "Bild": 6},
+  }
+  text := "[[Berlin]] [[Kategorie:Stadt]] [[Datei:Karte.svg|mini]] [[bild:Foto.jpg]] [[Medium:Ton.ogg]] [[benutzer:Ada]] [[:Kategorie:Hauptstadt]]"
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Query().Get("meta") == "siteinfo" {
+      serveSiteinfo(w, de)
+      return
+    }
+    page := map[string]interface{}{"ns": 0, "title": "Potsdam", "revisions": []interface{}{
+      map[string]interface{}{"slots": map[string]interface{}{"main": map[string]interface{}{"content": text}}},
+    }}
+    json.NewEncoder(w).Encode(map[string]interface{}{"query": map[string]interface{}{"pages": []interface{}{page}}})
+  }))
+  defer server.Close()
+
+  requests := 0
+  source := NewRevisionSource(testWiki(Config{Endpoint: server.URL, AsOf: time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), Namespaces: "0|2|14"}))
+  for _, title := range []string{"Potsdam", "Potsdam"} {
+    for resp := range source.LinksFrom(context.Background(), []string{title}) {
+      if resp.Err != nil {
+        t.Fatal(resp.Err)
+      }
+      requests += resp.Stats.Requests
+      // Categories the page is in and files it shows aren't links
+      expect := Links{"Potsdam": {"Berlin", "Benutzer:Ada", "Kategorie:Hauptstadt"}}
+      if !reflect.DeepEqual(expect, resp.Links) {
+        t.Errorf("expected: %#v, got: %#v", expect, resp.Links)
+      }
+      if ns := resp.Namespaces; ns["Berlin"] != 0 || ns["Benutzer:Ada"] != 2 || ns["Kategorie:Hauptstadt"] != 14 {
+        t.Errorf("unexpected namespaces: %#v", ns)
+      }
+    }
+  }
+  // The namespaces are asked for once
+  if requests != 3 {
+    t.Errorf("expected 3 requests, got %d", requests)
+  }
+}
+
+func TestRevisionSource_Search(t *testing.T) {
+  server := revisionWiki(t)
+  defer server.Close()
+
+  tests := []struct {
+    asOf time.Time
+    path []string
+  }{
+    {time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), []string{"Ada Lovelace", "Analytical Engine", "Alan Turing"}},
+    {time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), []string{"Ada Lovelace", "Alan Turing"}},
+  }
+  for i, test := range tests {
+    // Both directions, as only the backward one checks pages linking in
+    for _, ends := range [][2]string{{"Ada Lovelace", "Alan Turing"}, {"Alan Turing", "Ada Lovelace"}} {
+      source := NewRevisionSource(testWiki(Config{Endpoint: server.URL, AsOf: test.asOf}))
+      path, err := NewPageGraph(source).Search(ends[0], ends[1])
+      if ends[0] == "Alan Turing" {
+        // Alan Turing links to Ada Lovelace from a navbox, whose links aren't
+        // in his page's wikitext
+        if err != ErrNoPath {
+          t.Errorf("tests[%d]: expected no path back, got %#v, %v", i, path, err)
+        }
+        continue
+      }
+      if err != nil || !reflect.DeepEqual(test.path, path) {
+        t.Errorf("tests[%d]: expected: %#v, got: %#v, %v", i, test.path, path, err)
+      }
+    }
+  }
+}
+
+func TestConfig_AsOf(t *testing.T) {
+  asOf, err := ParseAsOf("2024-01-01")
+  if err != nil || !asOf.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+    t.Errorf("unexpected time: %v, %v", asOf, err)
+  }
+  if exact, err := ParseAsOf("2024-01-01T00:00:00Z"); err != nil || !exact.Equal(asOf) {
+    t.Errorf("unexpected time: %v, %v", exact, err)
+  }
+  if _, err := ParseAsOf("last week"); err == nil {
+    t.Error("expected an invalid time to be rejected")
+  }
+
+  if _, ok := NewSource(Config{AsOf: asOf}).(*RevisionSource); !ok {
+    t.Error("expected a RevisionSource as of a time")
+  }
+  // Links of different times aren't cached together
+  if (Config{}).Wiki() == (Config{AsOf: asOf}).Wiki() || (Config{AsOf: asOf}).Wiki() == (Config{AsOf: asOf.AddDate(0, 0, 1)}).Wiki() {
+    t.Error("expected races as of a time to key apart")
+  }
+  for _, config := range []Config{{AsOf: time.Now().Add(time.Hour)}, {AsOf: asOf, Rules: RulesHuman}} {
+    if err := config.Validate(); err == nil {
+      t.Errorf("expected %#v to be rejected", config)
+    }
+  }
+}
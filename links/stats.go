@@ -0,0 +1,119 @@
+package links
+
+import (
+  "context"
+  "time"
+)
+
+// FetchStats count what it took a LinkSource to send a Response
+type FetchStats struct {
+  // API requests made, not counting retries
+  Requests int `json:"api_requests"`
+  // Size of the API responses
+  Bytes int64 `json:"bytes"`
+  // Pages of results followed after the first one of a batch of titles
+  Continuations int `json:"continuations"`
+  // Titles whose links came from a cache
+  CacheHits int `json:"cache_hits"`
+  // Links dropped as boring
+  Filtered int `json:"filtered"`
+}
+
+func (s *FetchStats) add(other FetchStats) {
+  s.Requests += other.Requests
+  s.Bytes += other.Bytes
+  s.Continuations += other.Continuations
+  s.CacheHits += other.CacheHits
+  s.Filtered += other.Filtered
+}
+
+// DirectionStats tell what one direction of a search did
+type DirectionStats struct {
+  FetchStats
+  // Pages whose links were requested at each depth
+  Expanded []int `json:"expanded"`
+  // Pages first reached at each depth, starting with the page the direction
+  // started from
+  Reached []int `json:"reached"`
+  // Links received
+  Links int `json:"links"`
+}
+
+// Stats tell what both directions of a search did
+type Stats struct {
+  Forward DirectionStats `json:"forward"`
+  Backward DirectionStats `json:"backward"`
+  // Time the search took
+  Elapsed time.Duration `json:"-"`
+}
+
+// Result is what a search found, and what it took
+type Result struct {
+  // Path found, a shortest one unless the search was best-first
+  Path []string
+  // Every shortest path, up to the limit asked for, when searching for all
+  // of them, and how many there are
+  Paths [][]string
+  TotalPaths int
+  // Namespace of every page in Paths, as told by the source or guessed from
+  // its title
+  Namespaces map[string]int
+  Stats
+}
+
+// SearchResult is like SearchContext, returning the path found along with the
+// statistics of the search. The statistics are returned even if the search
+// failed
+func (pg *PageGraph) SearchResult(ctx context.Context, from, to string, options ...SearchOptions) (Result, error) {
+  return pg.searchResult(ctx, from, to, 1, searchOptions(options))
+}
+
+// SearchAllResult is like SearchAll, returning the paths found along with the
+// statistics of the search
+func (pg *PageGraph) SearchAllResult(ctx context.Context, from, to string, limit int, options ...SearchOptions) (Result, error) {
+  return pg.searchResult(ctx, from, to, limit, searchOptions(options))
+}
+
+// searchResult finds up to limit shortest paths between from and to, all of
+// them if limit is 0
+func (pg *PageGraph) searchResult(ctx context.Context, from, to string, limit int, options SearchOptions) (Result, error) {
+  ctx, done := pg.start(ctx)
+  defer done()
+
+  start := time.Now()
+  forward, backward, meetings, err := pg.search(ctx, from, to, options)
+  result := Result{Stats: Stats{Forward: forward.directionStats(), Backward: backward.directionStats(), Elapsed: time.Since(start)}}
+  if err != nil {
+    return result, err
+  }
+
+  result.Paths, result.TotalPaths = allPaths(forward, backward, meetings, limit)
+  result.Namespaces = map[string]int{}
+  for _, path := range result.Paths {
+    pg.resolveAll(path)
+    for _, title := range path {
+      result.Namespaces[title] = pageNamespace(title, forward, backward)
+    }
+  }
+  result.Path = result.Paths[0]
+  pg.emit(Event{Type: EventMidpoint, Title: pg.Resolve(meetings[0]), Path: result.Path})
+  return result, nil
+}
+
+// pageNamespace returns the namespace of title either direction was told about,
+// guessing it from the title otherwise
+func pageNamespace(title string, directions ...*layers) int {
+  for _, l := range directions {
+    if ns, ok := l.namespaces[title]; ok {
+      return ns
+    }
+  }
+  return titleNamespace(title)
+}
+
+func (l *layers) directionStats() DirectionStats {
+  if l == nil {
+    return DirectionStats{}
+  }
+  return l.stats
+}
@@ -0,0 +1,129 @@
+package links
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "reflect"
+  "sync/atomic"
+  "testing"
+)
+
+func TestSearchResult_Stats(t *testing.T) {
+  pg := NewPageGraph(NewMemoryGraph(chain(Links{}, "Page", 10)))
+  result, err := pg.SearchResult(context.Background(), "Page0", "Page9")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(result.Path) != 10 || !reflect.DeepEqual(result.Paths, [][]string{result.Path}) || result.TotalPaths != 1 {
+    t.Fatalf("unexpected result: %#v", result)
+  }
+
+  // One page per layer, every one of them with a single link
+  forward, backward := result.Forward, result.Backward
+  if len(forward.Expanded)+len(backward.Expanded) != 9 {
+    t.Errorf("expected 9 layers, got %#v and %#v", forward.Expanded, backward.Expanded)
+  }
+  for _, stats := range []DirectionStats{forward, backward} {
+    for _, counts := range [][]int{stats.Expanded, stats.Reached} {
+      for _, count := range counts {
+        if count != 1 {
+          t.Errorf("expected a page per layer, got %#v", stats)
+        }
+      }
+    }
+    if len(stats.Reached) != len(stats.Expanded)+1 || stats.Links != len(stats.Expanded) {
+      t.Errorf("unexpected stats: %#v", stats)
+    }
+    if stats.FetchStats != (FetchStats{}) {
+      t.Errorf("expected no fetching from memory, got %#v", stats.FetchStats)
+    }
+  }
+
+  // A failed search tells how far it got
+  result, err = pg.SearchResult(context.Background(), "Page0", "Page9", SearchOptions{MaxDepth: 4})
+  if !errors.Is(err, ErrLimitExceeded) {
+    t.Fatalf("expected limit exceeded, got %v", err)
+  }
+  if len(result.Forward.Expanded)+len(result.Backward.Expanded) != 4 || result.Path != nil {
+    t.Errorf("unexpected result: %#v", result)
+  }
+}
+
+func TestSearchResult_FetchStats(t *testing.T) {
+  // Links of "Start" come in two pages, one of them boring
+  var bodies int64
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    title := query.Get("titles")
+    var linked []string
+    data := map[string]interface{}{}
+    switch {
+    case query.Get("prop") == "linkshere" && title == "Target":
+      linked = []string{"Middle"}
+    case query.Get("prop") == "links" && title == "Start" && len(query.Get("plcontinue")) == 0:
+      linked = []string{"Other", "ISBN (identifier)"}
+      data["continue"] = map[string]interface{}{"plcontinue": "Start", "continue": "||"}
+    case query.Get("prop") == "links" && title == "Start":
+      linked = []string{"Middle"}
+    }
+    links := []map[string]interface{}{}
+    for _, to := range linked {
+      links = append(links, map[string]interface{}{"ns": 0, "title": to})
+    }
+    data["query"] = map[string]interface{}{"pages": map[string]interface{}{
+      "1": map[string]interface{}{"ns": 0, "title": title, query.Get("prop"): links},
+    }}
+    body, _ := json.Marshal(data)
+    atomic.AddInt64(&bodies, int64(len(body)))
+    w.Write(body)
+  }))
+  defer server.Close()
+
+  pg := NewPageGraph(testWiki(Config{Endpoint: server.URL}))
+  result, err := pg.SearchResult(context.Background(), "Start", "Target")
+  if err != nil {
+    t.Fatal(err)
+  }
+  expect := []string{"Start", "Middle", "Target"}
+  if !reflect.DeepEqual(expect, result.Path) {
+    t.Fatalf("expected: %#v\ngot: %#v", expect, result.Path)
+  }
+
+  forward, backward := result.Forward, result.Backward
+  if forward.Requests != 2 || forward.Continuations != 1 || forward.Filtered != 1 || forward.Links != 2 {
+    t.Errorf("unexpected forward stats: %#v", forward)
+  }
+  if backward.Requests != 1 || backward.Continuations != 0 || backward.Filtered != 0 || backward.Links != 1 {
+    t.Errorf("unexpected backward stats: %#v", backward)
+  }
+  // The preflight check isn't part of either direction
+  if total := forward.Bytes + backward.Bytes; total == 0 || total >= atomic.LoadInt64(&bodies) {
+    t.Errorf("expected the bytes of the searches' responses, got %d of %d", total, atomic.LoadInt64(&bodies))
+  }
+}
+
+func TestSearchResult_CacheHits(t *testing.T) {
+  g := NewMemoryGraph(chain(Links{}, "Page", 10))
+  cache := tempCache(t, 0)
+
+  pg := NewPageGraph(cache.Source(g, "memory"))
+  result, err := pg.SearchResult(context.Background(), "Page0", "Page9")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if result.Forward.CacheHits+result.Backward.CacheHits != 0 {
+    t.Errorf("expected no hits, got %#v", result.Stats)
+  }
+
+  pg = NewPageGraph(cache.Source(g, "memory"))
+  result, err = pg.SearchResult(context.Background(), "Page0", "Page9")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if hits := result.Forward.CacheHits + result.Backward.CacheHits; hits == 0 || int64(hits) != cache.Stats().Hits {
+    t.Errorf("expected the cache's hits, got %#v, cache: %#v", result.Stats, cache.Stats())
+  }
+}
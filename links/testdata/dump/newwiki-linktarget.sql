@@ -0,0 +1,10 @@
+-- MySQL dump of a tiny synthetic wiki, in the format of the linktarget table dumps
+DROP TABLE IF EXISTS `linktarget`;
+CREATE TABLE `linktarget` (
+  `lt_id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `lt_namespace` int(11) NOT NULL,
+  `lt_title` varbinary(255) NOT NULL,
+  PRIMARY KEY (`lt_id`),
+  UNIQUE KEY `lt_namespace_title` (`lt_namespace`,`lt_title`)
+) ENGINE=InnoDB DEFAULT CHARSET=binary;
+INSERT INTO `linktarget` VALUES (101,0,'Babbage'),(102,0,'Analytical_Engine'),(103,0,'Computer'),(104,0,'Alan_Turing'),(105,14,'Computing'),(106,0,'Red_link');
@@ -0,0 +1,10 @@
+-- MySQL dump of a tiny synthetic wiki, in the format of the pagelinks table
+-- dumps pointing at the linktarget table
+DROP TABLE IF EXISTS `pagelinks`;
+CREATE TABLE `pagelinks` (
+  `pl_from` int(8) unsigned NOT NULL DEFAULT 0,
+  `pl_from_namespace` int(11) NOT NULL DEFAULT 0,
+  `pl_target_id` bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`pl_from`,`pl_target_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=binary;
+INSERT INTO `pagelinks` VALUES (1,0,101),(1,0,106),(2,0,102),(3,0,103),(4,0,104),(5,0,105);
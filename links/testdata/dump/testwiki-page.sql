@@ -0,0 +1,20 @@
+-- MySQL dump of a tiny synthetic wiki, in the format of the page table dumps
+DROP TABLE IF EXISTS `page`;
+CREATE TABLE `page` (
+  `page_id` int(8) unsigned NOT NULL AUTO_INCREMENT,
+  `page_namespace` int(11) NOT NULL DEFAULT 0,
+  `page_title` varbinary(255) NOT NULL DEFAULT '',
+  `page_is_redirect` tinyint(1) unsigned NOT NULL DEFAULT 0,
+  `page_is_new` tinyint(1) unsigned NOT NULL DEFAULT 0,
+  `page_random` double unsigned NOT NULL DEFAULT 0,
+  `page_touched` binary(14) NOT NULL,
+  `page_links_updated` varbinary(14) DEFAULT NULL,
+  `page_latest` int(8) unsigned NOT NULL DEFAULT 0,
+  `page_len` int(8) unsigned NOT NULL DEFAULT 0,
+  `page_content_model` varbinary(32) DEFAULT NULL,
+  `page_lang` varbinary(35) DEFAULT NULL,
+  PRIMARY KEY (`page_id`),
+  UNIQUE KEY `page_name_title` (`page_namespace`,`page_title`)
+) ENGINE=InnoDB DEFAULT CHARSET=binary;
+INSERT INTO `page` VALUES (1,0,'Ada_Lovelace',0,0,0.1,'20240601000000','20240601000000',11,100,'wikitext',NULL),(2,0,'Charles_Babbage',0,0,0.2,'20240601000000','20240601000000',12,100,'wikitext',NULL),(3,0,'Analytical_Engine',0,0,0.3,'20240601000000','20240601000000',13,100,'wikitext',NULL);
+INSERT INTO `page` VALUES (4,0,'Computer',0,0,0.4,'20240601000000',NULL,14,100,'wikitext',NULL),(5,0,'Alan_Turing',0,0,0.5,'20240601000000',NULL,15,100,'wikitext',NULL),(6,0,'Babbage',1,0,0.6,'20240601000000',NULL,16,20,'wikitext',NULL),(7,14,'Computing',0,0,0.7,'20240601000000',NULL,17,100,'wikitext',NULL),(8,2,'Someone',0,0,0.8,'20240601000000',NULL,18,100,'wikitext',NULL),(9,0,'O\'Brien_(1,2)',0,0,0.9,'20240601000000',NULL,19,100,'wikitext',NULL),(10,0,'ISBN',0,0,0.95,'20240601000000',NULL,20,100,'wikitext',NULL);
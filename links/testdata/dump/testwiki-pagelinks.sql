@@ -0,0 +1,12 @@
+-- MySQL dump of a tiny synthetic wiki, in the format of the pagelinks table
+-- dumps before the linktarget table was introduced
+DROP TABLE IF EXISTS `pagelinks`;
+CREATE TABLE `pagelinks` (
+  `pl_from` int(8) unsigned NOT NULL DEFAULT 0,
+  `pl_namespace` int(11) NOT NULL DEFAULT 0,
+  `pl_title` varbinary(255) NOT NULL DEFAULT '',
+  `pl_from_namespace` int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`pl_from`,`pl_namespace`,`pl_title`)
+) ENGINE=InnoDB DEFAULT CHARSET=binary;
+INSERT INTO `pagelinks` VALUES (1,0,'Babbage',0),(1,0,'Red_link',0),(1,0,'ISBN',0),(2,0,'Analytical_Engine',0),(2,0,'Charles_Babbage',0),(3,0,'Computer',0);
+INSERT INTO `pagelinks` VALUES (4,0,'Alan_Turing',0),(5,14,'Computing',0),(8,0,'Ada_Lovelace',2),(9,0,'Ada_Lovelace',0),(2,0,'Analytical_Engine',0);
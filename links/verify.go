@@ -0,0 +1,179 @@
+package links
+
+import (
+  "context"
+  "errors"
+  "fmt"
+)
+
+// Reasons a hop of a path is broken
+const (
+  // One of the pages of the hop doesn't exist
+  HopMissing = "missing"
+  // The page the hop leaves doesn't link to the one it leads to
+  HopNoLink = "no_link"
+  // The hop goes through a page outside the namespaces races go through
+  HopNamespace = "namespace"
+)
+
+// ErrShortPath is returned when asked to verify a path of less than two pages
+var ErrShortPath = errors.New("a path needs at least two pages")
+
+// Hop is a link between two consecutive pages of a verified path
+type Hop struct {
+  From string `json:"from"`
+  To string `json:"to"`
+  Valid bool `json:"valid"`
+  // Title of the link followed, if it redirects or normalizes to To
+  Via string `json:"via,omitempty"`
+  // Why the hop is broken, HopMissing, HopNoLink or HopNamespace
+  Reason string `json:"reason,omitempty"`
+  // What is wrong with the hop, in words
+  Error string `json:"error,omitempty"`
+}
+
+// Verification tells whether each hop of a path exists
+type Verification struct {
+  Path []string `json:"path"`
+  // Titles the pages of the path resolve to, after redirects and
+  // normalization
+  Resolved []string `json:"resolved"`
+  Hops []Hop `json:"hops"`
+  Valid bool `json:"valid"`
+  // Index in Hops of the first broken hop, -1 if none is
+  Broken int `json:"broken"`
+}
+
+// Verify checks that each page of path links to the next one in source,
+// following redirects. Only the links races follow count: a path through
+// boring links, or pages between its ends outside namespaces, is broken. Any
+// namespace goes if namespaces is empty
+func Verify(ctx context.Context, source LinkSource, path []string, namespaces []int) (Verification, error) {
+  if len(path) < 2 {
+    return Verification{}, ErrShortPath
+  }
+  v := Verification{Path: path, Resolved: make([]string, len(path)), Hops: []Hop{}, Broken: -1}
+
+  titles := []string{}
+  seen := map[string]bool{}
+  for _, title := range path {
+    if !seen[title] {
+      seen[title] = true
+      titles = append(titles, title)
+    }
+  }
+  redirects := map[string]string{}
+  missing := map[string]bool{}
+  linked := Links{}
+  pageNamespaces := map[string]int{}
+  for resp := range source.LinksFrom(ctx, titles) {
+    if resp.Err != nil {
+      return v, resp.Err
+    }
+    for _, title := range resp.Missing {
+      missing[title] = true
+    }
+    for alias, title := range resp.Redirects {
+      redirects[alias] = title
+    }
+    for page, tos := range resp.Links {
+      linked[page] = append(linked[page], tos...)
+    }
+    for page, ns := range resp.Namespaces {
+      pageNamespaces[page] = ns
+    }
+  }
+  if err := ctx.Err(); err != nil {
+    return v, err
+  }
+
+  // The same way searches do
+  resolve := func(title string) string {
+    return followRedirects(title, func(title string) (string, bool) {
+      resolved, ok := redirects[title]
+      return resolved, ok
+    })
+  }
+  for i, title := range path {
+    v.Resolved[i] = resolve(title)
+  }
+  // Returns the title of the link from one page of the path to the next
+  link := func(i int) (string, bool) {
+    to := v.Resolved[i+1]
+    for _, title := range linked[v.Resolved[i]] {
+      if title == to || title == path[i+1] || resolve(title) == to {
+        return title, true
+      }
+    }
+    return "", false
+  }
+
+  allowed := map[int]bool{}
+  for _, ns := range namespaces {
+    allowed[ns] = true
+  }
+  for i := range path[1:] {
+    hop := Hop{From: path[i], To: path[i+1]}
+    for _, title := range []string{path[i], path[i+1]} {
+      if len(hop.Reason) == 0 && (missing[title] || missing[resolve(title)]) {
+        hop.Reason, hop.Error = HopMissing, fmt.Sprintf("%s does not exist", title)
+      }
+    }
+    // Races may start and end anywhere
+    if to := v.Resolved[i+1]; len(hop.Reason) == 0 && len(allowed) > 0 && i+2 < len(path) {
+      ns, ok := pageNamespaces[to]
+      if !ok {
+        ns = titleNamespace(to)
+      }
+      if !allowed[ns] {
+        hop.Reason, hop.Error = HopNamespace, fmt.Sprintf("%s is in namespace %d, which races don't go through", hop.To, ns)
+      }
+    }
+    v.Hops = append(v.Hops, hop)
+  }
+
+  // Links to a redirect only lead to the page of the path once resolved,
+  // which takes looking up the links of the pages of the hops not found
+  unknown := []string{}
+  for i := range v.Hops {
+    if _, ok := link(i); ok || len(v.Hops[i].Reason) > 0 {
+      continue
+    }
+    for _, title := range linked[v.Resolved[i]] {
+      if _, ok := redirects[title]; !ok && !seen[title] {
+        seen[title] = true
+        unknown = append(unknown, title)
+      }
+    }
+  }
+  if finder, ok := source.(Finder); ok {
+    for _, titles := range batch(unknown, batchSize) {
+      resp := finder.Find(ctx, titles)
+      if resp.Err != nil {
+        return v, resp.Err
+      }
+      for alias, title := range resp.Redirects {
+        redirects[alias] = title
+      }
+    }
+  }
+
+  for i := range v.Hops {
+    hop := &v.Hops[i]
+    if len(hop.Reason) == 0 {
+      if title, ok := link(i); ok {
+        hop.Valid = true
+        if title != hop.To {
+          hop.Via = title
+        }
+      } else {
+        hop.Reason, hop.Error = HopNoLink, fmt.Sprintf("%s does not link to %s", hop.From, hop.To)
+      }
+    }
+    if !hop.Valid && v.Broken < 0 {
+      v.Broken = i
+    }
+  }
+  v.Valid = v.Broken < 0
+  return v, nil
+}
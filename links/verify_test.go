@@ -0,0 +1,114 @@
+package links
+
+import (
+  "context"
+  "reflect"
+  "testing"
+)
+
+func TestVerify(t *testing.T) {
+  g := NewMemoryGraph(Links{
+    "Start":             {"Middle", "Other"},
+    "Middle":            {"End (band)"},
+    "End":               {"Start"},
+    "Other":             {"Category:Shortcut"},
+    "Category:Shortcut": {"End"},
+  })
+  g.Redirect("End (band)", "End")
+  g.Redirect("Begin", "Start")
+
+  tests := []struct {
+    path     []string
+    resolved []string
+    hops     []Hop
+    broken   int
+  }{
+    // Through a redirect, from a title that redirects too
+    {
+      []string{"Begin", "Middle", "End"},
+      []string{"Start", "Middle", "End"},
+      []Hop{
+        {From: "Begin", To: "Middle", Valid: true},
+        {From: "Middle", To: "End", Valid: true, Via: "End (band)"},
+      },
+      -1,
+    },
+    {
+      []string{"Start", "Middle", "End (band)"},
+      []string{"Start", "Middle", "End"},
+      []Hop{
+        {From: "Start", To: "Middle", Valid: true},
+        {From: "Middle", To: "End (band)", Valid: true},
+      },
+      -1,
+    },
+    {
+      []string{"Start", "End", "Middle"},
+      []string{"Start", "End", "Middle"},
+      []Hop{
+        {From: "Start", To: "End", Reason: HopNoLink, Error: "Start does not link to End"},
+        {From: "End", To: "Middle", Reason: HopNoLink, Error: "End does not link to Middle"},
+      },
+      0,
+    },
+    {
+      []string{"Start", "Middle", "Nowhere"},
+      []string{"Start", "Middle", "Nowhere"},
+      []Hop{
+        {From: "Start", To: "Middle", Valid: true},
+        {From: "Middle", To: "Nowhere", Reason: HopMissing, Error: "Nowhere does not exist"},
+      },
+      1,
+    },
+  }
+  for i, test := range tests {
+    v, err := Verify(context.Background(), g, test.path, nil)
+    if err != nil {
+      t.Fatalf("tests[%d]: %v", i, err)
+    }
+    expect := Verification{Path: test.path, Resolved: test.resolved, Hops: test.hops, Valid: test.broken < 0, Broken: test.broken}
+    if !reflect.DeepEqual(expect, v) {
+      t.Errorf("tests[%d]: expected: %#v\ngot: %#v", i, expect, v)
+    }
+  }
+
+  // Articles only
+  v, err := Verify(context.Background(), g, []string{"Start", "Other", "Category:Shortcut", "End"}, []int{0})
+  if err != nil || v.Broken != 1 || v.Hops[1].Reason != HopNamespace || !v.Hops[0].Valid || !v.Hops[2].Valid {
+    t.Errorf("expected hops through categories to be broken, got %#v, %v", v, err)
+  }
+  v, err = Verify(context.Background(), g, []string{"Category:Shortcut", "End"}, []int{0})
+  if err != nil || !v.Valid {
+    t.Errorf("expected paths to start and end in any namespace, got %#v, %v", v, err)
+  }
+
+  if _, err := Verify(context.Background(), g, []string{"Start"}, nil); err != ErrShortPath {
+    t.Errorf("expected a short path to be rejected, got %v", err)
+  }
+}
+
+func TestVerify_MediaWiki(t *testing.T) {
+  // A path found on the live wiki stays valid until a page changes
+  graph := map[string][]string{
+    "Start":  {"Middle"},
+    "Middle": {"Target"},
+  }
+  server := fakeWiki(graph, nil)
+  defer server.Close()
+  path, err := NewPageGraph(testWiki(Config{Endpoint: server.URL})).Search("Start", "Target")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  v, err := Verify(context.Background(), testWiki(Config{Endpoint: server.URL}), path, nil)
+  if err != nil || !v.Valid {
+    t.Errorf("expected %#v to be valid, got %#v, %v", path, v, err)
+  }
+
+  graph["Middle"] = []string{"Elsewhere"}
+  graph["Target"] = []string{"Start"}
+  v, err = Verify(context.Background(), testWiki(Config{Endpoint: server.URL}), path, nil)
+  if err != nil || v.Valid || v.Broken != 1 || v.Hops[1].Reason != HopNoLink {
+    t.Errorf("expected the last hop to be broken, got %#v, %v", v, err)
+  }
+}
@@ -0,0 +1,207 @@
+package net
+
+import (
+  "encoding/json"
+  "fmt"
+  "log"
+  "net/http"
+  "sync"
+  "time"
+  "github.com/86me/wikiracer/links"
+  "github.com/gorilla/mux"
+  "github.com/gorilla/websocket"
+)
+
+// Type of the events carrying the status of the race job, sent first and
+// last on every stream
+const eventStatus = "status"
+
+// Events a slow subscriber can fall behind by before it misses some
+const eventBuffer = 1024
+
+// How often idle Server-Sent Events streams get a comment to keep them open
+var keepAlive = 15 * time.Second
+
+// raceEvent is a message of a race's event stream: an event of its search, or
+// the status of its job
+type raceEvent struct {
+  links.Event
+  Job *Job `json:"job,omitempty"`
+}
+
+// eventHub hands the events of one race to everyone watching it. Races never
+// wait for their watchers, events are dropped for those that fall behind
+type eventHub struct {
+  sync.Mutex
+  subscribers map[chan links.Event]bool
+  closed bool
+}
+
+func newEventHub() *eventHub {
+  return &eventHub{subscribers: map[chan links.Event]bool{}}
+}
+
+func (h *eventHub) publish(event links.Event) {
+  h.Lock()
+  defer h.Unlock()
+  for c := range h.subscribers {
+    select {
+    case c <- event:
+    default:
+    }
+  }
+}
+
+// subscribe returns a channel receiving the race's events from now on, closed
+// once the race is over, and a function to stop receiving them
+func (h *eventHub) subscribe() (chan links.Event, func()) {
+  h.Lock()
+  defer h.Unlock()
+  c := make(chan links.Event, eventBuffer)
+  if h.closed {
+    close(c)
+    return c, func() {}
+  }
+  h.subscribers[c] = true
+  return c, func() {
+    h.Lock()
+    defer h.Unlock()
+    if h.subscribers[c] {
+      delete(h.subscribers, c)
+      close(c)
+    }
+  }
+}
+
+// close ends the streams of every subscriber
+func (h *eventHub) close() {
+  h.Lock()
+  defer h.Unlock()
+  h.closed = true
+  for c := range h.subscribers {
+    delete(h.subscribers, c)
+    close(c)
+  }
+}
+
+// events returns the hub of a job, nil if the job finished before the server
+// last started
+func (s *jobStore) events(id string) (*eventHub, error) {
+  s.Lock()
+  defer s.Unlock()
+  job, ok := s.jobs[id]
+  if !ok {
+    return nil, ErrJobNotFound
+  }
+  return job.events, nil
+}
+
+// Dashboards are served from elsewhere, and the events are as public as races
+var upgrader = websocket.Upgrader{
+  CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// RaceEvents streams the events of a race job as they happen, as
+// Server-Sent Events or over a WebSocket if the request upgrades to one.
+// Streams start and end with the status of the job
+func (wr *WikiRace) RaceEvents(w http.ResponseWriter, r *http.Request) {
+  id := mux.Vars(r)["id"]
+  hub, err := wr.jobs.store.events(id)
+  if err != nil {
+    respondWithError(w, http.StatusNotFound, err.Error())
+    return
+  }
+  if hub == nil {
+    hub = newEventHub()
+    hub.close()
+  }
+  events, unsubscribe := hub.subscribe()
+  defer unsubscribe()
+
+  status := func() raceEvent {
+    job, _ := wr.jobs.store.get(id)
+    return raceEvent{Event: links.Event{Type: eventStatus, Time: time.Now()}, Job: &job}
+  }
+
+  if websocket.IsWebSocketUpgrade(r) {
+    streamWebSocket(w, r, events, status)
+    return
+  }
+  streamSSE(w, r, events, status)
+}
+
+func streamSSE(w http.ResponseWriter, r *http.Request, events chan links.Event, status func() raceEvent) {
+  flusher, ok := w.(http.Flusher)
+  if !ok {
+    respondWithError(w, http.StatusInternalServerError, "Streaming unsupported")
+    return
+  }
+  w.Header().Set("Content-Type", "text/event-stream")
+  w.Header().Set("Cache-Control", "no-cache")
+  w.WriteHeader(http.StatusOK)
+
+  send := func(event raceEvent) {
+    data, _ := json.Marshal(event)
+    fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+    flusher.Flush()
+  }
+
+  send(status())
+  ticker := time.NewTicker(keepAlive)
+  defer ticker.Stop()
+  for {
+    select {
+    case event, ok := <-events:
+      if !ok {
+        send(status())
+        return
+      }
+      send(raceEvent{Event: event})
+    case <-ticker.C:
+      fmt.Fprint(w, ": keep-alive\n\n")
+      flusher.Flush()
+    case <-r.Context().Done():
+      return
+    }
+  }
+}
+
+func streamWebSocket(w http.ResponseWriter, r *http.Request, events chan links.Event, status func() raceEvent) {
+  conn, err := upgrader.Upgrade(w, r, nil)
+  if err != nil {
+    // The upgrader already responded
+    log.Printf("[%s] WebSocket upgrade failed: %s", r.RemoteAddr, err)
+    return
+  }
+  defer conn.Close()
+
+  // Reading is needed to notice the client going away
+  gone := make(chan struct{})
+  go func() {
+    defer close(gone)
+    for {
+      if _, _, err := conn.ReadMessage(); err != nil {
+        return
+      }
+    }
+  }()
+
+  if err := conn.WriteJSON(status()); err != nil {
+    return
+  }
+  for {
+    select {
+    case event, ok := <-events:
+      if !ok {
+        conn.WriteJSON(status())
+        conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+        return
+      }
+      if err := conn.WriteJSON(raceEvent{Event: event}); err != nil {
+        return
+      }
+    case <-gone:
+      return
+    }
+  }
+}
@@ -0,0 +1,167 @@
+package net
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "github.com/86me/wikiracer/links"
+    "github.com/gorilla/websocket"
+)
+
+// gatedSource holds back the links of source until release is closed
+type gatedSource struct {
+    source  links.LinkSource
+    release chan struct{}
+}
+
+func (s gatedSource) LinksFrom(ctx context.Context, titles []string) chan links.Response {
+    <-s.release
+    return s.source.LinksFrom(ctx, titles)
+}
+
+func (s gatedSource) LinksHere(ctx context.Context, titles []string) chan links.Response {
+    <-s.release
+    return s.source.LinksHere(ctx, titles)
+}
+
+// startEventsRace serves a race held back until the returned channel is closed
+func startEventsRace(t *testing.T) (*httptest.Server, Job, chan struct{}) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    release := make(chan struct{})
+    wr = WikiRace{Source: gatedSource{fixture, release}}
+    wr.Initialize()
+    server := httptest.NewServer(wr.Router)
+    t.Cleanup(func() {
+        server.Close()
+        wr.Close()
+    })
+
+    _, job := createRace(t, `{"from": "The Beatles", "to": "Ada Lovelace"}`)
+    if len(job.ID) == 0 {
+        t.Fatal("race not created")
+    }
+    return server, job, release
+}
+
+// checkEvents checks a stream of events of the fixture race
+func checkEvents(t *testing.T, events []raceEvent) {
+    t.Helper()
+    if len(events) < 2 || events[0].Type != eventStatus || events[len(events)-1].Type != eventStatus {
+        t.Fatalf("expected the stream to start and end with the status, got: %#v", events)
+    }
+    if job := events[len(events)-1].Job; job == nil || job.Status != JobDone {
+        t.Errorf("expected the race to be done, got: %#v", job)
+    }
+
+    counts := map[string]int{}
+    for _, event := range events {
+        counts[event.Type]++
+        if event.Type == links.EventMidpoint && strings.Join(event.Path, "|") != "The Beatles|Los Angeles Times|Ada Lovelace" {
+            t.Errorf("unexpected path: %#v", event.Path)
+        }
+    }
+    // The first frontiers may be expanded before subscribing, their links
+    // are only fetched after
+    if counts[links.EventFetched] < 2 || counts[links.EventDiscovered] == 0 || counts[links.EventMidpoint] != 1 {
+        t.Errorf("unexpected events: %#v", counts)
+    }
+}
+
+func TestRaceEvents_SSE(t *testing.T) {
+    server, job, release := startEventsRace(t)
+
+    resp, err := http.Get(server.URL + "/api/v1/races/" + job.ID + "/events")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+        t.Fatalf("unexpected content type %s", contentType)
+    }
+
+    events := []raceEvent{}
+    name := ""
+    scanner := bufio.NewScanner(resp.Body)
+    for scanner.Scan() {
+        line := scanner.Text()
+        switch {
+        case strings.HasPrefix(line, "event: "):
+            name = strings.TrimPrefix(line, "event: ")
+        case strings.HasPrefix(line, "data: "):
+            var event raceEvent
+            if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+                t.Fatal(err)
+            }
+            if event.Type != name {
+                t.Errorf("event %s sent as %s", event.Type, name)
+            }
+            events = append(events, event)
+            // Subscribed, let the race go
+            if len(events) == 1 {
+                close(release)
+            }
+        }
+    }
+    checkEvents(t, events)
+
+    // Streams of finished races only have the status
+    resp, err = http.Get(server.URL + "/api/v1/races/" + job.ID + "/events")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    scanner = bufio.NewScanner(resp.Body)
+    statuses := 0
+    for scanner.Scan() {
+        if scanner.Text() == "event: status" {
+            statuses++
+        }
+    }
+    if statuses != 2 {
+        t.Errorf("expected 2 statuses, got %d", statuses)
+    }
+}
+
+func TestRaceEvents_WebSocket(t *testing.T) {
+    server, job, release := startEventsRace(t)
+
+    url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/races/" + job.ID + "/events"
+    conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+
+    events := []raceEvent{}
+    for {
+        var event raceEvent
+        if err := conn.ReadJSON(&event); err != nil {
+            if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+                t.Fatal(err)
+            }
+            break
+        }
+        events = append(events, event)
+        if len(events) == 1 {
+            close(release)
+        }
+    }
+    checkEvents(t, events)
+}
+
+func TestRaceEvents_NotFound(t *testing.T) {
+    wr = WikiRace{}
+    wr.Initialize()
+    defer wr.Close()
+
+    req, _ := http.NewRequest("GET", "/api/v1/races/nope/events", nil)
+    response := executeRequest(req)
+    checkResponseCode(t, http.StatusNotFound, response.Code)
+}
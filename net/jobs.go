@@ -0,0 +1,407 @@
+package net
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "io"
+  "io/ioutil"
+  "log"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sync"
+  "time"
+  "github.com/86me/wikiracer/links"
+  "github.com/gorilla/mux"
+)
+
+// Statuses of a race job
+const (
+  JobQueued = "queued"
+  JobRunning = "running"
+  JobDone = "done"
+  JobFailed = "failed"
+  JobCancelled = "cancelled"
+)
+
+// Defaults for the job settings of WikiRace
+const (
+  defaultWorkers = 2
+  defaultQueueSize = 100
+  defaultJobTTL = time.Hour
+)
+
+// Job is a race run in the background, as reported by the jobs API
+type Job struct {
+  ID string `json:"id"`
+  From string `json:"from"`
+  To string `json:"to"`
+  Lang string `json:"lang,omitempty"`
+  RaceOptions
+  Status string `json:"status"`
+  Created time.Time `json:"created"`
+  Started *time.Time `json:"started,omitempty"`
+  Finished *time.Time `json:"finished,omitempty"`
+  // Progress so far, or in total once finished
+  ElapsedMS int64 `json:"elapsed_ms"`
+  APIRequests int64 `json:"api_requests"`
+  PagesExplored int64 `json:"pages_explored"`
+  Result *RaceResult `json:"result,omitempty"`
+  Error *APIError `json:"error,omitempty"`
+
+  graph *links.PageGraph
+  source links.LinkSource
+  cancel context.CancelFunc
+  events *eventHub
+}
+
+// finished tells whether the job will not change anymore
+func (j *Job) finished() bool {
+  return j.Status == JobDone || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// jobStore keeps jobs in memory, and in a file if path is set, until ttl
+// after they finished
+type jobStore struct {
+  sync.Mutex
+  jobs map[string]*Job
+  ttl time.Duration
+  path string
+}
+
+// errQueueFull is returned when there are too many jobs waiting for a worker
+var errQueueFull = errors.New("too many races queued, try again later")
+
+// ErrJobNotFound is returned for jobs that never existed or expired
+var ErrJobNotFound = errors.New("race not found")
+
+func newJobStore(ttl time.Duration, path string) *jobStore {
+  s := &jobStore{jobs: map[string]*Job{}, ttl: ttl, path: path}
+  if len(path) > 0 {
+    s.load()
+  }
+  return s
+}
+
+// load reads the jobs saved to the store's file. Jobs that were still queued
+// or running when it was saved failed with the server
+func (s *jobStore) load() {
+  data, err := ioutil.ReadFile(s.path)
+  if os.IsNotExist(err) {
+    return
+  }
+  if err == nil {
+    err = json.Unmarshal(data, &s.jobs)
+  }
+  if err != nil {
+    log.Printf("UNABLE TO LOAD JOBS: %s", err)
+    return
+  }
+
+  now := time.Now()
+  for _, job := range s.jobs {
+    if !job.finished() {
+      job.Status = JobFailed
+      job.Finished = &now
+      apiErr := apiError(http.StatusServiceUnavailable, "server stopped before the race finished")
+      job.Error = &apiErr
+    }
+  }
+  s.expire()
+}
+
+// save writes the jobs to the store's file, if any. Must be called locked
+func (s *jobStore) save() {
+  if len(s.path) == 0 {
+    return
+  }
+  data, err := json.Marshal(s.jobs)
+  if err == nil {
+    // Replace the file at once so a crash never leaves half of it
+    tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+    if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+      err = os.Rename(tmp, s.path)
+    }
+  }
+  if err != nil {
+    log.Printf("UNABLE TO SAVE JOBS: %s", err)
+  }
+}
+
+// expire forgets jobs that finished more than ttl ago. Must be called locked
+func (s *jobStore) expire() {
+  for id, job := range s.jobs {
+    if job.Finished != nil && time.Since(*job.Finished) > s.ttl {
+      delete(s.jobs, id)
+    }
+  }
+}
+
+func (s *jobStore) add(job *Job) {
+  s.Lock()
+  defer s.Unlock()
+  s.expire()
+  s.jobs[job.ID] = job
+  s.save()
+}
+
+func (s *jobStore) remove(id string) {
+  s.Lock()
+  defer s.Unlock()
+  delete(s.jobs, id)
+  s.save()
+}
+
+// update changes a job with the store locked, saving the store afterwards
+func (s *jobStore) update(job *Job, change func(*Job)) {
+  s.Lock()
+  defer s.Unlock()
+  change(job)
+  s.save()
+}
+
+// get returns a copy of a job with up to date progress counters
+func (s *jobStore) get(id string) (Job, error) {
+  s.Lock()
+  defer s.Unlock()
+  s.expire()
+  job, ok := s.jobs[id]
+  if !ok {
+    return Job{}, ErrJobNotFound
+  }
+  snapshot := *job
+  if job.Status == JobRunning {
+    snapshot.ElapsedMS = time.Since(*job.Started).Milliseconds()
+    snapshot.APIRequests = requests(job.source)
+    snapshot.PagesExplored = job.graph.Explored()
+  }
+  return snapshot, nil
+}
+
+// jobs runs race jobs on a fixed number of workers
+type jobs struct {
+  store *jobStore
+  queue chan *Job
+  // Ends the workers and the races they run
+  ctx context.Context
+  stop context.CancelFunc
+  wg sync.WaitGroup
+}
+
+// startJobs starts the workers of wr
+func (wr *WikiRace) startJobs() {
+  workers, queueSize, ttl := wr.Workers, wr.QueueSize, wr.JobTTL
+  if workers <= 0 {
+    workers = defaultWorkers
+  }
+  if queueSize <= 0 {
+    queueSize = defaultQueueSize
+  }
+  if ttl <= 0 {
+    ttl = defaultJobTTL
+  }
+
+  ctx, stop := context.WithCancel(context.Background())
+  wr.jobs = &jobs{
+    store: newJobStore(ttl, wr.JobsFile),
+    queue: make(chan *Job, queueSize),
+    ctx: ctx,
+    stop: stop,
+  }
+  for i := 0; i < workers; i++ {
+    wr.jobs.wg.Add(1)
+    go wr.jobs.work()
+  }
+}
+
+// Close cancels the running race jobs and stops the workers
+func (wr *WikiRace) Close() {
+  if wr.jobs != nil {
+    wr.jobs.stop()
+    wr.jobs.wg.Wait()
+  }
+}
+
+// work runs queued jobs until the jobs are stopped
+func (j *jobs) work() {
+  defer j.wg.Done()
+  for {
+    select {
+    case job := <-j.queue:
+      j.run(job)
+    case <-j.ctx.Done():
+      return
+    }
+  }
+}
+
+func (j *jobs) run(job *Job) {
+  store := j.store
+  ctx, cancel := context.WithCancel(j.ctx)
+  defer cancel()
+
+  cancelled := false
+  store.update(job, func(job *Job) {
+    // Cancelled while queued
+    if job.Status != JobQueued {
+      cancelled = true
+      job.source = nil
+      return
+    }
+    now := time.Now()
+    graph := links.NewPageGraph(job.source)
+    graph.Observe(job.events.publish)
+    job.Status = JobRunning
+    job.Started = &now
+    job.graph = graph
+    job.cancel = cancel
+  })
+  // Watchers get the final status of the job once their stream ends
+  defer job.events.close()
+  if cancelled {
+    return
+  }
+
+  log.Printf("Race job %s: %s -> %s", job.ID, job.From, job.To)
+  result, err := search(ctx, job.graph, job.source, job.From, job.To, job.RaceOptions, *job.Started)
+
+  store.update(job, func(job *Job) {
+    now := time.Now()
+    job.Finished = &now
+    job.ElapsedMS = now.Sub(*job.Started).Milliseconds()
+    job.APIRequests = requests(job.source)
+    job.PagesExplored = job.graph.Explored()
+    switch {
+    case job.Status == JobCancelled:
+    case err != nil:
+      log.Printf("Race job %s failed: %s", job.ID, err)
+      job.Status = JobFailed
+      apiErr := raceError(err)
+      job.Error = &apiErr
+    default:
+      job.Status = JobDone
+      job.Result = &result
+    }
+    // Let the graph and its links be collected
+    job.graph, job.source, job.cancel = nil, nil, nil
+  })
+}
+
+// Returns a random job ID
+func newJobID() string {
+  b := make([]byte, 8)
+  rand.Read(b)
+  return hex.EncodeToString(b)
+}
+
+// CreateRace queues a race between the "from" and "to" of a JSON body, or of
+// the query parameters, and responds with its job
+func (wr *WikiRace) CreateRace(w http.ResponseWriter, r *http.Request) {
+  var params struct {
+    From string `json:"from"`
+    To string `json:"to"`
+    Lang string `json:"lang"`
+    RaceOptions
+  }
+  query := r.URL.Query()
+  params.From, params.To, params.Lang = query.Get("from"), query.Get("to"), query.Get("lang")
+  var err error
+  if params.RaceOptions, err = queryOptions(query); err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  // Chunked bodies don't tell their length, an empty one leaves the query
+  if r.Body != nil {
+    if err := json.NewDecoder(r.Body).Decode(&params); err != nil && err != io.EOF {
+      respondWithError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+      return
+    }
+  }
+  if params.MaxDepth < 0 || params.MaxPages < 0 || params.MaxAPICalls < 0 || params.TimeoutMS < 0 {
+    respondWithError(w, http.StatusBadRequest, "Invalid negative limit")
+    return
+  }
+  params.RaceOptions = wr.limit(params.RaceOptions)
+  if params.RaceOptions, err = wr.mode(params.RaceOptions); err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  if len(params.From) == 0 || len(params.To) == 0 {
+    respondWithError(w, http.StatusBadRequest, "Insufficient parameters")
+    return
+  }
+  source, err := wr.source(params.Lang, params.Namespaces)
+  if err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  job := &Job{
+    ID: newJobID(),
+    From: params.From,
+    To: params.To,
+    Lang: params.Lang,
+    RaceOptions: params.RaceOptions,
+    Status: JobQueued,
+    Created: time.Now(),
+    source: source,
+    events: newEventHub(),
+  }
+  wr.jobs.store.add(job)
+  select {
+  case wr.jobs.queue <- job:
+  default:
+    wr.jobs.store.remove(job.ID)
+    respondWithError(w, http.StatusServiceUnavailable, errQueueFull.Error())
+    return
+  }
+
+  snapshot, _ := wr.jobs.store.get(job.ID)
+  w.Header().Set("Location", "/api/v1/races/"+job.ID)
+  respondWithJSON(w, http.StatusAccepted, snapshot)
+}
+
+// GetRace responds with the status of a race job
+func (wr *WikiRace) GetRace(w http.ResponseWriter, r *http.Request) {
+  job, err := wr.jobs.store.get(mux.Vars(r)["id"])
+  if err != nil {
+    respondWithError(w, http.StatusNotFound, err.Error())
+    return
+  }
+  respondWithJSON(w, http.StatusOK, job)
+}
+
+// CancelRace cancels a queued or running race job. Cancelling a finished job
+// is a conflict, unless it was cancelled already
+func (wr *WikiRace) CancelRace(w http.ResponseWriter, r *http.Request) {
+  id := mux.Vars(r)["id"]
+  store := wr.jobs.store
+
+  store.Lock()
+  job, ok := store.jobs[id]
+  conflict := ok && job.finished() && job.Status != JobCancelled
+  if ok && !job.finished() {
+    now := time.Now()
+    job.Status = JobCancelled
+    job.Finished = &now
+    if job.cancel != nil {
+      job.cancel()
+    }
+    store.save()
+  }
+  store.Unlock()
+
+  if !ok {
+    respondWithError(w, http.StatusNotFound, ErrJobNotFound.Error())
+    return
+  }
+  if conflict {
+    respondWithError(w, http.StatusConflict, "race already "+job.Status)
+    return
+  }
+  snapshot, _ := store.get(id)
+  respondWithJSON(w, http.StatusOK, snapshot)
+}
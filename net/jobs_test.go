@@ -0,0 +1,297 @@
+package net
+
+import (
+    "context"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/86me/wikiracer/links"
+)
+
+// blockingSource never answers, racing on it runs until cancelled
+type blockingSource struct{}
+
+func (blockingSource) LinksFrom(ctx context.Context, titles []string) chan links.Response {
+    return blockingSource{}.LinksHere(ctx, titles)
+}
+
+func (blockingSource) LinksHere(ctx context.Context, titles []string) chan links.Response {
+    c := make(chan links.Response)
+    go func() {
+        <-ctx.Done()
+        close(c)
+    }()
+    return c
+}
+
+func createRace(t *testing.T, body string) (*http.Response, Job) {
+    t.Helper()
+    req, _ := http.NewRequest("POST", "/api/v1/races", strings.NewReader(body))
+    response := executeRequest(req)
+
+    var job Job
+    if response.Code == http.StatusAccepted {
+        if err := json.Unmarshal(response.Body.Bytes(), &job); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return response.Result(), job
+}
+
+func getRace(t *testing.T, id string) (int, Job) {
+    t.Helper()
+    req, _ := http.NewRequest("GET", "/api/v1/races/"+id, nil)
+    response := executeRequest(req)
+
+    var job Job
+    json.Unmarshal(response.Body.Bytes(), &job)
+    return response.Code, job
+}
+
+func cancelRace(t *testing.T, id string) (int, Job) {
+    t.Helper()
+    req, _ := http.NewRequest("DELETE", "/api/v1/races/"+id, nil)
+    response := executeRequest(req)
+
+    var job Job
+    json.Unmarshal(response.Body.Bytes(), &job)
+    return response.Code, job
+}
+
+// waitForRace polls a job until it has one of the given statuses
+func waitForRace(t *testing.T, id string, statuses ...string) Job {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        _, job := getRace(t, id)
+        for _, status := range statuses {
+            if job.Status == status {
+                return job
+            }
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    t.Fatalf("race %s never got to %v", id, statuses)
+    return Job{}
+}
+
+func TestRaceJob(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+    defer wr.Close()
+
+    response, job := createRace(t, `{"from": "The Beatles", "to": "Ada Lovelace"}`)
+    checkResponseCode(t, http.StatusAccepted, response.StatusCode)
+    if location := response.Header.Get("Location"); location != "/api/v1/races/"+job.ID || len(job.ID) == 0 {
+        t.Errorf("unexpected location %#v for job %#v", location, job.ID)
+    }
+
+    job = waitForRace(t, job.ID, JobDone, JobFailed)
+    if job.Status != JobDone || job.Result == nil {
+        t.Fatalf("expected race to be done, got: %#v", job)
+    }
+    if strings.Join(job.Result.Path, "|") != "The Beatles|Los Angeles Times|Ada Lovelace" {
+        t.Errorf("unexpected path: %#v", job.Result.Path)
+    }
+    if job.PagesExplored < 2 || job.Started == nil || job.Finished == nil {
+        t.Errorf("expected progress to be reported, got: %#v", job)
+    }
+
+    // Finished races can't be cancelled
+    if code, _ := cancelRace(t, job.ID); code != http.StatusConflict {
+        t.Errorf("expected conflict cancelling a finished race, got %d", code)
+    }
+}
+
+func TestRaceJob_Query(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+    defer wr.Close()
+
+    // Without a body, even a chunked empty one
+    for _, chunked := range []bool{false, true} {
+        req, _ := http.NewRequest("POST", "/api/v1/races?from=The+Beatles&to=Ada+Lovelace", strings.NewReader(""))
+        if chunked {
+            req.ContentLength = -1
+        }
+        response := executeRequest(req)
+        checkResponseCode(t, http.StatusAccepted, response.Code)
+    }
+    // But not with an invalid one
+    _, job := createRace(t, `{"from": `)
+    if len(job.ID) > 0 {
+        t.Errorf("expected an invalid body to be rejected, got: %#v", job)
+    }
+}
+
+func TestRaceJob_All(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+    defer wr.Close()
+
+    response, job := createRace(t, `{"from": "The Beatles", "to": "Ada Lovelace", "all": true, "max_paths": 5}`)
+    checkResponseCode(t, http.StatusAccepted, response.StatusCode)
+    if !job.All || job.MaxPaths != 5 {
+        t.Errorf("expected the options in the job, got: %#v", job)
+    }
+
+    job = waitForRace(t, job.ID, JobDone, JobFailed)
+    if job.Status != JobDone || job.Result == nil {
+        t.Fatalf("expected race to be done, got: %#v", job)
+    }
+    if len(job.Result.Paths) != 1 || job.Result.TotalPaths != 1 {
+        t.Errorf("expected the only path, got: %#v", job.Result)
+    }
+}
+
+func TestRaceJob_Limits(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture, Limits: links.SearchOptions{MaxPages: 100}}
+    wr.Initialize()
+    defer wr.Close()
+
+    response, job := createRace(t, `{"from": "The Beatles", "to": "Ada Lovelace", "max_depth": 1, "max_pages": 1000}`)
+    checkResponseCode(t, http.StatusAccepted, response.StatusCode)
+    if job.MaxDepth != 1 || job.MaxPages != 100 {
+        t.Errorf("expected the limits of the job within the server's, got: %#v", job)
+    }
+
+    job = waitForRace(t, job.ID, JobDone, JobFailed)
+    if job.Status != JobFailed || job.Error == nil || job.Error.Status != http.StatusUnprocessableEntity || job.Error.LimitExceeded == nil || job.Error.LimitExceeded.Limit != links.LimitDepth {
+        t.Errorf("expected the race to reach its depth limit, got: %#v", job.Error)
+    }
+
+    response, _ = createRace(t, `{"from": "The Beatles", "to": "Ada Lovelace", "timeout_ms": -1}`)
+    checkResponseCode(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestRaceJob_Failed(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+    defer wr.Close()
+
+    // Parameters can be given in the query too
+    req, _ := http.NewRequest("POST", "/api/v1/races?from=The+Beatles&to=Los+Angeles", nil)
+    response := executeRequest(req)
+    checkResponseCode(t, http.StatusAccepted, response.Code)
+    var job Job
+    json.Unmarshal(response.Body.Bytes(), &job)
+
+    job = waitForRace(t, job.ID, JobDone, JobFailed)
+    if job.Status != JobFailed || job.Error == nil || job.Error.Code != "not_found" || job.Error.Title != "Los Angeles" {
+        t.Errorf("expected race to fail with page not found, got: %#v", job)
+    }
+
+    for _, body := range []string{`{"from": "The Beatles"}`, `{"from": `} {
+        response, _ := createRace(t, body)
+        checkResponseCode(t, http.StatusBadRequest, response.StatusCode)
+    }
+    if code, _ := getRace(t, "nope"); code != http.StatusNotFound {
+        t.Errorf("expected unknown race to be not found, got %d", code)
+    }
+    if code, _ := cancelRace(t, "nope"); code != http.StatusNotFound {
+        t.Errorf("expected unknown race to be not found, got %d", code)
+    }
+}
+
+func TestRaceJob_Cancel(t *testing.T) {
+    wr = WikiRace{Source: blockingSource{}, Workers: 1, QueueSize: 1}
+    wr.Initialize()
+    defer wr.Close()
+
+    _, running := createRace(t, `{"from": "A", "to": "B"}`)
+    waitForRace(t, running.ID, JobRunning)
+    _, queued := createRace(t, `{"from": "C", "to": "D"}`)
+
+    // The worker is busy and the queue is full
+    response, _ := createRace(t, `{"from": "E", "to": "F"}`)
+    checkResponseCode(t, http.StatusServiceUnavailable, response.StatusCode)
+
+    for _, id := range []string{queued.ID, running.ID} {
+        code, job := cancelRace(t, id)
+        if code != http.StatusOK || job.Status != JobCancelled {
+            t.Errorf("expected race %s to be cancelled, got %d: %#v", id, code, job)
+        }
+        // Cancelling again is fine
+        if code, _ := cancelRace(t, id); code != http.StatusOK {
+            t.Errorf("expected cancelling twice to succeed, got %d", code)
+        }
+    }
+
+    // The worker gets free for the next race once it has skipped the
+    // cancelled one
+    var next Job
+    for deadline := time.Now().Add(5 * time.Second); len(next.ID) == 0 && time.Now().Before(deadline); {
+        _, next = createRace(t, `{"from": "E", "to": "F"}`)
+        time.Sleep(5 * time.Millisecond)
+    }
+    waitForRace(t, next.ID, JobRunning)
+    if _, job := getRace(t, queued.ID); job.Status != JobCancelled || job.Started != nil {
+        t.Errorf("expected queued race never to start, got: %#v", job)
+    }
+}
+
+func TestRaceJob_Retention(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    dir, err := ioutil.TempDir("", "wikiracer-jobs")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    jobsFile := filepath.Join(dir, "jobs.json")
+
+    wr = WikiRace{Source: fixture, JobsFile: jobsFile}
+    wr.Initialize()
+    _, done := createRace(t, `{"from": "The Beatles", "to": "Ada Lovelace"}`)
+    waitForRace(t, done.ID, JobDone)
+    wr.Close()
+
+    // Left running when the server stopped
+    wr = WikiRace{Source: blockingSource{}, JobsFile: jobsFile}
+    wr.Initialize()
+    _, interrupted := createRace(t, `{"from": "A", "to": "B"}`)
+    waitForRace(t, interrupted.ID, JobRunning)
+    wr.Close()
+
+    wr = WikiRace{Source: fixture, JobsFile: jobsFile, JobTTL: 200 * time.Millisecond}
+    wr.Initialize()
+    defer wr.Close()
+    if _, job := getRace(t, done.ID); job.Status != JobDone || job.Result == nil || job.Result.Hops != 2 {
+        t.Errorf("expected race to be kept across restarts, got: %#v", job)
+    }
+    if _, job := getRace(t, interrupted.ID); job.Status != JobFailed {
+        t.Errorf("expected interrupted race to have failed, got: %#v", job)
+    }
+
+    time.Sleep(300 * time.Millisecond)
+    if code, _ := getRace(t, done.ID); code != http.StatusNotFound {
+        t.Errorf("expected race to expire, got %d", code)
+    }
+}
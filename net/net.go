@@ -1,15 +1,20 @@
 package net
 
 import (
+  "context"
+  "errors"
   "fmt"
+  "html"
   "io"
   "os"
   "log"
+  "strconv"
   "strings"
   "time"
   "encoding/json"
   "github.com/86me/wikiracer/links"
   "net/http"
+  "net/url"
   "github.com/gorilla/mux"
 )
 
@@ -20,10 +25,183 @@ const (
 
 type WikiRace struct {
   Router  *mux.Router
+  // Wiki races are run on, the "lang" query parameter picks another edition
+  Config  links.Config
+  // Where races look up links instead of Config, if set
+  Source  links.LinkSource
+  // Keeps the links fetched for Config across races, if set
+  Cache  *links.Cache
+  // Race jobs run at once, 2 if not set
+  Workers  int
+  // Race jobs waiting for a worker before more are turned away, 100 if not set
+  QueueSize  int
+  // How long finished race jobs are kept, an hour if not set
+  JobTTL  time.Duration
+  // File race jobs are kept in across restarts, if set
+  JobsFile  string
+  // Most any race may do, whatever it asks for
+  Limits  links.SearchOptions
+
+  jobs  *jobs
+}
+
+// Media types responses are negotiated between
+const (
+  mimeHTML = "text/html"
+  mimeJSON = "application/json"
+)
+
+// RaceResult is the JSON body of a finished race
+type RaceResult struct {
+  From string `json:"from"`
+  To string `json:"to"`
+  // Titles the pages were found under, after redirects and normalization
+  ResolvedFrom string `json:"resolved_from"`
+  ResolvedTo string `json:"resolved_to"`
+  Path []string `json:"path"`
+  // Every shortest path, up to the max_paths asked for, if all were asked for
+  Paths [][]string `json:"paths,omitempty"`
+  TotalPaths int `json:"total_paths,omitempty"`
+  Hops int `json:"hops"`
+  ElapsedMS int64 `json:"elapsed_ms"`
+  APIRequests int64 `json:"api_requests"`
+  PagesExplored int64 `json:"pages_explored"`
+  // Namespace of every page in the paths
+  Namespaces map[string]int `json:"namespaces"`
+  // What each direction of the search did
+  Stats links.Stats `json:"stats"`
+}
+
+// RaceOptions are the optional parameters of a race
+type RaceOptions struct {
+  // Find every shortest path instead of the first one
+  All bool `json:"all,omitempty"`
+  // Most paths returned when finding all of them, capped at maxPaths
+  MaxPaths int `json:"max_paths,omitempty"`
+  // Limits of the search, capped at those of the server, see
+  // links.SearchOptions
+  MaxDepth int64 `json:"max_depth,omitempty"`
+  MaxPages int64 `json:"max_pages,omitempty"`
+  MaxAPICalls int64 `json:"max_api_calls,omitempty"`
+  TimeoutMS int64 `json:"timeout_ms,omitempty"`
+  // Race mode and pipe separated namespaces of a custom one, see
+  // links.ModeNamespaces. The server's namespaces if neither is set
+  Mode string `json:"mode,omitempty"`
+  Namespaces string `json:"namespaces,omitempty"`
+  // Heuristic of a best-first search, see links.NewHeuristic. Breadth-first
+  // if empty
+  Heuristic string `json:"heuristic,omitempty"`
+}
+
+// Default and largest number of paths returned when finding all of them
+const maxPaths = 100
+
+// Returns the race options of the "all", "max_paths", search limit, mode and
+// heuristic query parameters
+func queryOptions(query url.Values) (RaceOptions, error) {
+  options := RaceOptions{Mode: query.Get("mode"), Namespaces: query.Get("namespaces"), Heuristic: query.Get("heuristic")}
+  if all := query.Get("all"); len(all) > 0 {
+    var err error
+    if options.All, err = strconv.ParseBool(all); err != nil {
+      return options, fmt.Errorf("invalid all: %q", all)
+    }
+  }
+  if max := query.Get("max_paths"); len(max) > 0 {
+    var err error
+    if options.MaxPaths, err = strconv.Atoi(max); err != nil || options.MaxPaths < 0 {
+      return options, fmt.Errorf("invalid max_paths: %q", max)
+    }
+  }
+  for _, limit := range []struct {
+    name string
+    value *int64
+  }{
+    {"max_depth", &options.MaxDepth},
+    {"max_pages", &options.MaxPages},
+    {"max_api_calls", &options.MaxAPICalls},
+    {"timeout_ms", &options.TimeoutMS},
+  } {
+    if value := query.Get(limit.name); len(value) > 0 {
+      var err error
+      if *limit.value, err = strconv.ParseInt(value, 10, 64); err != nil || *limit.value < 0 {
+        return options, fmt.Errorf("invalid %s: %q", limit.name, value)
+      }
+    }
+  }
+  return options, nil
+}
+
+// limit caps the search limits of options at those of the server
+func (wr *WikiRace) limit(options RaceOptions) RaceOptions {
+  capped := func(value *int64, max int64) {
+    if max > 0 && (*value == 0 || *value > max) {
+      *value = max
+    }
+  }
+  capped(&options.MaxDepth, int64(wr.Limits.MaxDepth))
+  capped(&options.MaxPages, wr.Limits.MaxPages)
+  capped(&options.MaxAPICalls, wr.Limits.MaxRequests)
+  capped(&options.TimeoutMS, wr.Limits.Timeout.Milliseconds())
+  return options
+}
+
+// mode sets the namespaces of options to those of its mode, or to the
+// server's if it has none, and checks its heuristic
+func (wr *WikiRace) mode(options RaceOptions) (RaceOptions, error) {
+  if err := links.ValidateHeuristic(options.Heuristic); err != nil {
+    return options, err
+  }
+  if len(options.Mode) == 0 && len(options.Namespaces) == 0 {
+    options.Namespaces = wr.Config.Namespaces
+    return options, nil
+  }
+  var err error
+  options.Namespaces, err = links.ModeNamespaces(options.Mode, options.Namespaces)
+  return options, err
+}
+
+// searchOptions returns the limits of the search of a race on source, the
+// namespaces it goes through and its heuristic
+func (options RaceOptions) searchOptions(source links.LinkSource) links.SearchOptions {
+  // Namespaces and the heuristic were checked by mode
+  namespaces, _ := links.ParseNamespaces(options.Namespaces)
+  if len(options.Namespaces) == 0 {
+    namespaces = nil
+  }
+  heuristic, _ := links.NewHeuristic(options.Heuristic, source)
+  return links.SearchOptions{
+    MaxDepth: int(options.MaxDepth),
+    MaxPages: options.MaxPages,
+    MaxRequests: options.MaxAPICalls,
+    Timeout: time.Duration(options.TimeoutMS) * time.Millisecond,
+    Namespaces: namespaces,
+    Heuristic: heuristic,
+  }
+}
+
+// APIError is the JSON body of every error response
+type APIError struct {
+  Error string `json:"error"`
+  // Snake cased HTTP status text, eg. "not_found"
+  Code string `json:"code"`
+  Status int `json:"status"`
+  // Page that doesn't exist, with similar titles
+  Title string `json:"title,omitempty"`
+  Suggestions []string `json:"suggestions,omitempty"`
+  // Limit a search reached, and how far it got
+  LimitExceeded *links.LimitError `json:"limit_exceeded,omitempty"`
 }
 
 func (wr *WikiRace) Initialize() {
+  wr.startJobs()
   wr.Router = mux.NewRouter()
+  wr.Router.HandleFunc("/api/v1/race", wr.APIRace).Methods("GET")
+  wr.Router.HandleFunc("/api/v1/races", wr.CreateRace).Methods("POST")
+  wr.Router.HandleFunc("/api/v1/races/{id}", wr.GetRace).Methods("GET")
+  wr.Router.HandleFunc("/api/v1/races/{id}", wr.CancelRace).Methods("DELETE")
+  wr.Router.HandleFunc("/api/v1/races/{id}/events", wr.RaceEvents).Methods("GET")
+  wr.Router.HandleFunc("/api/v1/verify", wr.VerifyPath).Methods("POST")
+  wr.Router.HandleFunc("/api/v1/openapi.json", wr.GetOpenAPI).Methods("GET")
   wr.Router.HandleFunc("/", wr.GetHelp).Methods("GET")
   wr.Router.HandleFunc("/{from}", wr.RunRace).Methods("GET")
   wr.Router.HandleFunc("/{from}/{to}", wr.RunRace).Methods("GET")
@@ -38,47 +216,256 @@ func (wr *WikiRace) GetHelp(w http.ResponseWriter, r *http.Request) {
   type Help struct {
     Body string
   }
-  //responseJSON := Help{Body: "Example usage: /Ada Lovelace/Susan B. Anthony"}
-  //respondWithJSON(w, http.StatusOK, responseJSON)
+  if negotiate(r, mimeJSON) == mimeJSON {
+    responseJSON := Help{Body: "Example usage: /Ada Lovelace/Susan B. Anthony"}
+    respondWithJSON(w, http.StatusOK, responseJSON)
+    return
+  }
   responseHTML := `<h1>WikiRacer `+Version+`</h1><br/>
         <h2>Example usage:</h2>
-        <p>http://localhost:8686/Ada Lovelace/Susan B. Anthony</p><br/>`
+        <p>http://localhost:8686/Ada Lovelace/Susan B. Anthony</p>
+        <p>http://localhost:8686/api/v1/race?from=Ada Lovelace&amp;to=Susan B. Anthony</p><br/>`
   respondWithHTML(w, http.StatusOK, responseHTML)
 }
 
+// GetOpenAPI serves the OpenAPI document describing the JSON API
+func (wr *WikiRace) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Content-Type", "application/json; charset=utf-8")
+  w.WriteHeader(http.StatusOK)
+  io.WriteString(w, openAPI)
+}
+
+// RunRace races between the pages in the path, answering in HTML unless JSON
+// is asked for
 func (wr *WikiRace) RunRace(w http.ResponseWriter, r *http.Request) {
   vars := mux.Vars(r)
-  from := vars["from"]
-  to := vars["to"]
+  wr.race(w, r, vars["from"], vars["to"], negotiate(r, mimeHTML))
+}
+
+// APIRace races between the "from" and "to" query parameters, answering in
+// JSON unless HTML is asked for
+func (wr *WikiRace) APIRace(w http.ResponseWriter, r *http.Request) {
+  query := r.URL.Query()
+  wr.race(w, r, query.Get("from"), query.Get("to"), negotiate(r, mimeJSON))
+}
+
+func (wr *WikiRace) race(w http.ResponseWriter, r *http.Request, from, to, mediaType string) {
   if len(from) == 0 || len(to) == 0 {
     respondWithError(w, http.StatusBadRequest, "Insufficient parameters")
     return
   }
+  options, err := queryOptions(r.URL.Query())
+  if err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  options = wr.limit(options)
+  if options, err = wr.mode(options); err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
 
   s := fmt.Sprintf("[%s] Remote request for %s -> %s\n", r.RemoteAddr, from, to)
   io.WriteString(os.Stdout, s)
 
   startTime := time.Now()
   // Run remote wiki race request
-  graph := links.NewPageGraph()
-  var links []string
+  source, err := wr.source(r.URL.Query().Get("lang"), options.Namespaces)
+  if err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  graph := links.NewPageGraph(source)
 
-  for _, page := range graph.Search(from, to) {
-    links = append(links, page)
+  // Abort the race if the client goes away
+  result, err := search(r.Context(), graph, source, from, to, options, startTime)
+  if err != nil {
+    log.Printf("[%s] Race %s -> %s failed: %s", r.RemoteAddr, from, to, err)
+    respondWithRaceError(w, err)
+    return
+  }
+
+  if mediaType == mimeJSON {
+    respondWithJSON(w, http.StatusOK, result)
+    return
+  }
+
+  // Mention titles that were redirects or got normalized
+  resolved := ""
+  for _, title := range [][2]string{{from, result.ResolvedFrom}, {to, result.ResolvedTo}} {
+    if title[0] != title[1] {
+      resolved += `
+            <p>`+html.EscapeString(title[0])+` &rarr; `+html.EscapeString(title[1])+`</p>`
+    }
+  }
+
+  paths := ""
+  if options.All {
+    for _, path := range result.Paths {
+      paths += `
+            <p>`+htmlPath(path)+`</p>`
+    }
+    paths += fmt.Sprintf(`
+            <p>%d of %d shortest paths</p><br/>`, len(result.Paths), result.TotalPaths)
+  } else {
+    paths = `
+            <p>`+htmlPath(result.Path)+`</p><br/>`
   }
-  // Path found. Stop further depth searches
-  graph.Stop()
 
   elapsed_time := time.Since(startTime)
   responseHTML := `<h1>WikiRacer `+Version+`</h1><br/>
-            <h2>From `+from+` to `+to+`:</h2>
-            <p>`+strings.Join(links, ` &rarr; `)+`</p><br/>
+            <h2>From `+html.EscapeString(from)+` to `+html.EscapeString(to)+`:</h2>`+resolved+paths+`
             <small>Elapsed time: `+elapsed_time.String()+`</small>`
   respondWithHTML(w, http.StatusOK, responseHTML)
 }
 
+// htmlPath returns the titles of path as HTML, one arrow apart
+func htmlPath(path []string) string {
+  escaped := make([]string, len(path))
+  for i, title := range path {
+    escaped[i] = html.EscapeString(title)
+  }
+  return strings.Join(escaped, ` &rarr; `)
+}
+
+// Runs a race on graph, which looks up links in source
+func search(ctx context.Context, graph *links.PageGraph, source links.LinkSource, from, to string, options RaceOptions, startTime time.Time) (RaceResult, error) {
+  var found links.Result
+  var err error
+  if options.All {
+    limit := options.MaxPaths
+    if limit <= 0 || limit > maxPaths {
+      limit = maxPaths
+    }
+    found, err = graph.SearchAllResult(ctx, from, to, limit, options.searchOptions(source))
+  } else {
+    found, err = graph.SearchResult(ctx, from, to, options.searchOptions(source))
+  }
+  if err != nil {
+    return RaceResult{}, err
+  }
+
+  result := RaceResult{
+    From: from,
+    To: to,
+    ResolvedFrom: graph.Resolve(from),
+    ResolvedTo: graph.Resolve(to),
+    Path: found.Path,
+    Hops: len(found.Path) - 1,
+    ElapsedMS: time.Since(startTime).Milliseconds(),
+    APIRequests: requests(source),
+    PagesExplored: graph.Explored(),
+    Namespaces: found.Namespaces,
+    Stats: found.Stats,
+  }
+  if options.All {
+    result.Paths = found.Paths
+    result.TotalPaths = found.TotalPaths
+  }
+  return result, nil
+}
+
+// Returns the number of API requests source made, if it counts them
+func requests(source links.LinkSource) int64 {
+  if counter, ok := source.(links.RequestCounter); ok {
+    return counter.Requests()
+  }
+  return 0
+}
+
+// Returns whichever of HTML and JSON the Accept header of r prefers, or
+// fallback if it prefers neither
+func negotiate(r *http.Request, fallback string) string {
+  best, bestQ := fallback, 0.0
+  for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+    params := strings.Split(accepted, ";")
+    mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+    q := 1.0
+    for _, param := range params[1:] {
+      kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+      if len(kv) == 2 && kv[0] == "q" {
+        if value, err := strconv.ParseFloat(kv[1], 64); err == nil {
+          q = value
+        }
+      }
+    }
+    if (mediaType == mimeHTML || mediaType == mimeJSON) && q > bestQ {
+      best, bestQ = mediaType, q
+    }
+  }
+  return best
+}
+
+// Returns the source of links for a race on the Wikipedia edition lang, or
+// the configured wiki if lang is empty, following links into namespaces, or
+// the configured ones if empty
+func (wr *WikiRace) source(lang, namespaces string) (links.LinkSource, error) {
+  if wr.Source != nil {
+    return wr.Source, nil
+  }
+  config := wr.Config
+  if len(lang) > 0 {
+    config.Lang = lang
+    config.Endpoint = ""
+  }
+  if len(namespaces) > 0 {
+    config.Namespaces = namespaces
+  }
+  if err := config.Validate(); err != nil {
+    return nil, err
+  }
+  if wr.Cache != nil {
+    return wr.Cache.Source(links.NewSource(config), config.Wiki()), nil
+  }
+  return links.NewSource(config), nil
+}
+
+// Maps a failed race to an HTTP status code. Wikipedia API and network
+// errors are reported as a bad gateway
+func errorStatus(err error) int {
+  switch {
+  case errors.Is(err, links.ErrNoPath), errors.Is(err, links.ErrPageMissing):
+    return http.StatusNotFound
+  case errors.Is(err, links.ErrLimitExceeded):
+    return http.StatusUnprocessableEntity
+  case errors.Is(err, links.ErrRateLimited):
+    return http.StatusTooManyRequests
+  case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+    return http.StatusServiceUnavailable
+  default:
+    return http.StatusBadGateway
+  }
+}
+
+// Responds with a failed race's error, including "did you mean" suggestions
+// for pages that don't exist
+func respondWithRaceError(w http.ResponseWriter, err error) {
+  response := raceError(err)
+  respondWithJSON(w, response.Status, response)
+}
+
+// Returns the APIError describing why a race failed
+func raceError(err error) APIError {
+  response := apiError(errorStatus(err), err.Error())
+  var notFound *links.PageNotFoundError
+  if errors.As(err, &notFound) {
+    response.Title = notFound.Title
+    response.Suggestions = notFound.Suggestions
+  }
+  errors.As(err, &response.LimitExceeded)
+  return response
+}
+
+func apiError(code int, message string) APIError {
+  return APIError{
+    Error: message,
+    Code: strings.ReplaceAll(strings.ToLower(http.StatusText(code)), " ", "_"),
+    Status: code,
+  }
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
-  respondWithJSON(w, code, map[string]string{"error": message})
+  respondWithJSON(w, code, apiError(code, message))
 }
 
 func respondWithHTML(w http.ResponseWriter, code int, response string) {
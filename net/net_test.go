@@ -1,10 +1,17 @@
 package net
 
 import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
     "net/http"
     "net/http/httptest"
+    "net/url"
     "testing"
     "regexp"
+    "strings"
+    "github.com/86me/wikiracer/links"
 )
 
 var wr WikiRace
@@ -42,7 +49,11 @@ func TestGetHelp(t *testing.T) {
 }
 
 func TestRunRace(t *testing.T) {
-    wr = WikiRace{}
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
     wr.Initialize()
 
     req, _ := http.NewRequest("GET", "/The Beatles/Ada Lovelace", nil)
@@ -54,17 +65,456 @@ func TestRunRace(t *testing.T) {
         t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
     }
 
-    // Remove elapsed time to help match response. Will sometimes fail depending
-    // on path found. Could be reworked to a more stable page path.
-    re := regexp.MustCompile(`Elapsed time: [0-9].[0-9]*s`)
+    // Remove elapsed time to help match response
+    re := regexp.MustCompile(`Elapsed time: [^<]*`)
 
     expected := `<h1>WikiRacer 0.86</h1><br/>
-                <h2>From The Beatles to Ada Lovelace:</h2>
-                <p>The Beatles &rarr; Los Angeles Times &rarr; Ada Lovelace</p><br/>
-                <small></small>`
+            <h2>From The Beatles to Ada Lovelace:</h2>
+            <p>The Beatles &rarr; Los Angeles Times &rarr; Ada Lovelace</p><br/>
+            <small></small>`
 
     response_regex := re.ReplaceAllString(response.Body.String(), "")
     if response_regex != expected {
         t.Errorf("Handler returned unexpected body: got '%v' want '%v'", response_regex, expected)
     }
 }
+
+func TestRunRace_Redirect(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    fixture.Redirects["The Fab Four"] = "The Beatles"
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+
+    req, _ := http.NewRequest("GET", "/The Fab Four/Ada Lovelace", nil)
+    response := executeRequest(req)
+
+    checkResponseCode(t, http.StatusOK, response.Code)
+
+    for _, expected := range []string{
+        `<p>The Fab Four &rarr; The Beatles</p>`,
+        `<p>The Beatles &rarr; Los Angeles Times &rarr; Ada Lovelace</p>`,
+    } {
+        if !strings.Contains(response.Body.String(), expected) {
+            t.Errorf("expected to find %#v in %#v", expected, response.Body.String())
+        }
+    }
+}
+
+func TestRunRace_PageNotFound(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+
+    req, _ := http.NewRequest("GET", "/The Beatles/Los Angeles", nil)
+    response := executeRequest(req)
+
+    checkResponseCode(t, http.StatusNotFound, response.Code)
+
+    var body struct {
+        Title       string
+        Suggestions []string
+    }
+    if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if body.Title != "Los Angeles" || len(body.Suggestions) != 1 || body.Suggestions[0] != "Los Angeles Times" {
+        t.Errorf("unexpected response: %s", response.Body.String())
+    }
+}
+
+func TestRunRace_InvalidLang(t *testing.T) {
+    wr = WikiRace{}
+    wr.Initialize()
+
+    req, _ := http.NewRequest("GET", "/Berlin/Paris?lang=evil.com%2F", nil)
+    response := executeRequest(req)
+
+    checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestErrorStatus(t *testing.T) {
+    tests := []struct {
+        err    error
+        expect int
+    }{
+        {links.ErrNoPath, http.StatusNotFound},
+        {fmt.Errorf("%w: Nowhere", links.ErrPageMissing), http.StatusNotFound},
+        {links.ErrRateLimited, http.StatusTooManyRequests},
+        {&links.ErrAPI{Code: "badvalue", Info: "nope"}, http.StatusBadGateway},
+        {context.Canceled, http.StatusServiceUnavailable},
+        {errors.New("connection refused"), http.StatusBadGateway},
+    }
+
+    for i, test := range tests {
+        if got := errorStatus(test.err); got != test.expect {
+            t.Errorf("tests[%d]: expected %d, got %d", i, test.expect, got)
+        }
+    }
+}
+
+func TestAPIRace(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    fixture.Redirects["The Fab Four"] = "The Beatles"
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+
+    req, _ := http.NewRequest("GET", "/api/v1/race?from=The+Fab+Four&to=Ada+Lovelace", nil)
+    response := executeRequest(req)
+
+    checkResponseCode(t, http.StatusOK, response.Code)
+    if contentType := response.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+        t.Errorf("expected JSON, got %s", contentType)
+    }
+
+    var result RaceResult
+    if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+        t.Fatal(err)
+    }
+    if result.From != "The Fab Four" || result.To != "Ada Lovelace" || result.ResolvedFrom != "The Beatles" || result.ResolvedTo != "Ada Lovelace" {
+        t.Errorf("unexpected titles: %#v", result)
+    }
+    if strings.Join(result.Path, "|") != "The Beatles|Los Angeles Times|Ada Lovelace" || result.Hops != 2 {
+        t.Errorf("unexpected path: %#v", result)
+    }
+    if result.PagesExplored < 2 {
+        t.Errorf("expected at least both pages to be explored, got %d", result.PagesExplored)
+    }
+
+    // Every field is present
+    var fields map[string]interface{}
+    json.Unmarshal(response.Body.Bytes(), &fields)
+    for _, field := range []string{"from", "to", "resolved_from", "resolved_to", "path", "hops", "elapsed_ms", "api_requests", "pages_explored", "stats"} {
+        if _, ok := fields[field]; !ok {
+            t.Errorf("expected %s in %s", field, response.Body.String())
+        }
+    }
+    forward := result.Stats.Forward
+    if len(forward.Expanded) == 0 || forward.Reached[0] != 1 || forward.Links == 0 {
+        t.Errorf("unexpected stats: %#v", result.Stats)
+    }
+}
+
+func TestAPIRace_Negotiate(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+
+    tests := []struct {
+        url    string
+        accept string
+        expect string
+    }{
+        {"/api/v1/race?from=The+Beatles&to=Ada+Lovelace", "", "application/json"},
+        {"/api/v1/race?from=The+Beatles&to=Ada+Lovelace", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html"},
+        {"/The Beatles/Ada Lovelace", "", "text/html"},
+        {"/The Beatles/Ada Lovelace", "*/*", "text/html"},
+        {"/The Beatles/Ada Lovelace", "text/html;q=0.5, application/json", "application/json"},
+        {"/", "", "application/json"},
+        {"/", "text/html", "text/html"},
+    }
+
+    for i, test := range tests {
+        req, _ := http.NewRequest("GET", test.url, nil)
+        if len(test.accept) > 0 {
+            req.Header.Set("Accept", test.accept)
+        }
+        response := executeRequest(req)
+        checkResponseCode(t, http.StatusOK, response.Code)
+        if contentType := response.Header().Get("Content-Type"); !strings.HasPrefix(contentType, test.expect) {
+            t.Errorf("tests[%d]: expected %s, got %s", i, test.expect, contentType)
+        }
+    }
+}
+
+func TestAPIRace_Errors(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+
+    tests := []struct {
+        url    string
+        status int
+        code   string
+    }{
+        {"/api/v1/race?from=The+Beatles", http.StatusBadRequest, "bad_request"},
+        {"/api/v1/race?from=The+Beatles&to=Los+Angeles", http.StatusNotFound, "not_found"},
+    }
+
+    for i, test := range tests {
+        // Errors are JSON even when HTML is asked for
+        req, _ := http.NewRequest("GET", test.url, nil)
+        req.Header.Set("Accept", "text/html")
+        response := executeRequest(req)
+        checkResponseCode(t, test.status, response.Code)
+
+        var body APIError
+        if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+            t.Fatalf("tests[%d]: %s", i, err)
+        }
+        if body.Code != test.code || body.Status != test.status || len(body.Error) == 0 {
+            t.Errorf("tests[%d]: unexpected error: %s", i, response.Body.String())
+        }
+    }
+}
+
+func TestAPIRace_EscapesHTML(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    title := "<script>alert(1)</script>"
+    fixture.Outgoing[title] = []string{"Ada Lovelace"}
+    fixture.Incoming["Ada Lovelace"] = append(fixture.Incoming["Ada Lovelace"], title)
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+
+    for _, all := range []string{"false", "true"} {
+        req, _ := http.NewRequest("GET", "/api/v1/race?from="+url.QueryEscape(title)+"&to=Ada+Lovelace&all="+all, nil)
+        req.Header.Set("Accept", "text/html")
+        response := executeRequest(req)
+        checkResponseCode(t, http.StatusOK, response.Code)
+
+        body := response.Body.String()
+        if strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;") {
+            t.Errorf("all=%s: expected the title to be escaped: %s", all, body)
+        }
+    }
+}
+
+func TestAPIRace_All(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // A second shortest path, through Rock music
+    fixture.Outgoing["Rock music"] = append(fixture.Outgoing["Rock music"], "Ada Lovelace")
+    fixture.Incoming["Ada Lovelace"] = append(fixture.Incoming["Ada Lovelace"], "Rock music")
+    wr = WikiRace{Source: fixture}
+    wr.Initialize()
+
+    tests := []struct {
+        url   string
+        paths []string
+        total int
+    }{
+        {"/api/v1/race?from=The+Beatles&to=Ada+Lovelace&all=true", []string{
+            "The Beatles|Los Angeles Times|Ada Lovelace",
+            "The Beatles|Rock music|Ada Lovelace",
+        }, 2},
+        {"/api/v1/race?from=The+Beatles&to=Ada+Lovelace&all=1&max_paths=1", []string{
+            "The Beatles|Los Angeles Times|Ada Lovelace",
+        }, 2},
+        {"/api/v1/race?from=The+Beatles&to=Ada+Lovelace&all=false", nil, 0},
+    }
+
+    for i, test := range tests {
+        req, _ := http.NewRequest("GET", test.url, nil)
+        response := executeRequest(req)
+        checkResponseCode(t, http.StatusOK, response.Code)
+
+        var result RaceResult
+        if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+            t.Fatalf("tests[%d]: %s", i, err)
+        }
+        paths := []string{}
+        for _, path := range result.Paths {
+            paths = append(paths, strings.Join(path, "|"))
+        }
+        if strings.Join(paths, ",") != strings.Join(test.paths, ",") || result.TotalPaths != test.total {
+            t.Errorf("tests[%d]: unexpected paths: %s", i, response.Body.String())
+        }
+        if result.Hops != 2 || len(result.Path) != 3 {
+            t.Errorf("tests[%d]: unexpected path: %#v", i, result.Path)
+        }
+    }
+
+    // Every path is listed in HTML
+    req, _ := http.NewRequest("GET", "/The Beatles/Ada Lovelace?all=true", nil)
+    response := executeRequest(req)
+    checkResponseCode(t, http.StatusOK, response.Code)
+    if body := response.Body.String(); !strings.Contains(body, "Rock music") || !strings.Contains(body, "2 of 2 shortest paths") {
+        t.Errorf("expected both paths, got %s", body)
+    }
+
+    for _, url := range []string{"/api/v1/race?from=The+Beatles&to=Ada+Lovelace&all=maybe", "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&all=true&max_paths=-1"} {
+        req, _ := http.NewRequest("GET", url, nil)
+        checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+    }
+}
+
+func TestAPIRace_Limits(t *testing.T) {
+    fixture, err := links.LoadFixture("testdata/race.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        limits links.SearchOptions
+        url    string
+        status int
+    }{
+        {links.SearchOptions{}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&max_depth=2", http.StatusOK},
+        {links.SearchOptions{}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&max_depth=1", http.StatusUnprocessableEntity},
+        {links.SearchOptions{}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&max_pages=1&all=true", http.StatusUnprocessableEntity},
+        // Races can't ask for more than the server allows
+        {links.SearchOptions{MaxDepth: 1}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace", http.StatusUnprocessableEntity},
+        {links.SearchOptions{MaxDepth: 1}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&max_depth=5", http.StatusUnprocessableEntity},
+        {links.SearchOptions{MaxDepth: 5}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&max_depth=1", http.StatusUnprocessableEntity},
+        {links.SearchOptions{}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&max_pages=-1", http.StatusBadRequest},
+        {links.SearchOptions{}, "/api/v1/race?from=The+Beatles&to=Ada+Lovelace&timeout_ms=soon", http.StatusBadRequest},
+    }
+
+    for i, test := range tests {
+        wr = WikiRace{Source: fixture, Limits: test.limits}
+        wr.Initialize()
+
+        req, _ := http.NewRequest("GET", test.url, nil)
+        response := executeRequest(req)
+        if response.Code != test.status {
+            t.Errorf("tests[%d]: expected %d, got %d: %s", i, test.status, response.Code, response.Body.String())
+            continue
+        }
+        if test.status != http.StatusUnprocessableEntity {
+            continue
+        }
+
+        var body APIError
+        if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+            t.Fatalf("tests[%d]: %s", i, err)
+        }
+        if body.LimitExceeded == nil || len(body.LimitExceeded.Limit) == 0 || body.LimitExceeded.Forward.Pages == 0 {
+            t.Errorf("tests[%d]: expected how far the race got, got %s", i, response.Body.String())
+        }
+    }
+}
+
+func TestAPIRace_Modes(t *testing.T) {
+    // The shortest path goes through a category
+    graph := links.NewMemoryGraph(links.Links{
+        "Start":             {"Category:Shortcut", "A"},
+        "Category:Shortcut": {"Target"},
+        "A":                 {"B"},
+        "B":                 {"Target"},
+    })
+
+    tests := []struct {
+        config links.Config
+        query  string
+        status int
+        path   string
+    }{
+        {links.Config{}, "", http.StatusOK, "Start|Category:Shortcut|Target"},
+        {links.Config{}, "&mode=loose", http.StatusOK, "Start|Category:Shortcut|Target"},
+        {links.Config{}, "&mode=strict", http.StatusOK, "Start|A|B|Target"},
+        {links.Config{}, "&mode=custom&namespaces=0|14", http.StatusOK, "Start|Category:Shortcut|Target"},
+        {links.Config{}, "&namespaces=0", http.StatusOK, "Start|A|B|Target"},
+        // Races go through the server's namespaces unless they ask otherwise
+        {links.Config{Namespaces: "0"}, "", http.StatusOK, "Start|A|B|Target"},
+        {links.Config{Namespaces: "0"}, "&mode=loose", http.StatusOK, "Start|Category:Shortcut|Target"},
+        {links.Config{}, "&mode=human", http.StatusBadRequest, ""},
+        {links.Config{}, "&mode=strict&namespaces=0", http.StatusBadRequest, ""},
+        {links.Config{}, "&mode=custom&namespaces=Category", http.StatusBadRequest, ""},
+    }
+
+    for i, test := range tests {
+        wr = WikiRace{Source: graph, Config: test.config}
+        wr.Initialize()
+
+        req, _ := http.NewRequest("GET", "/api/v1/race?from=Start&to=Target"+test.query, nil)
+        response := executeRequest(req)
+        if response.Code != test.status {
+            t.Errorf("tests[%d]: expected %d, got %d: %s", i, test.status, response.Code, response.Body.String())
+            continue
+        }
+        if test.status != http.StatusOK {
+            continue
+        }
+
+        var result RaceResult
+        if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+            t.Fatalf("tests[%d]: %s", i, err)
+        }
+        if strings.Join(result.Path, "|") != test.path {
+            t.Errorf("tests[%d]: unexpected path: %s", i, response.Body.String())
+        }
+        if ns, ok := result.Namespaces[result.Path[1]]; !ok || (ns == 14) != strings.HasPrefix(result.Path[1], "Category:") {
+            t.Errorf("tests[%d]: unexpected namespaces: %s", i, response.Body.String())
+        }
+    }
+}
+
+func TestAPIRace_Heuristic(t *testing.T) {
+    // Titles sharing words with the target lead to it the long way round
+    wr = WikiRace{Source: links.NewMemoryGraph(links.Links{
+        "Start":       {"Zed", "Target road"},
+        "Zed":         {"Target"},
+        "Target road": {"Target lane"},
+        "Target lane": {"Target"},
+    })}
+    wr.Initialize()
+
+    tests := []struct {
+        query  string
+        status int
+        path   string
+    }{
+        {"", http.StatusOK, "Start|Zed|Target"},
+        {"&heuristic=title", http.StatusOK, "Start|Target road|Target lane|Target"},
+        {"&heuristic=closest", http.StatusBadRequest, ""},
+    }
+    for i, test := range tests {
+        req, _ := http.NewRequest("GET", "/api/v1/race?from=Start&to=Target"+test.query, nil)
+        response := executeRequest(req)
+        if response.Code != test.status {
+            t.Errorf("tests[%d]: expected %d, got %d: %s", i, test.status, response.Code, response.Body.String())
+            continue
+        }
+        if test.status != http.StatusOK {
+            continue
+        }
+
+        var result RaceResult
+        if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+            t.Fatalf("tests[%d]: %s", i, err)
+        }
+        if strings.Join(result.Path, "|") != test.path {
+            t.Errorf("tests[%d]: unexpected path: %s", i, response.Body.String())
+        }
+    }
+}
+
+func TestGetOpenAPI(t *testing.T) {
+    wr = WikiRace{}
+    wr.Initialize()
+
+    req, _ := http.NewRequest("GET", "/api/v1/openapi.json", nil)
+    response := executeRequest(req)
+
+    checkResponseCode(t, http.StatusOK, response.Code)
+
+    var doc struct {
+        OpenAPI string
+        Paths   map[string]interface{}
+    }
+    if err := json.Unmarshal(response.Body.Bytes(), &doc); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := doc.Paths["/api/v1/race"]; !ok || len(doc.OpenAPI) == 0 {
+        t.Errorf("unexpected document: %s", response.Body.String())
+    }
+}
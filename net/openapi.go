@@ -0,0 +1,300 @@
+package net
+
+// openAPI describes the JSON API, served at /api/v1/openapi.json
+const openAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "WikiRacer",
+    "version": "` + Version + `",
+    "description": "Finds the shortest path of links between two Wikipedia pages."
+  },
+  "paths": {
+    "/api/v1/race": {
+      "get": {
+        "summary": "Race between two pages",
+        "description": "Answers in JSON unless the Accept header prefers text/html.",
+        "parameters": [
+          {"name": "from", "in": "query", "required": true, "schema": {"type": "string"}, "description": "Title of the page to start from"},
+          {"name": "to", "in": "query", "required": true, "schema": {"type": "string"}, "description": "Title of the page to reach"},
+          {"name": "lang", "in": "query", "schema": {"type": "string"}, "description": "Wikipedia language code to race on instead of the server's"},
+          {"name": "all", "in": "query", "schema": {"type": "boolean"}, "description": "Find every shortest path instead of the first one"},
+          {"name": "max_paths", "in": "query", "schema": {"type": "integer", "minimum": 0, "maximum": 100, "default": 100}, "description": "Most paths returned when finding all of them"},
+          {"name": "max_depth", "in": "query", "schema": {"type": "integer", "minimum": 0}, "description": "Give up on paths longer than this many links"},
+          {"name": "max_pages", "in": "query", "schema": {"type": "integer", "minimum": 0}, "description": "Give up after requesting the links of this many pages"},
+          {"name": "max_api_calls", "in": "query", "schema": {"type": "integer", "minimum": 0}, "description": "Give up after this many API requests"},
+          {"name": "timeout_ms", "in": "query", "schema": {"type": "integer", "minimum": 0}, "description": "Give up after this many milliseconds. The server's own limits apply whatever is asked for"},
+          {"name": "mode", "in": "query", "schema": {"type": "string", "enum": ["strict", "loose", "custom"]}, "description": "Go through articles only, articles, categories and portals, or the namespaces given. The server's namespaces if neither mode nor namespaces are given"},
+          {"name": "namespaces", "in": "query", "schema": {"type": "string"}, "description": "Pipe separated namespace numbers of the custom mode, eg. 0|14"},
+          {"name": "heuristic", "in": "query", "schema": {"type": "string", "enum": ["title", "categories", "inbound"]}, "description": "Search forward best-first, expanding the pages scored highest first: by the words their titles share with the target's, the categories they share with it, or the pages linking to them. Paths found may not be shortest"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Path found",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/RaceResult"}},
+              "text/html": {"schema": {"type": "string"}}
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"description": "Either page does not exist, or no path links them", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "422": {"description": "The race reached a limit before finding a path", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "429": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"},
+          "503": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/races": {
+      "post": {
+        "summary": "Start a race in the background",
+        "description": "Parameters can also be given in the query string.",
+        "requestBody": {
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RaceRequest"}}}
+        },
+        "responses": {
+          "202": {
+            "description": "Race queued, poll the Location header for its status",
+            "headers": {"Location": {"schema": {"type": "string"}}},
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Job"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "503": {"description": "Too many races queued", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+        }
+      }
+    },
+    "/api/v1/races/{id}": {
+      "parameters": [
+        {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Status of a background race",
+        "responses": {
+          "200": {"description": "Race", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Job"}}}},
+          "404": {"description": "No such race, or it expired", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+        }
+      },
+      "delete": {
+        "summary": "Cancel a background race",
+        "responses": {
+          "200": {"description": "Race cancelled", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Job"}}}},
+          "404": {"description": "No such race, or it expired", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "409": {"description": "Race already done or failed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+        }
+      }
+    },
+    "/api/v1/races/{id}/events": {
+      "parameters": [
+        {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Stream the events of a background race",
+        "description": "Server-Sent Events, or a WebSocket of JSON messages if the request upgrades to one. Streams start and end with a status event holding the job.",
+        "responses": {
+          "200": {"description": "Event stream", "content": {"text/event-stream": {"schema": {"$ref": "#/components/schemas/Event"}}}},
+          "101": {"description": "WebSocket of events"},
+          "404": {"description": "No such race, or it expired", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+        }
+      }
+    },
+    "/api/v1/verify": {
+      "post": {
+        "summary": "Check that each page of a path links to the next",
+        "description": "Redirects are followed. Only the links a race would follow count, through the server's namespaces unless mode or namespaces are given.",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/VerifyRequest"}}}
+        },
+        "responses": {
+          "200": {"description": "Path checked, valid or not", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Verification"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"},
+          "503": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/openapi.json": {
+      "get": {
+        "summary": "This document",
+        "responses": {
+          "200": {"description": "OpenAPI document", "content": {"application/json": {}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "RaceResult": {
+        "type": "object",
+        "required": ["from", "to", "resolved_from", "resolved_to", "path", "hops", "elapsed_ms", "api_requests", "pages_explored", "namespaces", "stats"],
+        "properties": {
+          "from": {"type": "string"},
+          "to": {"type": "string"},
+          "resolved_from": {"type": "string", "description": "Title from resolves to after redirects and normalization"},
+          "resolved_to": {"type": "string", "description": "Title to resolves to after redirects and normalization"},
+          "path": {"type": "array", "items": {"type": "string"}},
+          "paths": {"type": "array", "items": {"type": "array", "items": {"type": "string"}}, "description": "Every shortest path, up to max_paths, when all were asked for"},
+          "total_paths": {"type": "integer", "description": "How many shortest paths there are, when all were asked for"},
+          "hops": {"type": "integer"},
+          "elapsed_ms": {"type": "integer"},
+          "api_requests": {"type": "integer", "description": "Requests made to the MediaWiki API, 0 when racing offline"},
+          "pages_explored": {"type": "integer", "description": "Pages whose links were requested"},
+          "namespaces": {"type": "object", "additionalProperties": {"type": "integer"}, "description": "Namespace of every page in the paths"},
+          "stats": {
+            "type": "object",
+            "description": "What each direction of the search did",
+            "properties": {
+              "forward": {"$ref": "#/components/schemas/DirectionStats"},
+              "backward": {"$ref": "#/components/schemas/DirectionStats"}
+            }
+          }
+        }
+      },
+      "DirectionStats": {
+        "type": "object",
+        "properties": {
+          "expanded": {"type": "array", "items": {"type": "integer"}, "description": "Pages whose links were requested at each depth"},
+          "reached": {"type": "array", "items": {"type": "integer"}, "description": "Pages first reached at each depth, starting with the page the direction started from"},
+          "links": {"type": "integer", "description": "Links received"},
+          "api_requests": {"type": "integer"},
+          "bytes": {"type": "integer", "description": "Size of the API responses"},
+          "continuations": {"type": "integer", "description": "Pages of results followed after the first one of a batch of titles"},
+          "cache_hits": {"type": "integer", "description": "Titles whose links came from the cache"},
+          "filtered": {"type": "integer", "description": "Links dropped as boring"}
+        }
+      },
+      "RaceRequest": {
+        "type": "object",
+        "required": ["from", "to"],
+        "properties": {
+          "from": {"type": "string"},
+          "to": {"type": "string"},
+          "lang": {"type": "string"},
+          "all": {"type": "boolean"},
+          "max_paths": {"type": "integer", "minimum": 0, "maximum": 100},
+          "max_depth": {"type": "integer", "minimum": 0},
+          "max_pages": {"type": "integer", "minimum": 0},
+          "max_api_calls": {"type": "integer", "minimum": 0},
+          "timeout_ms": {"type": "integer", "minimum": 0},
+          "mode": {"type": "string", "enum": ["strict", "loose", "custom"]},
+          "namespaces": {"type": "string"},
+          "heuristic": {"type": "string", "enum": ["title", "categories", "inbound"]}
+        }
+      },
+      "VerifyRequest": {
+        "type": "object",
+        "required": ["path"],
+        "properties": {
+          "path": {"type": "array", "items": {"type": "string"}, "minItems": 2, "maxItems": 50},
+          "lang": {"type": "string"},
+          "mode": {"type": "string", "enum": ["strict", "loose", "custom"]},
+          "namespaces": {"type": "string"}
+        }
+      },
+      "Verification": {
+        "type": "object",
+        "required": ["path", "resolved", "hops", "valid", "broken"],
+        "properties": {
+          "path": {"type": "array", "items": {"type": "string"}},
+          "resolved": {"type": "array", "items": {"type": "string"}, "description": "Titles the pages of the path resolve to after redirects and normalization"},
+          "hops": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["from", "to", "valid"],
+              "properties": {
+                "from": {"type": "string"},
+                "to": {"type": "string"},
+                "valid": {"type": "boolean"},
+                "via": {"type": "string", "description": "Title of the link followed, if it redirects to the next page"},
+                "reason": {"type": "string", "enum": ["missing", "no_link", "namespace"], "description": "Why the hop is broken: a page does not exist, doesn't link to the next, or is outside the namespaces races go through"},
+                "error": {"type": "string"}
+              }
+            }
+          },
+          "valid": {"type": "boolean"},
+          "broken": {"type": "integer", "description": "Index of the first broken hop, -1 if none is"}
+        }
+      },
+      "Job": {
+        "type": "object",
+        "required": ["id", "from", "to", "status", "created", "elapsed_ms", "api_requests", "pages_explored"],
+        "properties": {
+          "id": {"type": "string"},
+          "from": {"type": "string"},
+          "to": {"type": "string"},
+          "lang": {"type": "string"},
+          "all": {"type": "boolean"},
+          "max_paths": {"type": "integer"},
+          "max_depth": {"type": "integer", "description": "Limits of the race, within those of the server"},
+          "max_pages": {"type": "integer"},
+          "max_api_calls": {"type": "integer"},
+          "timeout_ms": {"type": "integer"},
+          "mode": {"type": "string"},
+          "namespaces": {"type": "string", "description": "Pipe separated namespaces the race goes through"},
+          "heuristic": {"type": "string"},
+          "status": {"type": "string", "enum": ["queued", "running", "done", "failed", "cancelled"]},
+          "created": {"type": "string", "format": "date-time"},
+          "started": {"type": "string", "format": "date-time"},
+          "finished": {"type": "string", "format": "date-time"},
+          "elapsed_ms": {"type": "integer"},
+          "api_requests": {"type": "integer"},
+          "pages_explored": {"type": "integer"},
+          "result": {"$ref": "#/components/schemas/RaceResult"},
+          "error": {"$ref": "#/components/schemas/Error"}
+        }
+      },
+      "Event": {
+        "type": "object",
+        "required": ["type", "depth", "time"],
+        "properties": {
+          "type": {"type": "string", "enum": ["status", "expanded", "fetched", "discovered", "midpoint"]},
+          "direction": {"type": "string", "enum": ["forward", "backward"]},
+          "depth": {"type": "integer", "description": "Distance in links from where the direction started"},
+          "title": {"type": "string", "description": "Page discovered, or the midpoint"},
+          "parent": {"type": "string", "description": "Page the discovered page was reached from"},
+          "pages": {"type": "integer", "description": "Size of the frontier expanded, or of the pages whose links were fetched"},
+          "links": {"type": "integer", "description": "Number of links fetched"},
+          "path": {"type": "array", "items": {"type": "string"}, "description": "Path found, for the midpoint"},
+          "time": {"type": "string", "format": "date-time"},
+          "job": {"$ref": "#/components/schemas/Job"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "required": ["error", "code", "status"],
+        "properties": {
+          "error": {"type": "string"},
+          "code": {"type": "string", "example": "not_found"},
+          "status": {"type": "integer", "example": 404},
+          "title": {"type": "string", "description": "Page that does not exist"},
+          "suggestions": {"type": "array", "items": {"type": "string"}, "description": "Existing pages with similar titles"},
+          "limit_exceeded": {
+            "type": "object",
+            "description": "Limit the race reached, and how far each direction of the search got",
+            "properties": {
+              "limit": {"type": "string", "enum": ["depth", "pages", "requests", "timeout"]},
+              "forward": {"$ref": "#/components/schemas/FrontierStats"},
+              "backward": {"$ref": "#/components/schemas/FrontierStats"}
+            }
+          }
+        }
+      },
+      "FrontierStats": {
+        "type": "object",
+        "properties": {
+          "depth": {"type": "integer", "description": "Layers of links expanded"},
+          "pages": {"type": "integer", "description": "Pages reached"},
+          "frontier": {"type": "integer", "description": "Pages reached by the last layer, whose links were not requested yet"}
+        }
+      }
+    },
+    "responses": {
+      "Error": {
+        "description": "Error",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    }
+  }
+}
+`
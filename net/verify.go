@@ -0,0 +1,58 @@
+package net
+
+import (
+  "encoding/json"
+  "fmt"
+  "log"
+  "net/http"
+  "github.com/86me/wikiracer/links"
+)
+
+// Most pages of a path verified at once, the titles an API request takes
+const maxVerifyPath = 50
+
+// VerifyRequest is the JSON body of a path verification
+type VerifyRequest struct {
+  Path []string `json:"path"`
+  // Wikipedia language code to verify on instead of the server's wiki
+  Lang string `json:"lang,omitempty"`
+  // Race mode and namespaces whose links count, see RaceOptions
+  Mode string `json:"mode,omitempty"`
+  Namespaces string `json:"namespaces,omitempty"`
+}
+
+// VerifyPath checks that each page of the path in the JSON body links to
+// the next one, answering with a links.Verification whether it does or not
+func (wr *WikiRace) VerifyPath(w http.ResponseWriter, r *http.Request) {
+  var params VerifyRequest
+  if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+    respondWithError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+    return
+  }
+  if len(params.Path) < 2 {
+    respondWithError(w, http.StatusBadRequest, links.ErrShortPath.Error())
+    return
+  }
+  if len(params.Path) > maxVerifyPath {
+    respondWithError(w, http.StatusBadRequest, fmt.Sprintf("a path has at most %d pages", maxVerifyPath))
+    return
+  }
+  options, err := wr.mode(RaceOptions{Mode: params.Mode, Namespaces: params.Namespaces})
+  if err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+  source, err := wr.source(params.Lang, options.Namespaces)
+  if err != nil {
+    respondWithError(w, http.StatusBadRequest, err.Error())
+    return
+  }
+
+  verification, err := links.Verify(r.Context(), source, params.Path, options.searchOptions(source).Namespaces)
+  if err != nil {
+    log.Printf("[%s] Verifying %q failed: %s", r.RemoteAddr, params.Path, err)
+    respondWithRaceError(w, err)
+    return
+  }
+  respondWithJSON(w, http.StatusOK, verification)
+}
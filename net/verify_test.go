@@ -0,0 +1,59 @@
+package net
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+    "github.com/86me/wikiracer/links"
+)
+
+func TestVerifyPath(t *testing.T) {
+    graph := links.NewMemoryGraph(links.Links{
+        "Start":             {"Category:Shortcut", "A"},
+        "Category:Shortcut": {"Target"},
+        "A":                 {"B"},
+        "B":                 {"Target"},
+    })
+    graph.Redirect("Begin", "Start")
+    wr = WikiRace{Source: graph}
+    wr.Initialize()
+
+    tests := []struct {
+        body   string
+        status int
+        valid  bool
+        broken int
+    }{
+        {`{"path": ["Begin", "A", "B", "Target"]}`, http.StatusOK, true, -1},
+        {`{"path": ["Start", "Category:Shortcut", "Target"]}`, http.StatusOK, true, -1},
+        // Broken paths are a result too
+        {`{"path": ["Start", "A", "Target"]}`, http.StatusOK, false, 1},
+        {`{"path": ["Start", "Nowhere", "Target"]}`, http.StatusOK, false, 0},
+        {`{"path": ["Start", "Category:Shortcut", "Target"], "mode": "strict"}`, http.StatusOK, false, 0},
+        {`{"path": ["Start"]}`, http.StatusBadRequest, false, 0},
+        {`{"path": ["Start", "A"], "mode": "human"}`, http.StatusBadRequest, false, 0},
+        {`{"path": ["Start", "A"]`, http.StatusBadRequest, false, 0},
+        {`{"path": ["` + strings.Repeat(`A", "`, maxVerifyPath) + `B"]}`, http.StatusBadRequest, false, 0},
+    }
+
+    for i, test := range tests {
+        req, _ := http.NewRequest("POST", "/api/v1/verify", strings.NewReader(test.body))
+        response := executeRequest(req)
+        if response.Code != test.status {
+            t.Errorf("tests[%d]: expected %d, got %d: %s", i, test.status, response.Code, response.Body.String())
+            continue
+        }
+        if test.status != http.StatusOK {
+            continue
+        }
+
+        var result links.Verification
+        if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil {
+            t.Fatalf("tests[%d]: %s", i, err)
+        }
+        if result.Valid != test.valid || result.Broken != test.broken || len(result.Hops) != len(result.Path)-1 {
+            t.Errorf("tests[%d]: unexpected result: %s", i, response.Body.String())
+        }
+    }
+}
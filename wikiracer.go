@@ -1,9 +1,13 @@
 package main
 
 import (
+  "context"
+  "errors"
   "fmt"
   "strings"
   "os"
+  "text/tabwriter"
+  "os/signal"
   "flag"
   "log"
   "io/ioutil"
@@ -16,6 +20,37 @@ var (
   debug = flag.Bool("debug", false, "Output logs to stderr")
   help = flag.Bool("help", false, "Additional help information")
   serve = flag.Bool("serve", false, "Run HTTP server")
+  replay = flag.String("replay", "", "Race offline against links recorded in `file`")
+  record = flag.String("record", "", "Record the links fetched while racing to `file`")
+  graphFile = flag.String("graph", "", "Race offline against a `file` built by \"wikiracer import\"")
+  lang = flag.String("lang", "en", "Wikipedia language `code` to race on")
+  endpoint = flag.String("endpoint", "", "MediaWiki API `url` to race on instead of Wikipedia")
+  agent = flag.String("user-agent", "", "User-Agent sent to the MediaWiki API")
+  maxRequests = flag.Int("max-requests", links.DefaultClient.MaxInFlight, "Most API requests in flight at once")
+  batchWorkers = flag.Int("batch-workers", links.DefaultBatchWorkers, "Batches of 50 pages whose links are fetched at once per search direction")
+  rate = flag.Float64("rate", links.DefaultClient.Rate, "Most API requests per second")
+  retries = flag.Int("retries", links.DefaultClient.MaxRetries, "Retries of API requests that were throttled or failed")
+  maxLag = flag.Int("maxlag", links.DefaultClient.MaxLag, "Database lag in `seconds` at which the API should turn us away")
+  rules = flag.String("rules", links.RulesAll, "Follow every link the API lists (all), or only those in the body prose of articles (human)")
+  asOf = flag.String("as-of", "", "Race on the revisions of pages current at this `time`, RFC 3339 or a date, instead of their latest")
+  mode = flag.String("mode", "", "Follow links into articles only (strict), articles, categories and portals (loose) or -namespaces (custom) (default \"loose\")")
+  namespaces = flag.String("namespaces", "", "Pipe separated `namespaces` to follow links into with the custom mode")
+  filterFile = flag.String("filter", "", "Drop the boring links described by the rules in `file` instead of the built-in ones")
+  noFilter = flag.Bool("no-filter", false, "Follow every link, boring or not")
+  cacheDir = flag.String("cache-dir", "", "Keep fetched links in `dir` to reuse them in later races")
+  workers = flag.Int("workers", 2, "Races run at once in the background when serving HTTP")
+  jobTTL = flag.Duration("job-ttl", time.Hour, "How long finished background races are kept when serving HTTP")
+  jobsFile = flag.String("jobs-file", "", "Keep background races in `file` across restarts when serving HTTP")
+  cacheTTL = flag.Duration("cache-ttl", 24*time.Hour, "How long cached links are used for, forever if 0")
+  heuristic = flag.String("heuristic", "", "Search forward best-first, expanding the pages this `heuristic` (title, categories or inbound) scores highest first, instead of breadth-first. Paths found may not be shortest")
+  all = flag.Bool("all", false, "Find every shortest path instead of the first one")
+  stats = flag.Bool("stats", false, "Print what each direction of the search did")
+  explain = flag.Bool("explain", false, "Print what each direction of the search did at each depth, along with -stats")
+  maxPaths = flag.Int("max-paths", 100, "Most paths printed with -all, all of them if 0")
+  maxDepth = flag.Int("max-depth", 0, "Give up on paths longer than this many links")
+  maxPages = flag.Int64("max-pages", 0, "Give up after requesting the links of this many pages, per race when serving HTTP")
+  maxAPICalls = flag.Int64("max-api-calls", 0, "Give up after this many API requests, per race when serving HTTP")
+  timeout = flag.Duration("timeout", 0, "Give up after this long, per race when serving HTTP")
 
   fromTitle string
   toTitle string
@@ -31,6 +66,10 @@ func usage() {
     fmt.Println("To find the quickest path between two wikipedia articles.")
     fmt.Println(" ", os.Args[0], "-serve [address:port]")
     fmt.Println("To serve WikiRacer on HTTP [address:port]")
+    fmt.Println(" ", os.Args[0], "import -dump enwiki-page.sql.gz -dump enwiki-pagelinks.sql.gz -out graph.db")
+    fmt.Println("To build a graph of a Wikipedia dump to race offline with -graph graph.db")
+    fmt.Println(" ", os.Args[0], "verify \"Ada Lovelace\" \"Analytical Engine\" \"Alan Turing\"")
+    fmt.Println("To check that each page of a path still links to the next")
     os.Exit(1)
   } else {
     fmt.Fprintf(os.Stderr, "usage: %s [-debug] [-serve] \"from_title\" \"to_title\"\n\n", os.Args[0])
@@ -38,6 +77,49 @@ func usage() {
   }
 }
 
+// Exit codes for failed races
+const (
+  exitNoPath = 2
+  exitPageMissing = 3
+  exitAPI = 4
+  exitLimit = 5
+  // A path checked by "wikiracer verify" is broken
+  exitBroken = 6
+)
+
+// Prints why the race failed and exits with a matching code
+func fail(err error) {
+  var apiErr *links.ErrAPI
+  switch {
+  case errors.Is(err, links.ErrNoPath):
+    fmt.Fprintln(os.Stderr, "No results.")
+    os.Exit(exitNoPath)
+  case errors.Is(err, links.ErrPageMissing):
+    var notFound *links.PageNotFoundError
+    if errors.As(err, &notFound) {
+      fmt.Fprintln(os.Stderr, "Not found:", notFound.Title)
+      if len(notFound.Suggestions) > 0 {
+        fmt.Fprintln(os.Stderr, "Did you mean:")
+        for _, title := range notFound.Suggestions {
+          fmt.Fprintln(os.Stderr, " ", title)
+        }
+      }
+    } else {
+      fmt.Fprintln(os.Stderr, "Not found:", err)
+    }
+    os.Exit(exitPageMissing)
+  case errors.Is(err, links.ErrLimitExceeded):
+    fmt.Fprintln(os.Stderr, "Gave up:", err)
+    os.Exit(exitLimit)
+  case errors.Is(err, links.ErrRateLimited), errors.As(err, &apiErr):
+    fmt.Fprintln(os.Stderr, "Wikipedia error:", err)
+    os.Exit(exitAPI)
+  default:
+    fmt.Fprintln(os.Stderr, "Search stopped:", err)
+    os.Exit(1)
+  }
+}
+
 func init() {
   flag.Usage = usage
   flag.Parse()
@@ -48,9 +130,35 @@ func init() {
     log.SetOutput(os.Stdout)
   }
 
+  // Every race shares the client, even when serving many of them at once
+  links.DefaultClient.MaxInFlight = *maxRequests
+  links.DefaultClient.Rate = *rate
+  links.DefaultClient.Burst = int(*rate)
+  links.DefaultClient.MaxRetries = *retries
+  links.DefaultClient.MaxLag = *maxLag
+
+  if flag.Arg(0) == "import" {
+    runImport(flag.Args()[1:])
+    os.Exit(0)
+  }
+  if flag.Arg(0) == "verify" {
+    runVerify(flag.Args()[1:])
+    os.Exit(0)
+  }
+
   // Start HTTP service
   if *serve {
-    wr := net.WikiRace{}
+    wr := net.WikiRace{
+      Config: config(),
+      Cache: openCache(),
+      Workers: *workers,
+      JobTTL: *jobTTL,
+      JobsFile: *jobsFile,
+      Limits: searchOptions(),
+    }
+    if len(*replay) > 0 || len(*graphFile) > 0 {
+      wr.Source = linkSource()
+    }
     wr.Initialize()
     port := flag.Arg(0)
     if len(port) > 0 {
@@ -72,19 +180,325 @@ func init() {
 
 }
 
+// Returns the wiki selected by the command line flags
+func config() links.Config {
+  namespaces, err := links.ModeNamespaces(*mode, *namespaces)
+  if err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+  var at time.Time
+  if len(*asOf) > 0 {
+    if at, err = links.ParseAsOf(*asOf); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+  }
+  c := links.Config{
+    Endpoint: *endpoint,
+    Lang: *lang,
+    UserAgent: *agent,
+    Namespaces: namespaces,
+    BatchWorkers: *batchWorkers,
+    Filter: linkFilter(),
+    Rules: *rules,
+    AsOf: at,
+  }
+  if err := c.Validate(); err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+  return c
+}
+
+// Returns the search limits selected by the command line flags
+func searchOptions() links.SearchOptions {
+  return links.SearchOptions{
+    MaxDepth: *maxDepth,
+    MaxPages: *maxPages,
+    MaxRequests: *maxAPICalls,
+    Timeout: *timeout,
+    // Offline sources know the links into every namespace
+    Namespaces: namespaceNumbers(),
+  }
+}
+
+// Returns the namespaces races go through, selected by the command line flags
+func namespaceNumbers() []int {
+  namespaces, _ := links.ParseNamespaces(config().Namespaces)
+  return namespaces
+}
+
+// Returns the source of links selected by the command line flags
+func linkSource() links.LinkSource {
+  if len(*replay) > 0 {
+    fixture, err := links.LoadFixture(*replay)
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Unable to load fixture:", err)
+      os.Exit(1)
+    }
+    return fixture
+  }
+  if len(*graphFile) > 0 {
+    graph, err := links.LoadGraph(*graphFile)
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Unable to load graph:", err)
+      os.Exit(1)
+    }
+    return graph
+  }
+  if c := openCache(); c != nil {
+    return c.Source(links.NewSource(config()), config().Wiki())
+  }
+  return links.NewSource(config())
+}
+
+var filter *links.Filter
+
+// Returns the link filter selected by the command line flags, or nil for the
+// default one
+func linkFilter() *links.Filter {
+  if *noFilter {
+    return links.NoFilter
+  }
+  if len(*filterFile) == 0 {
+    return nil
+  }
+  if filter == nil {
+    var err error
+    filter, err = links.LoadFilter(*filterFile)
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Unable to load filter:", err)
+      os.Exit(1)
+    }
+  }
+  return filter
+}
+
+var cache *links.Cache
+
+// Returns the link cache selected by the command line flags, or nil
+func openCache() *links.Cache {
+  if len(*cacheDir) == 0 {
+    return nil
+  }
+  if cache == nil {
+    var err error
+    cache, err = links.OpenCache(*cacheDir, *cacheTTL)
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Unable to open cache:", err)
+      os.Exit(1)
+    }
+  }
+  return cache
+}
+
+// Files given with repeated flags
+type fileList []string
+
+func (l *fileList) String() string {
+  return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(file string) error {
+  *l = append(*l, file)
+  return nil
+}
+
+// Builds a graph to race offline on out of Wikipedia dumps
+func runImport(args []string) {
+  var dumps fileList
+  flags := flag.NewFlagSet("import", flag.ExitOnError)
+  flags.Var(&dumps, "dump", "Wikipedia dump `file` to import: the page, pagelinks, redirect and linktarget .sql(.gz) tables or a pages-articles .xml(.bz2), repeated for each")
+  out := flags.String("out", "graph.db", "Write the graph to `file`")
+  ns := flags.String("namespaces", "0|14|100", "Pipe separated `namespaces` of the pages to import")
+  flags.Parse(args)
+  if len(dumps) == 0 {
+    fmt.Fprintf(os.Stderr, "usage: %s import -dump file [-dump file...] [-out graph.db]\n\n", os.Args[0])
+    flags.PrintDefaults()
+    os.Exit(1)
+  }
+
+  startTime := time.Now()
+  graph, err := links.ImportDump(dumps, *ns)
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "Unable to import dump:", err)
+    os.Exit(1)
+  }
+  if err := graph.Save(*out); err != nil {
+    fmt.Fprintln(os.Stderr, "Unable to save graph:", err)
+    os.Exit(1)
+  }
+  stats := graph.Stats()
+  fmt.Printf("Imported %d pages, %d links and %d redirects to %s\n", stats.Pages, stats.Links, stats.Redirects, *out)
+  fmt.Println("Elapsed time: ", time.Since(startTime))
+}
+
+// Checks that each page of path links to the next on the wiki, or the source
+// selected by the command line flags
+func runVerify(path []string) {
+  if len(path) < 2 {
+    fmt.Fprintf(os.Stderr, "usage: %s [flags] verify \"title\" \"title\" [\"title\"...]\n\n", os.Args[0])
+    flag.PrintDefaults()
+    os.Exit(1)
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+  defer stop()
+
+  v, err := links.Verify(ctx, linkSource(), path, namespaceNumbers())
+  if err != nil {
+    fail(err)
+  }
+  for _, hop := range v.Hops {
+    switch {
+    case !hop.Valid:
+      fmt.Println("✗", hop.From, "->", hop.To+":", hop.Error)
+    case len(hop.Via) > 0:
+      fmt.Println("✓", hop.From, "->", hop.To, "(via "+hop.Via+")")
+    default:
+      fmt.Println("✓", hop.From, "->", hop.To)
+    }
+  }
+  if !v.Valid {
+    fmt.Fprintf(os.Stderr, "Broken at hop %d of %d\n", v.Broken+1, len(v.Hops))
+    os.Exit(exitBroken)
+  }
+}
+
 func main() {
   startTime := time.Now()
 
   // Run wikirace
-  graph := links.NewPageGraph()
-  var links[]string
+  source := linkSource()
+  var recorder *links.Recorder
+  if len(*record) > 0 {
+    recorder = links.NewRecorder(source)
+    source = recorder
+  }
+  graph := links.NewPageGraph(source)
+  options := searchOptions()
+  var err error
+  if options.Heuristic, err = links.NewHeuristic(*heuristic, source); err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+
+  // Interrupting stops the crawl instead of killing it mid-request
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+  defer stop()
 
-  for _, page := range graph.Search(fromTitle, toTitle) {
-    links = append(links, page)
+  var result links.Result
+  if *all {
+    result, err = graph.SearchAllResult(ctx, fromTitle, toTitle, *maxPaths, options)
+  } else {
+    result, err = graph.SearchResult(ctx, fromTitle, toTitle, options)
+    result.Paths = [][]string{result.Path}
+  }
+  if recorder != nil {
+    if err := recorder.Save(*record); err != nil {
+      fmt.Fprintln(os.Stderr, "Unable to save fixture:", err)
+    }
+  }
+  if err != nil {
+    // How far a failed race got helps with setting its limits
+    if (*stats || *explain) && len(result.Forward.Reached) > 0 {
+      printStats(result.Stats, *explain)
+    }
+    fail(err)
+  }
+  // Let the user know when a title was a redirect or got normalized
+  for _, title := range []string{fromTitle, toTitle} {
+    if resolved := graph.Resolve(title); resolved != title {
+      fmt.Println(title, "→", resolved)
+    }
+  }
+  for _, path := range result.Paths {
+    fmt.Println(annotate(path, result.Namespaces))
+  }
+  if *all {
+    // Best-first searches only know the paths they came across
+    kind := "shortest paths"
+    if options.Heuristic != nil {
+      kind = "paths found"
+    }
+    fmt.Printf("%d of %d %s\n", len(result.Paths), result.TotalPaths, kind)
   }
-  fmt.Println(strings.Join(links, ` -> `))
-  graph.Stop()
 
   fmt.Println("Elapsed time: ", time.Since(startTime))
+  if cache != nil {
+    stats := cache.Stats()
+    fmt.Println("Cache: ", stats.Hits, "hits,", stats.Misses, "misses")
+  }
+  if *stats || *explain {
+    printStats(result.Stats, *explain)
+  }
 }
 
+// Prints what each direction of a search did as a table, and what it did at
+// each depth if explain is set
+func printStats(stats links.Stats, explain bool) {
+  w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+  defer w.Flush()
+  forward, backward := stats.Forward, stats.Backward
+
+  fmt.Fprintln(w, "\tForward\tBackward\t")
+  for _, row := range []struct {
+    name string
+    forward, backward int64
+  }{
+    {"Pages expanded", sum(forward.Expanded), sum(backward.Expanded)},
+    {"Pages reached", sum(forward.Reached), sum(backward.Reached)},
+    {"Links", int64(forward.Links), int64(backward.Links)},
+    {"Boring links", int64(forward.Filtered), int64(backward.Filtered)},
+    {"API requests", int64(forward.Requests), int64(backward.Requests)},
+    {"Continuations", int64(forward.Continuations), int64(backward.Continuations)},
+    {"Bytes", forward.Bytes, backward.Bytes},
+    {"Cache hits", int64(forward.CacheHits), int64(backward.CacheHits)},
+  } {
+    fmt.Fprintf(w, "%s\t%d\t%d\t\n", row.name, row.forward, row.backward)
+  }
+  if !explain {
+    return
+  }
+
+  w.Flush()
+  fmt.Println()
+  fmt.Fprintln(w, "Depth\tForward expanded\tForward reached\tBackward expanded\tBackward reached\t")
+  at := func(counts []int, depth int) string {
+    if depth < len(counts) {
+      return fmt.Sprint(counts[depth])
+    }
+    return "-"
+  }
+  depths := len(forward.Reached)
+  for _, counts := range [][]int{forward.Expanded, backward.Expanded, backward.Reached} {
+    if len(counts) > depths {
+      depths = len(counts)
+    }
+  }
+  for depth := 0; depth < depths; depth++ {
+    fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t\n", depth, at(forward.Expanded, depth), at(forward.Reached, depth), at(backward.Expanded, depth), at(backward.Reached, depth))
+  }
+}
+
+func sum(counts []int) int64 {
+  total := int64(0)
+  for _, count := range counts {
+    total += int64(count)
+  }
+  return total
+}
+
+
+// Joins the titles of path, marking those that aren't articles with their
+// namespace
+func annotate(path []string, namespaces map[string]int) string {
+  titles := make([]string, len(path))
+  for i, title := range path {
+    titles[i] = title
+    if ns := namespaces[title]; ns != 0 {
+      titles[i] = fmt.Sprintf("%s [ns %d]", title, ns)
+    }
+  }
+  return strings.Join(titles, " -> ")
+}